@@ -0,0 +1,193 @@
+package bitcask
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression BackupTo 输出的压缩算法
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// BackupTo 将数据目录在线备份为 tar 流写入 w, c 指定压缩算法
+//
+// 与 Backup 相同, 只在开始时短暂持有写锁确定备份的内容. 清单作为最后一个文件写入,
+// 记录之前每个文件的 crc32, 没有清单的流是不完整的. w 不会被关闭
+func (b *Bitcask) BackupTo(w io.Writer, c Compression) error {
+	created := time.Now()
+	files, err := b.startBackup("", nil)
+	defer func() {
+		for _, f := range files {
+			if f.src != nil {
+				_ = f.src.Close()
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	cw, err := compressWriter(w, c)
+	if err != nil {
+		return err
+	}
+	err = writeArchive(cw, files, created)
+	if cerr := cw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeArchive 依次写入 files 和记录其 crc32 的清单
+func writeArchive(w io.Writer, files []backupFile, created time.Time) error {
+	tw := tar.NewWriter(w)
+	m := newManifest(created, nil, len(files))
+	for _, f := range files {
+		if err := tw.WriteHeader(tarHeader(f.Name, f.Size, f.ModTime)); err != nil {
+			return err
+		}
+		h := crc32.NewIEEE()
+		if _, err := io.Copy(io.MultiWriter(tw, h), io.NewSectionReader(f.src, 0, f.Size)); err != nil {
+			return err
+		}
+		f.CRC = h.Sum32()
+		m.Files = append(m.Files, f.ManifestFile)
+	}
+
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(tarHeader(manifestFileName, int64(len(data)), created)); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func tarHeader(name string, size int64, modTime time.Time) *tar.Header {
+	return &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: size, ModTime: modTime}
+}
+
+// RestoreFrom 将 BackupTo 输出的 tar 流解压到 dir, dir 不存在时创建, 存在时必须为空
+//
+// 压缩算法根据流的开头自动识别. 所有文件写入后按清单校验大小和 crc32,
+// 恢复失败时 dir 中可能留有部分文件
+func RestoreFrom(r io.Reader, dir string) error {
+	dr, err := decompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	if err := prepareEmptyDir(dir); err != nil {
+		return err
+	}
+
+	var m *Manifest
+	got := make(map[string]ManifestFile)
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// 清单是最后一个文件, 文件名不能包含目录
+		if m != nil || hdr.Typeflag != tar.TypeReg || !validArchiveName(hdr.Name) {
+			return fmt.Errorf("%s: %w", hdr.Name, ErrInvalidBackup)
+		}
+
+		if hdr.Name == manifestFileName {
+			m = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, ErrInvalidBackup)
+			}
+			continue
+		}
+		crc, err := copyFile(filepath.Join(dir, hdr.Name), tr)
+		if err != nil {
+			return err
+		}
+		got[hdr.Name] = ManifestFile{Name: hdr.Name, Size: hdr.Size, CRC: crc}
+	}
+
+	if m == nil || m.Parent != "" || len(m.Files) != len(got) {
+		return ErrInvalidBackup
+	}
+	for _, f := range m.Files {
+		g, ok := got[f.Name]
+		if !ok {
+			return fmt.Errorf("%s: %w", f.Name, ErrInvalidBackup)
+		}
+		if g.Size != f.Size || g.CRC != f.CRC {
+			return fmt.Errorf("%s: %w", f.Name, ErrBackupChecksum)
+		}
+	}
+	return nil
+}
+
+func validArchiveName(name string) bool {
+	return name == filepath.Base(name) && name != "." && name != ".."
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressWriter 返回的 Close 结束压缩流, 不关闭 w
+func compressWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, ErrUnknownCompression
+	}
+}
+
+// decompressReader 根据流开头的魔数识别压缩算法
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
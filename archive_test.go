@@ -0,0 +1,88 @@
+package bitcask
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupTo(t *testing.T) {
+	b, err := Open(t.TempDir(), WithMaxFileSize(1024), WithBlobThreshold(512))
+	require.NoError(t, err)
+	defer b.Close()
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("val-%d", i))))
+	}
+	require.NoError(t, b.Put([]byte("blob"), bytes.Repeat([]byte("b"), 1024)))
+	require.NoError(t, b.Merge())
+	require.NoError(t, b.Delete([]byte("key-00")))
+	want := readAll(t, b)
+
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(fmt.Sprint(c), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, b.BackupTo(&buf, c))
+			switch c {
+			case CompressionGzip:
+				assert.True(t, bytes.HasPrefix(buf.Bytes(), gzipMagic))
+			case CompressionZstd:
+				assert.True(t, bytes.HasPrefix(buf.Bytes(), zstdMagic))
+			}
+
+			dir := filepath.Join(t.TempDir(), "restored")
+			require.NoError(t, RestoreFrom(&buf, dir))
+			rb, err := Open(dir)
+			require.NoError(t, err)
+			defer rb.Close()
+			assert.Equal(t, want, readAll(t, rb))
+			report, err := rb.Verify(context.Background())
+			require.NoError(t, err)
+			assert.True(t, report.OK(), "%+v", report)
+		})
+	}
+
+	assert.ErrorIs(t, b.BackupTo(&bytes.Buffer{}, Compression(9)), ErrUnknownCompression)
+}
+
+func TestRestoreFrom_Invalid(t *testing.T) {
+	b, err := Open(t.TempDir())
+	require.NoError(t, err)
+	defer b.Close()
+	require.NoError(t, b.Put([]byte("key"), []byte("value")))
+
+	var buf bytes.Buffer
+	require.NoError(t, b.BackupTo(&buf, CompressionNone))
+
+	// 篡改数据文件的内容
+	data := bytes.Clone(buf.Bytes())
+	i := bytes.Index(data, []byte("value"))
+	require.Positive(t, i)
+	data[i] ^= 0xff
+	assert.ErrorIs(t, RestoreFrom(bytes.NewReader(data), t.TempDir()), ErrBackupChecksum)
+
+	archive := func(names ...string) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range names {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: 1}))
+			_, err := tw.Write([]byte("x"))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		return &buf
+	}
+	// 没有清单
+	assert.ErrorIs(t, RestoreFrom(archive("000000001.data"), t.TempDir()), ErrInvalidBackup)
+	// 文件名包含目录
+	assert.ErrorIs(t, RestoreFrom(archive("../000000001.data"), t.TempDir()), ErrInvalidBackup)
+	assert.ErrorIs(t, RestoreFrom(&bytes.Buffer{}, t.TempDir()), ErrInvalidBackup)
+
+	require.NoError(t, RestoreFrom(bytes.NewReader(buf.Bytes()), t.TempDir()))
+}
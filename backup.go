@@ -0,0 +1,370 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+const manifestFileName = "MANIFEST"
+
+// Manifest 备份的文件清单, 保存在备份目录的 MANIFEST 文件中
+//
+// Files 列出备份时刻数据目录中的全部文件, 增量备份中未变化的文件标记为 Inherited, 内容保存在之前的备份中
+type Manifest struct {
+	ID      string         `json:"id"`
+	Parent  string         `json:"parent,omitempty"` // 增量备份所基于的备份, 完整备份为空
+	Created time.Time      `json:"created"`
+	Files   []ManifestFile `json:"files"`
+
+	Dir string `json:"-"` // 备份所在的目录, 由 ReadManifest 设置
+}
+
+// ManifestFile 备份中的一个文件, Name 为相对于备份目录的文件名
+type ManifestFile struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"` // 源文件的修改时间, 与 Size 一起判断文件在之后的备份中是否变化
+	CRC       uint32    `json:"crc"`
+	Inherited bool      `json:"inherited,omitempty"`
+}
+
+// backupFile 待备份的文件, src 不为空时需要复制 src 的前 Size 字节, 否则已经创建了硬链接或者继承自之前的备份
+type backupFile struct {
+	ManifestFile
+	src *os.File
+}
+
+// Backup 将数据目录在线备份到 dest, dest 不存在时创建, 存在时必须为空
+//
+// 备份开始时短暂持有写锁: 同步活跃文件, 为封存的数据文件, hint 文件和 blob 文件创建硬链接
+// (无法创建时改为复制), 并记录活跃文件当前的大小. 释放锁后复制活跃文件在该大小之前的内容,
+// 最后写入清单. 备份可以直接用 Open 打开, 内容为持有写锁时的时间点副本, 没有清单的备份是不完整的
+func (b *Bitcask) Backup(dest string) error {
+	return b.backup(dest, nil)
+}
+
+// BackupIncremental 在 since 的基础上增量备份到 dest, 只复制 since 之后新建或变化的文件
+//
+// 文件名, 大小和修改时间都与 since 中的记录相同的文件视为未变化, 不复制.
+// 增量备份不能单独打开, 需要通过 Restore 与之前的备份一起恢复
+func (b *Bitcask) BackupIncremental(dest string, since Manifest) error {
+	if since.ID == "" {
+		return ErrBackupChain
+	}
+	return b.backup(dest, &since)
+}
+
+func (b *Bitcask) backup(dest string, since *Manifest) error {
+	if err := prepareEmptyDir(dest); err != nil {
+		return err
+	}
+
+	created := time.Now()
+	files, err := b.startBackup(dest, since)
+	defer func() {
+		for _, f := range files {
+			if f.src != nil {
+				_ = f.src.Close()
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	m := newManifest(created, since, len(files))
+	for _, f := range files {
+		path := filepath.Join(dest, f.Name)
+		switch {
+		case f.Inherited:
+		case f.src != nil:
+			f.CRC, err = copyFile(path, io.NewSectionReader(f.src, 0, f.Size))
+		default:
+			f.CRC, err = checksumFile(path, f.Size)
+		}
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, f.ManifestFile)
+	}
+	return writeManifest(dest, m)
+}
+
+// startBackup 持有写锁确定备份的内容, 需要复制的文件保持打开, 之后被合并或回收删除也不影响读取.
+// dest 为空时不创建硬链接, 所有文件都保持打开
+func (b *Bitcask) startBackup(dest string, since *Manifest) ([]backupFile, error) {
+	prev := make(map[string]ManifestFile)
+	if since != nil {
+		for _, f := range since.Files {
+			prev[f.Name] = f
+		}
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if b.active != nil {
+		if err := b.active.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.blobs.sync(); err != nil {
+		return nil, err
+	}
+
+	var files []backupFile
+	// size 小于 0 时使用文件当前的大小
+	add := func(path string, size int64, sealed bool) error {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if size < 0 {
+			size = fi.Size()
+		}
+
+		f := backupFile{ManifestFile: ManifestFile{Name: filepath.Base(path), Size: size, ModTime: fi.ModTime()}}
+		if p, ok := prev[f.Name]; ok && p.Size == f.Size && p.ModTime.Equal(f.ModTime) {
+			f.CRC, f.Inherited = p.CRC, true
+		} else if !sealed || dest == "" || os.Link(path, filepath.Join(dest, f.Name)) != nil {
+			if f.src, err = os.Open(path); err != nil {
+				return err
+			}
+		}
+		files = append(files, f)
+		return nil
+	}
+
+	for _, df := range sortedFiles(b.files) {
+		if err := add(df.Path(), df.Size(), df != b.active); err != nil {
+			return files, err
+		}
+		hint := datafile.Name(b.options.Dir, df.ID(), datafile.HintExt)
+		if _, err := os.Stat(hint); err == nil {
+			if err := add(hint, -1, true); err != nil {
+				return files, err
+			}
+		}
+	}
+	for _, df := range sortedFiles(b.blobs.files) {
+		if err := add(df.Path(), df.Size(), df != b.blobs.active); err != nil {
+			return files, err
+		}
+	}
+	floor := filepath.Join(b.options.Dir, floorFileName)
+	if _, err := os.Stat(floor); err == nil {
+		if err := add(floor, -1, false); err != nil {
+			return files, err
+		}
+	}
+
+	return files, nil
+}
+
+func newManifest(created time.Time, since *Manifest, n int) Manifest {
+	m := Manifest{
+		ID:      strconv.FormatInt(created.UnixNano(), 16),
+		Created: created,
+		Files:   make([]ManifestFile, 0, n),
+	}
+	if since != nil {
+		m.Parent = since.ID
+	}
+	return m
+}
+
+func sortedFiles(files map[uint32]*datafile.DataFile) []*datafile.DataFile {
+	out := make([]*datafile.DataFile, 0, len(files))
+	for _, df := range files {
+		out = append(out, df)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID() < out[j].ID() })
+	return out
+}
+
+// prepareEmptyDir 创建备份或恢复的目标目录, 目录已经存在时必须为空
+func prepareEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return os.MkdirAll(dir, 0755)
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return ErrDirNotEmpty
+	}
+	return nil
+}
+
+// copyFile 将 r 的内容写入新文件 path 并落盘, 返回写入内容的 crc32
+func copyFile(path string, r io.Reader) (uint32, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+	return h.Sum32(), f.Close()
+}
+
+// checksumFile 返回 path 前 size 字节的 crc32, 文件不足 size 字节时返回 io.ErrUnexpectedEOF
+func checksumFile(path string, size int64) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.CopyN(h, f, size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// writeManifest 先写临时文件再重命名, 清单存在即表示备份完整
+func writeManifest(dir string, m Manifest) error {
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, manifestFileName)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func encodeManifest(m Manifest) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// ReadManifest 读取备份目录 dir 中的清单
+func ReadManifest(dir string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, err
+	}
+	m.Dir = dir
+	return m, nil
+}
+
+// Restore 在 dir 中重建 chain 中最后一个备份时刻的数据目录, dir 不存在时创建, 存在时必须为空
+//
+// chain 以完整备份开始, 之后依次是基于前一个备份的增量备份. 每个文件从保存其内容的最近一个备份中复制,
+// 复制时校验 crc32. 恢复失败时 dir 中可能留有部分文件
+func Restore(chain []Manifest, dir string) error {
+	srcs, err := restoreSources(chain)
+	if err != nil {
+		return err
+	}
+	if err := prepareEmptyDir(dir); err != nil {
+		return err
+	}
+
+	for _, f := range chain[len(chain)-1].Files {
+		if err := restoreFile(filepath.Join(srcs[f.Name], f.Name), filepath.Join(dir, f.Name), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSources 检查备份链, 返回最后一个备份中的每个文件内容所在的目录
+func restoreSources(chain []Manifest) (map[string]string, error) {
+	if len(chain) == 0 || chain[0].Parent != "" {
+		return nil, ErrBackupChain
+	}
+
+	srcs := make(map[string]string)
+	files := make(map[string]ManifestFile)
+	for i, m := range chain {
+		if m.Dir == "" || (i > 0 && m.Parent != chain[i-1].ID) {
+			return nil, ErrBackupChain
+		}
+
+		cur := make(map[string]ManifestFile, len(m.Files))
+		for _, f := range m.Files {
+			if f.Inherited {
+				p, ok := files[f.Name]
+				if !ok || p.Size != f.Size || p.CRC != f.CRC {
+					return nil, fmt.Errorf("%s: %w", f.Name, ErrBackupChain)
+				}
+			} else {
+				srcs[f.Name] = m.Dir
+			}
+			cur[f.Name] = f
+		}
+		files = cur
+	}
+	return srcs, nil
+}
+
+func restoreFile(src, dst string, f ManifestFile) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < f.Size {
+		return fmt.Errorf("%s: %w", src, ErrBackupChecksum)
+	}
+	crc, err := copyFile(dst, io.NewSectionReader(in, 0, f.Size))
+	if err != nil {
+		return err
+	}
+	if crc != f.CRC {
+		return fmt.Errorf("%s: %w", src, ErrBackupChecksum)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package bitcask
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir, WithBlobThreshold(1024))
+	require.NoError(t, err)
+	defer b.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("old")))
+	}
+	require.NoError(t, b.Put([]byte("blob"), bytes.Repeat([]byte("b"), 2048)))
+	require.NoError(t, b.Merge())
+	require.NoError(t, b.Put([]byte("key-0"), []byte("new")))
+	require.NoError(t, b.Delete([]byte("key-1")))
+
+	dest := filepath.Join(t.TempDir(), "backup")
+	require.NoError(t, b.Backup(dest))
+
+	// 备份之后的写入不影响备份
+	require.NoError(t, b.Put([]byte("key-2"), []byte("after")))
+	require.NoError(t, b.Put([]byte("after"), []byte("1")))
+
+	m, err := ReadManifest(dest)
+	require.NoError(t, err)
+	assert.False(t, m.Created.IsZero())
+	var names []string
+	for _, f := range m.Files {
+		fi, err := os.Stat(filepath.Join(dest, f.Name))
+		require.NoError(t, err)
+		assert.Equal(t, f.Size, fi.Size(), f.Name)
+		names = append(names, f.Name)
+	}
+	assert.Contains(t, names, "000000001.blob")
+
+	// 合并生成的数据文件是封存的, 通过硬链接备份
+	ids, err := datafile.List(dest, datafile.HintExt)
+	require.NoError(t, err)
+	require.NotEmpty(t, ids)
+	src, err := os.Stat(datafile.Name(dir, ids[0], datafile.DataExt))
+	require.NoError(t, err)
+	dst, err := os.Stat(datafile.Name(dest, ids[0], datafile.DataExt))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(src, dst))
+
+	bk, err := Open(dest)
+	require.NoError(t, err)
+	defer bk.Close()
+	for key, want := range map[string]string{"key-0": "new", "key-2": "old", "key-9": "old"} {
+		val, err := bk.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(val), key)
+	}
+	for _, key := range []string{"key-1", "after"} {
+		_, err = bk.Get([]byte(key))
+		assert.ErrorIs(t, err, ErrKeyNotFound, key)
+	}
+	val, err := bk.Get([]byte("blob"))
+	require.NoError(t, err)
+	assert.Len(t, val, 2048)
+
+	report, err := bk.Verify(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+
+	// 备份的写入不影响源目录
+	require.NoError(t, bk.Put([]byte("key-9"), []byte("backup")))
+	val, err = b.Get([]byte("key-9"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), val)
+
+	assert.ErrorIs(t, b.Backup(dest), ErrDirNotEmpty)
+	require.NoError(t, b.Close())
+	assert.ErrorIs(t, b.Backup(t.TempDir()), ErrClosed)
+}
+
+func TestBackup_ConcurrentWrites(t *testing.T) {
+	b, err := Open(t.TempDir(), WithMaxFileSize(4096))
+	require.NoError(t, err)
+	defer b.Close()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			assert.NoError(t, b.Put([]byte(fmt.Sprintf("key-%d", i%100)), []byte(fmt.Sprintf("val-%d", i))))
+		}
+	}()
+
+	dests := make([]string, 5)
+	for i := range dests {
+		dests[i] = filepath.Join(t.TempDir(), "backup")
+		require.NoError(t, b.Backup(dests[i]))
+	}
+	close(stop)
+	wg.Wait()
+
+	for _, dest := range dests {
+		bk, err := Open(dest)
+		require.NoError(t, err)
+		report, err := bk.Verify(context.Background())
+		require.NoError(t, err)
+		assert.True(t, report.OK(), "%+v", report)
+		require.NoError(t, bk.Close())
+	}
+}
+
+// readAll 返回 b 中的所有键值
+func readAll(t *testing.T, b *Bitcask) map[string]string {
+	t.Helper()
+
+	kvs := make(map[string]string)
+	keys, err := b.ListKeys()
+	require.NoError(t, err)
+	for _, key := range keys {
+		val, err := b.Get(key)
+		require.NoError(t, err)
+		kvs[string(key)] = string(val)
+	}
+	return kvs
+}
+
+func TestBackupIncremental(t *testing.T) {
+	b, err := Open(t.TempDir(), WithMaxFileSize(1024), WithBlobThreshold(512))
+	require.NoError(t, err)
+	defer b.Close()
+
+	put := func(n int, val string) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(val)))
+		}
+	}
+	backups := t.TempDir()
+	backup := func(name string, since *Manifest) Manifest {
+		dest := filepath.Join(backups, name)
+		if since == nil {
+			require.NoError(t, b.Backup(dest))
+		} else {
+			require.NoError(t, b.BackupIncremental(dest, *since))
+		}
+		m, err := ReadManifest(dest)
+		require.NoError(t, err)
+		return m
+	}
+
+	put(50, "v1")
+	require.NoError(t, b.Put([]byte("blob"), bytes.Repeat([]byte("b"), 1024)))
+	full := backup("full", nil)
+	assert.Empty(t, full.Parent)
+
+	// 只有新写入的文件和活跃文件被复制
+	put(10, "v2")
+	inc1 := backup("inc1", &full)
+	assert.Equal(t, full.ID, inc1.Parent)
+	var copied, inherited int
+	for _, f := range inc1.Files {
+		if f.Inherited {
+			inherited++
+			assert.NoFileExists(t, filepath.Join(inc1.Dir, f.Name))
+		} else {
+			copied++
+			assert.FileExists(t, filepath.Join(inc1.Dir, f.Name))
+		}
+	}
+	assert.Positive(t, inherited)
+	assert.Positive(t, copied)
+	assert.Less(t, copied, len(full.Files))
+
+	// 合并复用文件 id, 内容变化的文件需要重新复制
+	require.NoError(t, b.Merge())
+	require.NoError(t, b.Delete([]byte("key-00")))
+	inc2 := backup("inc2", &inc1)
+	want := readAll(t, b)
+	put(50, "after")
+
+	dir := filepath.Join(t.TempDir(), "restored")
+	require.NoError(t, Restore([]Manifest{full, inc1, inc2}, dir))
+	rb, err := Open(dir)
+	require.NoError(t, err)
+	defer rb.Close()
+	assert.Equal(t, want, readAll(t, rb))
+	report, err := rb.Verify(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+
+	// 恢复到中间的备份
+	dir = filepath.Join(t.TempDir(), "restored")
+	require.NoError(t, Restore([]Manifest{full, inc1}, dir))
+	rb1, err := Open(dir)
+	require.NoError(t, err)
+	defer rb1.Close()
+	val, err := rb1.Get([]byte("key-00"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v2"), val)
+
+	assert.ErrorIs(t, Restore([]Manifest{full, inc2}, t.TempDir()), ErrBackupChain)
+	assert.ErrorIs(t, Restore([]Manifest{inc1, inc2}, t.TempDir()), ErrBackupChain)
+	assert.ErrorIs(t, Restore(nil, t.TempDir()), ErrBackupChain)
+	assert.ErrorIs(t, b.BackupIncremental(t.TempDir(), Manifest{}), ErrBackupChain)
+
+	// 完整备份中的文件被篡改
+	var name string
+	for _, f := range inc2.Files {
+		if f.Inherited {
+			name = f.Name
+			break
+		}
+	}
+	require.NotEmpty(t, name)
+	path := filepath.Join(full.Dir, name)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.Remove(path)) // 硬链接, 不能原地修改
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	assert.ErrorIs(t, Restore([]Manifest{full, inc1, inc2}, t.TempDir()), ErrBackupChecksum)
+}
@@ -1 +1,246 @@
 package bitcask
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+)
+
+// batchOp 批次中对单个键的操作
+type batchOp struct {
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+// Batch 一组原子写入的操作, 同一个键仅保留最后一次操作
+//
+// Batch 不是并发安全的
+type Batch struct {
+	ops   []batchOp
+	index map[string]int
+}
+
+// NewBatch 创建空的批次
+func NewBatch() *Batch {
+	return &Batch{index: make(map[string]int)}
+}
+
+// Put 在批次中写入 key/value, 键和值会被复制
+func (wb *Batch) Put(key, value []byte) error {
+	if err := checkKeyValue(key, value); err != nil {
+		return err
+	}
+	wb.set(batchOp{key: bytes.Clone(key), value: bytes.Clone(value)})
+	return nil
+}
+
+// Delete 在批次中删除 key
+func (wb *Batch) Delete(key []byte) error {
+	if err := checkKeyValue(key, nil); err != nil {
+		return err
+	}
+	wb.set(batchOp{key: bytes.Clone(key), deleted: true})
+	return nil
+}
+
+// Len 返回批次中操作的键的数量
+func (wb *Batch) Len() int {
+	return len(wb.ops)
+}
+
+// ForEach 按加入顺序遍历批次中的操作, deleted 为 true 时表示删除, fn 返回 false 时停止
+func (wb *Batch) ForEach(fn func(key, value []byte, deleted bool) bool) {
+	for _, op := range wb.ops {
+		if !fn(op.key, op.value, op.deleted) {
+			return
+		}
+	}
+}
+
+// Reset 清空批次
+func (wb *Batch) Reset() {
+	wb.ops = wb.ops[:0]
+	clear(wb.index)
+}
+
+func (wb *Batch) set(op batchOp) {
+	if i, ok := wb.index[string(op.key)]; ok {
+		wb.ops[i] = op
+		return
+	}
+	wb.index[string(op.key)] = len(wb.ops)
+	wb.ops = append(wb.ops, op)
+}
+
+func (wb *Batch) get(key []byte) (batchOp, bool) {
+	i, ok := wb.index[string(key)]
+	if !ok {
+		return batchOp{}, false
+	}
+	return wb.ops[i], true
+}
+
+// WriteBatch 原子地写入批次中的所有操作
+//
+// 批次的记录连续写入同一个数据文件, 以 TypeBatch 开始, TypeCommit 结束,
+// 崩溃后没有提交标记的批次在加载时被整体丢弃
+func (b *Bitcask) WriteBatch(wb *Batch) error {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+
+	return b.writeBatch(wb)
+}
+
+func (b *Bitcask) writeBatch(wb *Batch) error {
+	tstamp := time.Now().Unix()
+
+	entries := make([]*internal.Entry, 0, len(wb.ops))
+	ptrs := make([]*internal.BlobPointer, 0, len(wb.ops))
+	values := make([][]byte, 0, len(wb.ops))
+	for _, op := range wb.ops {
+		if op.deleted {
+			if _, ok := b.keydir.Get(op.key); !ok {
+				continue
+			}
+			entries = append(entries, &internal.Entry{Type: internal.TypeDeleted, Tstamp: tstamp, Key: op.key})
+			ptrs = append(ptrs, nil)
+			values = append(values, nil)
+			continue
+		}
+
+		e, ptr, err := b.valueEntry(op.key, op.value, tstamp)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		ptrs = append(ptrs, ptr)
+		values = append(values, op.value)
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	kes, err := b.appendBatch(entries)
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		var (
+			old *internal.KeydirEntry
+			ok  bool
+		)
+		if e.Type == internal.TypeDeleted {
+			old, ok = b.keydir.Delete(e.Key)
+		} else {
+			kes[i].Blob = ptrs[i]
+			old, ok = b.keydir.Put(e.Key, kes[i])
+		}
+		if ok {
+			b.blobs.release(e.Key, old)
+		}
+	}
+
+	for i, e := range entries {
+		op := OpPut
+		if e.Type == internal.TypeDeleted {
+			op = OpDelete
+		}
+		b.watch.publish(op, e.Key, values[i], kes[i])
+	}
+	return nil
+}
+
+// appendBatch 将 entries 连同开始和提交标记连续写入活跃文件, 返回每条记录的元信息
+//
+// 批次不会跨越数据文件, 写入失败时截断已写入的部分
+func (b *Bitcask) appendBatch(entries []*internal.Entry) ([]*internal.KeydirEntry, error) {
+	tstamp := entries[0].Tstamp
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, uint32(len(entries)))
+
+	for _, e := range entries {
+		e.Seq = b.nextSeq()
+	}
+	all := make([]*internal.Entry, 0, len(entries)+2)
+	all = append(all, &internal.Entry{Type: internal.TypeBatch, Tstamp: tstamp})
+	all = append(all, entries...)
+	all = append(all, &internal.Entry{Type: internal.TypeCommit, Tstamp: tstamp, Val: count})
+
+	active, err := b.activeFile()
+	if err != nil {
+		return nil, err
+	}
+
+	encode := func() ([][]byte, int64) {
+		recs := make([][]byte, len(all))
+		var size int64
+		for i, e := range all {
+			recs[i] = active.Codec().EncodeEntry(e)
+			size += int64(len(recs[i]))
+		}
+		return recs, size
+	}
+
+	recs, size := encode()
+	if !active.Empty() && active.Size()+size > b.options.MaxFileSize {
+		if active, err = b.rotate(); err != nil {
+			return nil, err
+		}
+		recs, _ = encode()
+	}
+
+	start := active.Size()
+	kes := make([]*internal.KeydirEntry, len(entries))
+	for i, rec := range recs {
+		pos, err := active.Write(rec)
+		if err != nil {
+			_ = active.Truncate(start)
+			return nil, err
+		}
+		if i > 0 && i <= len(entries) {
+			e := entries[i-1]
+			kes[i-1] = newKeydirEntry(active.ID(), e, pos, uint32(len(rec)), uint32(len(e.Val)))
+			b.observeSeq(active.ID(), e.Seq)
+		}
+	}
+
+	if b.options.SyncOnWrite {
+		if err := active.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	return kes, nil
+}
+
+// pendingBatch 加载时尚未读到提交标记的批次
+type pendingBatch struct {
+	entries []*internal.Entry
+	keydir  []*internal.KeydirEntry
+}
+
+func (pb *pendingBatch) add(e *internal.Entry, entry *internal.KeydirEntry) {
+	pb.entries = append(pb.entries, e)
+	pb.keydir = append(pb.keydir, entry)
+}
+
+// committed 判断提交标记是否与已读到的记录数一致
+func (pb *pendingBatch) committed(commit *internal.Entry) bool {
+	return commitCount(commit) == len(pb.entries)
+}
+
+// commitCount 返回提交标记中记录的批次大小, 格式错误时返回 -1
+func commitCount(commit *internal.Entry) int {
+	if len(commit.Val) != 4 {
+		return -1
+	}
+	return int(binary.BigEndian.Uint32(commit.Val))
+}
@@ -0,0 +1,102 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitcask_WriteBatch(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := Open(dir, WithBlobThreshold(64))
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("old"), []byte("v")))
+
+	wb := NewBatch()
+	require.NoError(t, wb.Put([]byte("a"), []byte("1")))
+	require.NoError(t, wb.Put([]byte("a"), []byte("2")))
+	require.NoError(t, wb.Put([]byte("big"), make([]byte, 128)))
+	require.NoError(t, wb.Delete([]byte("old")))
+	assert.Equal(t, 3, wb.Len(), "Repeated keys should be collapsed")
+	require.NoError(t, b.WriteBatch(wb))
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir)
+	val, err := b.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), val)
+
+	val, err = b.Get([]byte("big"))
+	require.NoError(t, err)
+	assert.Len(t, val, 128)
+
+	_, err = b.Get([]byte("old"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestBitcask_WriteBatchTorn(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("k"), []byte("v0")))
+
+	wb := NewBatch()
+	require.NoError(t, wb.Put([]byte("k"), []byte("v1")))
+	require.NoError(t, wb.Put([]byte("k2"), []byte("v2")))
+	require.NoError(t, b.WriteBatch(wb))
+	require.NoError(t, b.Close())
+
+	// 截掉提交标记: | crc(4) | tstamp(8) | ksz(4) | vsz(4) | count(4) |
+	path := filepath.Join(dir, "000000001.data")
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, fi.Size()-24))
+
+	b = openTestBitcask(t, dir)
+	val, err := b.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v0"), val, "Uncommitted batch should be discarded")
+
+	_, err = b.Get([]byte("k2"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestMerge_TornBatch(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("k"), []byte("v")))
+
+	wb := NewBatch()
+	require.NoError(t, wb.Put([]byte("k2"), []byte("v2")))
+	require.NoError(t, wb.Delete([]byte("k")))
+	require.NoError(t, b.WriteBatch(wb))
+	require.NoError(t, b.Close())
+
+	path := filepath.Join(dir, "000000001.data")
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, fi.Size()-24))
+
+	// 未提交批次中的墓碑不能在合并后变为独立的记录
+	b, err = Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Merge())
+	val, err := b.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir)
+	val, err = b.Get([]byte("k"))
+	require.NoError(t, err, "Torn batch should stay discarded after merge and reopen")
+	assert.Equal(t, []byte("v"), val)
+	_, err = b.Get([]byte("k2"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
@@ -1,95 +1,658 @@
 package bitcask
 
 import (
+	"bytes"
+	"math"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/chhz0/bitcask/internal/fileio"
 )
 
 type Bitcask struct {
 	rw        sync.RWMutex // rw lock
 	options   *Options
 	isMerging bool
+	closed    bool
+
+	lock   *fileio.Lock
+	keydir *internal.Keydir
+	files  map[uint32]*datafile.DataFile // 所有数据文件, 包括活跃文件
+	active *datafile.DataFile            // 活跃文件, 在第一次写入时创建
+	maxID  uint32
+	blobs  *blobStore
+	seq    uint64            // 最后分配的序列号
+	seqs   map[uint32]uint64 // 每个数据文件中记录的最大序列号
+
+	snapshots map[*Snapshot]struct{} // 未释放的快照
+	watch     *watchHub
+	floor     uint64        // CDC 消费者已确认的序列号
+	replBatch *pendingBatch // 副本上尚未提交的批次
 }
 
 // Open 打开或者创建 Bitcask, 支持读写 写入同步等
-// 仅支持单线程
+// 同一目录仅允许一个进程以读写模式打开
 func Open(dir string, opts ...Option) (*Bitcask, error) {
 	o := &Options{
 		Dir:         dir,
 		MaxFileSize: 1 << 30, // 1GB
 		SyncOnWrite: false,
 		ReadOnly:    false,
+		BlobGCRatio: 0.5,
 	}
 
 	for _, opt := range opts {
 		opt(o)
 	}
+	if o.MaxFileSize <= 0 || o.MaxFileSize > math.MaxUint32 {
+		return nil, ErrInvalidFileSize
+	}
 
-	// check config file && options
-	// if config file no exists, create a new  default config file
-	if err := checkOrMKdir(dir); err != nil {
-		return nil, ErrCheckOrMkdir
+	// 只读模式不创建目录, 也不在目录中写入任何文件
+	if !o.ReadOnly {
+		// check config file && options
+		// if config file no exists, create a new  default config file
+		if err := checkOrMKdir(dir); err != nil {
+			return nil, ErrCheckOrMkdir
+		}
 	}
 
 	// create a new bitcask instance
 	bitcask := &Bitcask{
 		rw:      sync.RWMutex{},
 		options: o,
+		keydir:  internal.NewKeydir(),
+		files:   make(map[uint32]*datafile.DataFile),
+		seqs:    make(map[uint32]uint64),
+
+		snapshots: make(map[*Snapshot]struct{}),
+		watch:     newWatchHub(),
 	}
 
 	// try to get file lock
+	// 读写模式持有排他锁, 只读模式持有共享锁, 多个只读实例可以同时打开, 但与读写实例互斥
+	bitcask.lock = fileio.NewLock(dir)
+	if o.ReadOnly {
+		if err := bitcask.lock.TryRLock(); err != nil {
+			if os.IsNotExist(err) {
+				return nil, err
+			}
+			return nil, ErrDirLocked
+		}
 
-	// loadavtivefile
+		// 未完成的合并或修复需要以读写模式打开才能完成
+		if pendingRecovery(dir) {
+			_ = bitcask.lock.UnLock()
+			return nil, ErrRecoveryPending
+		}
+	} else {
+		if err := bitcask.lock.TryLock(); err != nil {
+			return nil, ErrDirLocked
+		}
+
+		if err := recoverMerge(dir); err != nil {
+			_ = bitcask.lock.UnLock()
+			return nil, err
+		}
+		if err := recoverRepair(dir); err != nil {
+			_ = bitcask.lock.UnLock()
+			return nil, err
+		}
+		if err := removeStreamTmp(dir); err != nil {
+			_ = bitcask.lock.UnLock()
+			return nil, err
+		}
+	}
 
 	// loadKeydir
+	var err error
+	if bitcask.floor, err = readFloor(dir); err != nil {
+		_ = bitcask.lock.UnLock()
+		return nil, err
+	}
+	if err := bitcask.load(); err != nil {
+		_ = bitcask.closeFiles()
+		_ = bitcask.lock.UnLock()
+		return nil, err
+	}
 
 	return bitcask, nil
 }
 
-// OpenReadOnly 以只读模式打开 Bitcask
-func OpenReadOnly(dir string) *Bitcask {
+// OpenReadOnly 以只读模式打开 Bitcask, 目录必须已经存在
+func OpenReadOnly(dir string, opts ...Option) (*Bitcask, error) {
+	return Open(dir, append(opts, WithReadOnly(true))...)
+}
+
+// load 按文件 id 顺序加载数据文件并重建 keydir, 存在 hint 文件时优先使用 hint 文件
+func (b *Bitcask) load() error {
+	ids, err := datafile.List(b.options.Dir, datafile.DataExt)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		df, err := openDataFile(b.options, datafile.Name(b.options.Dir, id, datafile.DataExt), id, b.newFileHeader())
+		if err != nil {
+			return err
+		}
+		b.files[id] = df
+		b.maxID = id
+
+		hintPath := datafile.Name(b.options.Dir, id, datafile.HintExt)
+		if _, serr := os.Stat(hintPath); serr == nil {
+			var seq uint64
+			seq, err = loadHint(hintPath, id, b.keydir)
+			b.observeSeq(id, seq)
+		} else {
+			err = b.loadDataFile(df)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	b.blobs, err = openBlobStore(b.options)
+	if err != nil {
+		return err
+	}
+	b.blobs.account(b.keydir)
+
+	return nil
+}
+
+// openDataFile 打开已经存在的数据文件或 blob 文件, 只读模式下不写入文件
+func openDataFile(o *Options, path string, id uint32, hdr codec.FileHeader) (*datafile.DataFile, error) {
+	if o.ReadOnly {
+		return datafile.OpenReadOnly(path, id, hdr)
+	}
+	return datafile.Open(path, id, hdr)
+}
+
+// loadDataFile 扫描数据文件重建 keydir, 批次中的记录在读到提交标记后才生效
+func (b *Bitcask) loadDataFile(df *datafile.DataFile) error {
+	var batch *pendingBatch
+	return df.Scan(func(e *internal.Entry, pos int64, size uint32) error {
+		return b.replay(&batch, df.ID(), e, pos, size)
+	})
+}
+
+// replay 将数据文件中的一条记录应用到 keydir, batch 保存当前未提交的批次
+func (b *Bitcask) replay(batch **pendingBatch, id uint32, e *internal.Entry, pos int64, size uint32) error {
+	entry := newKeydirEntry(id, e, pos, size, uint32(len(e.Val)))
+	b.observeSeq(id, e.Seq)
+
+	switch {
+	case e.Type == internal.TypeBatch:
+		*batch = &pendingBatch{}
+	case e.Type == internal.TypeCommit:
+		pb := *batch
+		*batch = nil
+		if pb != nil && pb.committed(e) {
+			for i := range pb.entries {
+				if err := b.loadEntry(pb.entries[i], pb.keydir[i]); err != nil {
+					return err
+				}
+			}
+		}
+	case *batch != nil:
+		(*batch).add(e, entry)
+	default:
+		return b.loadEntry(e, entry)
+	}
+	return nil
+}
+
+func (b *Bitcask) loadEntry(e *internal.Entry, entry *internal.KeydirEntry) error {
+	if e.Type == internal.TypeDeleted {
+		b.keydir.Delete(e.Key)
+		return nil
+	}
+
+	if e.Type == internal.TypeBlobPointer {
+		ptr, err := decodeBlobPointer(e.Val)
+		if err != nil {
+			return err
+		}
+		entry.Blob = ptr
+	}
+
+	b.keydir.Put(e.Key, entry)
 	return nil
 }
 
 // Put Stores a key and a value in the bitcask datastore
-func (b *Bitcask) Put(key []byte, value []byte) bool {
-	return true
+func (b *Bitcask) Put(key []byte, value []byte) error {
+	if err := checkKeyValue(key, value); err != nil {
+		return err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+
+	return b.put(key, value, 0)
+}
+
+// put 写入 key/value, expiry 为过期时间 (Unix 毫秒), 0 表示不过期
+func (b *Bitcask) put(key, value []byte, expiry int64) error {
+	e, ptr, err := b.valueEntry(key, value, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	e.Expiry = expiry
+
+	entry, err := b.writeEntry(e)
+	if err != nil {
+		return err
+	}
+	entry.Blob = ptr
+
+	// keydir 持有键, 复制一份避免调用方之后修改
+	if old, ok := b.keydir.Put(bytes.Clone(key), entry); ok {
+		b.blobs.release(key, old)
+	}
+	b.watch.publish(OpPut, key, value, entry)
+	return nil
+}
+
+// valueEntry 构造写入 key/value 的记录, 按配置对值分块, 大值先写入 blob 文件
+// 返回的记录为指针记录时, 同时返回 blob 指针
+func (b *Bitcask) valueEntry(key, value []byte, tstamp int64) (*internal.Entry, *internal.BlobPointer, error) {
+	typ := internal.TypeNormal
+	if b.options.ChunkChecksum && len(value) > chunkSize {
+		typ = internal.TypeChunked
+		value = encodeChunked(value)
+	}
+
+	e := &internal.Entry{Type: typ, Tstamp: tstamp, Key: key, Val: value}
+	if b.options.BlobThreshold <= 0 || int64(len(value)) < b.options.BlobThreshold {
+		return e, nil, nil
+	}
+
+	ptr, err := b.blobs.write(typ, key, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.Type, e.Val = internal.TypeBlobPointer, encodeBlobPointer(ptr)
+	return e, ptr, nil
 }
 
 // Get Reads a value by key from a datastore
-func (b *Bitcask) Get(key []byte) (bool, []byte) {
-	return true, nil
+func (b *Bitcask) Get(key []byte) ([]byte, error) {
+	val, expired, err := b.get(key)
+	if expired != nil {
+		b.reap(key, expired)
+	}
+	return val, err
+}
+
+// get 读取 key 的值, key 已过期时返回 ErrKeyNotFound 以及过期的元信息
+func (b *Bitcask) get(key []byte) ([]byte, *internal.KeydirEntry, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, nil, ErrClosed
+	}
+
+	entry, ok := b.keydir.Get(key)
+	if !ok {
+		return nil, nil, ErrKeyNotFound
+	}
+	if entry.Expired(time.Now().UnixMilli()) {
+		return nil, entry, ErrKeyNotFound
+	}
+
+	val, err := b.readValue(key, entry)
+	return val, nil, err
+}
+
+// lookup 返回 kd 中 key 的元信息, 已过期的键视为不存在
+func lookup(kd *internal.Keydir, key []byte) (*internal.KeydirEntry, bool) {
+	entry, ok := kd.Get(key)
+	if !ok || entry.Expired(time.Now().UnixMilli()) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Has 判断 key 是否存在, 不读取值
+func (b *Bitcask) Has(key []byte) (bool, error) {
+	ok, expired, err := b.has(key)
+	if expired != nil {
+		b.reap(key, expired)
+	}
+	return ok, err
+}
+
+func (b *Bitcask) has(key []byte) (bool, *internal.KeydirEntry, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return false, nil, ErrClosed
+	}
+
+	entry, ok := b.keydir.Get(key)
+	if ok && entry.Expired(time.Now().UnixMilli()) {
+		return false, entry, nil
+	}
+	return ok, nil, nil
+}
+
+func (b *Bitcask) readValue(key []byte, entry *internal.KeydirEntry) ([]byte, error) {
+	if entry.Counter {
+		return b.readCounter(entry)
+	}
+
+	var (
+		val     []byte
+		chunked bool
+	)
+	if entry.Blob != nil {
+		v, err := b.blobs.read(key, entry.Blob)
+		if err != nil {
+			return nil, err
+		}
+		val, chunked = v, entry.Blob.Chunked
+	} else {
+		df, ok := b.files[entry.FileID]
+		if !ok {
+			return nil, ErrDataFileNotFound
+		}
+
+		e, err := df.Read(entry.RecordPos, entry.RecordSz)
+		if err != nil {
+			return nil, err
+		}
+		val, chunked = e.Val, entry.Chunked
+	}
+
+	if chunked {
+		return decodeChunked(val)
+	}
+	return val, nil
 }
 
 // Delete Removes a key from the datastore
-func (b *Bitcask) Delete(key []byte) bool {
-	return true
+func (b *Bitcask) Delete(key []byte) error {
+	if err := checkKeyValue(key, nil); err != nil {
+		return err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+
+	return b.delete(key)
+}
+
+func (b *Bitcask) delete(key []byte) error {
+	old, ok := b.keydir.Get(key)
+	if !ok {
+		return nil
+	}
+
+	entry, err := b.writeRecord(internal.TypeDeleted, key, nil)
+	if err != nil {
+		return err
+	}
+
+	b.keydir.Delete(key)
+	b.blobs.release(key, old)
+	b.watch.publish(OpDelete, key, nil, entry)
+	return nil
+}
+
+// writeRecord 将记录追加到活跃文件, 时间戳为当前时间
+func (b *Bitcask) writeRecord(typ internal.RecordType, key, val []byte) (*internal.KeydirEntry, error) {
+	return b.writeEntry(&internal.Entry{
+		Type:   typ,
+		Tstamp: time.Now().Unix(),
+		Key:    key,
+		Val:    val,
+	})
+}
+
+// writeEntry 将记录追加到活跃文件, 活跃文件达到 MaxFileSize 时先轮转
+//
+// e.Seq 为 0 时分配新的序列号, 否则保留原有的序列号, 用于移动记录的场景
+func (b *Bitcask) writeEntry(e *internal.Entry) (*internal.KeydirEntry, error) {
+	active, err := b.activeFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Seq == 0 {
+		e.Seq = b.nextSeq()
+	}
+
+	rec := active.Codec().EncodeEntry(e)
+	if !active.Empty() && active.Size()+int64(len(rec)) > b.options.MaxFileSize {
+		if active, err = b.rotate(); err != nil {
+			return nil, err
+		}
+		rec = active.Codec().EncodeEntry(e)
+	}
+
+	pos, err := active.Write(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.options.SyncOnWrite {
+		if err := active.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	b.observeSeq(active.ID(), e.Seq)
+	return newKeydirEntry(active.ID(), e, pos, uint32(len(rec)), uint32(len(e.Val))), nil
+}
+
+// nextSeq 分配新的序列号, 调用方需持有写锁
+//
+// 序列号随写入单调递增, 合并和 blob 回收移动记录时保留原有的序列号
+func (b *Bitcask) nextSeq() uint64 {
+	b.seq++
+	return b.seq
+}
+
+// observeSeq 记录数据文件 id 中出现的序列号
+func (b *Bitcask) observeSeq(id uint32, seq uint64) {
+	b.seq = max(b.seq, seq)
+	b.seqs[id] = max(b.seqs[id], seq)
+}
+
+// newKeydirEntry 根据记录 e 的位置构造 keydir 元信息, 值位于记录的末尾
+func newKeydirEntry(id uint32, e *internal.Entry, pos int64, recSz, valSz uint32) *internal.KeydirEntry {
+	return &internal.KeydirEntry{
+		FileID:    id,
+		RecordPos: pos,
+		RecordSz:  recSz,
+		ValuePos:  pos + int64(recSz-valSz),
+		ValueSz:   valSz,
+		Tstamp:    e.Tstamp,
+		Seq:       e.Seq,
+		Expiry:    e.Expiry,
+		Chunked:   e.Type == internal.TypeChunked,
+		Counter:   e.Type == internal.TypeCounter,
+	}
+}
+
+func (b *Bitcask) activeFile() (*datafile.DataFile, error) {
+	if b.active != nil {
+		return b.active, nil
+	}
+	return b.rotate()
+}
+
+// rotate 关闭当前活跃文件的写入, 并创建新的活跃文件
+func (b *Bitcask) rotate() (*datafile.DataFile, error) {
+	if b.active != nil {
+		if err := b.active.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	id := b.maxID + 1
+	df, err := datafile.Open(datafile.Name(b.options.Dir, id, datafile.DataExt), id, b.newFileHeader())
+	if err != nil {
+		return nil, err
+	}
+
+	b.files[id] = df
+	b.maxID = id
+	b.active = df
+	return df, nil
+}
+
+func (b *Bitcask) newFileHeader() codec.FileHeader {
+	return codec.NewFileHeader(b.options.Checksum, b.options.RecordFormat)
+}
+
+func (b *Bitcask) checkWritable() error {
+	if b.closed {
+		return ErrClosed
+	}
+	if b.options.ReadOnly || b.options.replica {
+		return ErrReadOnly
+	}
+	return nil
 }
 
 // Close a bitcask data store and flushes all pending writes to disk
 func (b *Bitcask) Close() error {
-	return nil
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	clear(b.snapshots)
+	b.watch.close()
+
+	err := b.closeFiles()
+	if uerr := b.lock.UnLock(); err == nil {
+		err = uerr
+	}
+	return err
 }
 
-// ListKey Returns list of all keys
+func (b *Bitcask) closeFiles() error {
+	var err error
+	for _, df := range b.files {
+		if cerr := df.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if b.blobs != nil {
+		if cerr := b.blobs.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ListKey Returns copies of all keys
 func (b *Bitcask) ListKeys() ([][]byte, error) {
-	return nil, nil
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	return listKeys(b.keydir), nil
+}
+
+func listKeys(kd *internal.Keydir) [][]byte {
+	now := time.Now().UnixMilli()
+	keys := make([][]byte, 0, kd.Len())
+	kd.Ascend(func(key []byte, entry *internal.KeydirEntry) bool {
+		if !entry.Expired(now) {
+			keys = append(keys, bytes.Clone(key))
+		}
+		return true
+	})
+	return keys
 }
 
 // Sync Force any writes to sync to disk
 func (b *Bitcask) Sync() error {
-	return nil
-}
+	b.rw.Lock()
+	defer b.rw.Unlock()
 
-// Merge Merge several data files within a Bitcask datastore into a more compact form.
-// Also, produce hintfiles for faster startup.
-func (b *Bitcask) Merge() error {
-	return nil
+	if b.closed {
+		return ErrClosed
+	}
+
+	if b.options.replica {
+		return b.syncReplica()
+	}
+
+	if b.active != nil {
+		if err := b.active.Sync(); err != nil {
+			return err
+		}
+	}
+	return b.blobs.sync()
 }
 
 // Fold over all K/V pairs in a Bitcask datastore.
 // → Acc Fun is expected to be of the form: F(K,V,Acc0) → Acc
-func (b *Bitcask) Fold(fn func([]byte, []byte, any) any, acc any) any {
+// fn 执行期间持有读锁, 不能在 fn 中写入
+func (b *Bitcask) Fold(fn func([]byte, []byte, any) any, acc any) (any, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return acc, ErrClosed
+	}
+
+	return b.fold(b.keydir, fn, acc)
+}
+
+func (b *Bitcask) fold(kd *internal.Keydir, fn func([]byte, []byte, any) any, acc any) (any, error) {
+	var err error
+	now := time.Now().UnixMilli()
+	kd.Ascend(func(key []byte, entry *internal.KeydirEntry) bool {
+		if entry.Expired(now) {
+			return true
+		}
+		var val []byte
+		if val, err = b.readValue(key, entry); err != nil {
+			return false
+		}
+		acc = fn(key, val, acc)
+		return true
+	})
+	return acc, err
+}
+
+func checkKeyValue(key, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyEmpty
+	}
+	if len(key) > codec.MaxKeySize {
+		return ErrKeyTooLarge
+	}
+	if uint64(len(value)) > math.MaxUint32 {
+		return ErrValueTooLarge
+	}
 	return nil
 }
 
@@ -104,3 +667,16 @@ func checkOrMKdir(dir string) error {
 
 	return nil
 }
+
+// pendingRecovery 判断目录中是否有已经提交但还没有完成文件替换的合并或修复
+func pendingRecovery(dir string) bool {
+	for _, fin := range []string{
+		filepath.Join(dir, mergeDirName, mergeFinName),
+		filepath.Join(dir, repairDirName, repairFinName),
+	} {
+		if _, err := os.Stat(fin); err == nil {
+			return true
+		}
+	}
+	return false
+}
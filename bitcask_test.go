@@ -0,0 +1,197 @@
+package bitcask
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestBitcask(t *testing.T, dir string, opts ...Option) *Bitcask {
+	t.Helper()
+
+	b, err := Open(dir, opts...)
+	require.NoError(t, err, "Open should not return errors")
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+func TestBitcask_PutGetDelete(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+
+	require.NoError(t, b.Put([]byte("k1"), []byte("v1")))
+	require.NoError(t, b.Put([]byte("k2"), []byte("")))
+
+	val, err := b.Get([]byte("k1"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v1"), val, "Value does not match")
+
+	val, err = b.Get([]byte("k2"))
+	require.NoError(t, err, "Empty value is not a tombstone")
+	assert.Empty(t, val)
+
+	require.NoError(t, b.Put([]byte("k1"), []byte("v1-new")))
+	val, err = b.Get([]byte("k1"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v1-new"), val, "Value should be overwritten")
+
+	require.NoError(t, b.Delete([]byte("k1")))
+	_, err = b.Get([]byte("k1"))
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Deleted key should not be found")
+
+	assert.ErrorIs(t, b.Put(nil, []byte("v")), ErrKeyEmpty)
+}
+
+func TestBitcask_KeyCopied(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir(), WithCompactCounter(true))
+
+	// 写入后修改调用方的缓冲区, 不能影响已经写入的键
+	buf := []byte("k1")
+	require.NoError(t, b.Put(buf, []byte("v1")))
+	copy(buf, "k2")
+	require.NoError(t, b.PutStream(buf, strings.NewReader("v2"), 2))
+	copy(buf, "k3")
+	_, err := b.Incr(buf, 3)
+	require.NoError(t, err)
+	copy(buf, "zz")
+
+	keys, err := b.ListKeys()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("k1"), []byte("k2"), []byte("k3")}, keys)
+	for key, want := range map[string]string{"k1": "v1", "k2": "v2", "k3": "3"} {
+		val, err := b.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(val))
+	}
+}
+
+func TestBitcask_Reopen(t *testing.T) {
+	for _, f := range []RecordFormat{FormatFixed, FormatCompact} {
+		t.Run(f.String(), func(t *testing.T) {
+			dir := t.TempDir()
+
+			b, err := Open(dir, WithMaxFileSize(256), WithRecordFormat(f), WithChecksum(ChecksumCastagnoli))
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("val-%d", i))))
+			}
+			for i := 0; i < 100; i += 2 {
+				require.NoError(t, b.Delete([]byte(fmt.Sprintf("key-%03d", i))))
+			}
+			require.NoError(t, b.Close())
+
+			b = openTestBitcask(t, dir)
+			keys, err := b.ListKeys()
+			require.NoError(t, err)
+			assert.Len(t, keys, 50, "Deleted keys should not be loaded")
+
+			for i := 1; i < 100; i += 2 {
+				val, err := b.Get([]byte(fmt.Sprintf("key-%03d", i)))
+				require.NoError(t, err)
+				assert.Equal(t, []byte(fmt.Sprintf("val-%d", i)), val)
+			}
+		})
+	}
+}
+
+func TestBitcask_Lock(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("k"), []byte("v")))
+
+	_, err = Open(dir)
+	assert.ErrorIs(t, err, ErrDirLocked, "Second writer should be rejected")
+	_, err = OpenReadOnly(dir)
+	assert.ErrorIs(t, err, ErrDirLocked, "Reader should be rejected while a writer holds the lock")
+	require.NoError(t, b.Close())
+
+	ro, err := OpenReadOnly(dir)
+	require.NoError(t, err)
+	defer ro.Close()
+	ro2, err := OpenReadOnly(dir)
+	require.NoError(t, err, "Readers should share the lock")
+	require.NoError(t, ro2.Close())
+
+	_, err = Open(dir)
+	assert.ErrorIs(t, err, ErrDirLocked, "Writer should be rejected while a reader holds the lock")
+
+	val, err := ro.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+	assert.ErrorIs(t, ro.Put([]byte("k"), []byte("v")), ErrReadOnly)
+}
+
+func TestBitcask_InvalidFileSize(t *testing.T) {
+	for _, size := range []int64{0, -1, math.MaxUint32 + 1} {
+		_, err := Open(t.TempDir(), WithMaxFileSize(size))
+		assert.ErrorIs(t, err, ErrInvalidFileSize, "size %d", size)
+	}
+
+	b, err := Open(t.TempDir(), WithMaxFileSize(math.MaxUint32))
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+}
+
+func TestBitcask_ReadOnlyNoWrites(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("k"), []byte("v")))
+	require.NoError(t, b.Close())
+
+	// 崩溃后留下的空数据文件
+	empty := datafile.Name(dir, 9, datafile.DataExt)
+	require.NoError(t, os.WriteFile(empty, nil, 0o644))
+
+	list := func() map[string]int64 {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		files := make(map[string]int64)
+		for _, e := range entries {
+			fi, err := e.Info()
+			require.NoError(t, err)
+			files[e.Name()] = fi.Size()
+		}
+		return files
+	}
+	before := list()
+
+	ro, err := OpenReadOnly(dir)
+	require.NoError(t, err)
+	val, err := ro.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+	require.NoError(t, ro.Close())
+	assert.Equal(t, before, list(), "Read-only open should not create or modify files")
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err = OpenReadOnly(missing)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoDirExists(t, missing)
+
+	// 已提交但未完成的合并只能由读写模式完成
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, mergeDirName), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, mergeDirName, mergeFinName), nil, 0o644))
+	_, err = OpenReadOnly(dir)
+	assert.ErrorIs(t, err, ErrRecoveryPending)
+}
+
+func TestBitcask_Fold(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+	for _, k := range []string{"c", "a", "b"} {
+		require.NoError(t, b.Put([]byte(k), []byte(k+k)))
+	}
+
+	acc, err := b.Fold(func(k, v []byte, acc any) any {
+		return acc.(string) + string(k) + "=" + string(v) + ";"
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "a=aa;b=bb;c=cc;", acc, "Fold should visit keys in order")
+}
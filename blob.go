@@ -0,0 +1,326 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+// blob 指针编码: | file_id | offset | size | flags |
+const (
+	blobPointerSize = 4 + 8 + 4 + 1
+
+	blobFlagChunked = 1 << 0
+)
+
+func encodeBlobPointer(ptr *internal.BlobPointer) []byte {
+	buf := make([]byte, blobPointerSize)
+	binary.BigEndian.PutUint32(buf[0:4], ptr.FileID)
+	binary.BigEndian.PutUint64(buf[4:12], uint64(ptr.Offset))
+	binary.BigEndian.PutUint32(buf[12:16], ptr.Size)
+	if ptr.Chunked {
+		buf[16] |= blobFlagChunked
+	}
+	return buf
+}
+
+func decodeBlobPointer(b []byte) (*internal.BlobPointer, error) {
+	if len(b) != blobPointerSize {
+		return nil, ErrInvalidBlobPtr
+	}
+	return &internal.BlobPointer{
+		FileID:  binary.BigEndian.Uint32(b[0:4]),
+		Offset:  int64(binary.BigEndian.Uint64(b[4:12])),
+		Size:    binary.BigEndian.Uint32(b[12:16]),
+		Chunked: b[16]&blobFlagChunked != 0,
+	}, nil
+}
+
+// blobStat blob 文件的数据统计, 字节数均不包含文件头
+type blobStat struct {
+	total int64
+	dead  int64
+}
+
+// blobStore 管理值分离存储的 blob 文件
+//
+// blob 文件与数据文件格式相同, 但记录固定使用 FormatFixed,
+// 因此可以根据值的位置和键的长度推算出整条记录的位置并校验
+type blobStore struct {
+	opts   *Options
+	files  map[uint32]*datafile.DataFile
+	stats  map[uint32]*blobStat
+	active *datafile.DataFile
+	maxID  uint32
+}
+
+func openBlobStore(opts *Options) (*blobStore, error) {
+	bs := &blobStore{
+		opts:  opts,
+		files: make(map[uint32]*datafile.DataFile),
+		stats: make(map[uint32]*blobStat),
+	}
+
+	ids, err := datafile.List(opts.Dir, datafile.BlobExt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		df, err := openDataFile(opts, datafile.Name(opts.Dir, id, datafile.BlobExt), id, bs.newFileHeader())
+		if err != nil {
+			_ = bs.close()
+			return nil, err
+		}
+		bs.files[id] = df
+		bs.stats[id] = &blobStat{total: df.Size() - codec.FileHeaderSize}
+		bs.maxID = id
+	}
+
+	return bs, nil
+}
+
+func (bs *blobStore) newFileHeader() codec.FileHeader {
+	return codec.NewFileHeader(bs.opts.Checksum, codec.FormatFixed)
+}
+
+// account 根据 keydir 计算各 blob 文件的失效数据量
+func (bs *blobStore) account(kd *internal.Keydir) {
+	live := make(map[uint32]int64, len(bs.stats))
+	kd.Ascend(func(key []byte, entry *internal.KeydirEntry) bool {
+		if entry.Blob != nil {
+			live[entry.Blob.FileID] += bs.recordSize(key, entry.Blob)
+		}
+		return true
+	})
+
+	for id, stat := range bs.stats {
+		stat.dead = stat.total - live[id]
+	}
+}
+
+func (bs *blobStore) recordSize(key []byte, ptr *internal.BlobPointer) int64 {
+	df, ok := bs.files[ptr.FileID]
+	if !ok {
+		return 0
+	}
+	return int64(df.Codec().HeaderSize()+len(key)) + int64(ptr.Size)
+}
+
+// write 将值写入活跃 blob 文件, 返回指向值的指针
+// typ 为 TypeChunked 时 val 为分块存储格式
+func (bs *blobStore) write(typ internal.RecordType, key, val []byte) (*internal.BlobPointer, error) {
+	active, err := bs.activeFile()
+	if err != nil {
+		return nil, err
+	}
+
+	rec := active.Codec().EncodeRecord(typ, key, val)
+	if !active.Empty() && active.Size()+int64(len(rec)) > bs.opts.MaxFileSize {
+		if active, err = bs.rotate(); err != nil {
+			return nil, err
+		}
+		rec = active.Codec().EncodeRecord(typ, key, val)
+	}
+
+	pos, err := active.Write(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先同步 blob 文件, 保证数据文件中的指针不会指向未落盘的数据
+	if bs.opts.SyncOnWrite {
+		if err := active.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	bs.stats[active.ID()].total += int64(len(rec))
+
+	return &internal.BlobPointer{
+		FileID:  active.ID(),
+		Offset:  pos + int64(len(rec)-len(val)),
+		Size:    uint32(len(val)),
+		Chunked: typ == internal.TypeChunked,
+	}, nil
+}
+
+// read 读取并校验 ptr 指向的值, 返回值在 blob 文件中的存储形式
+func (bs *blobStore) read(key []byte, ptr *internal.BlobPointer) ([]byte, error) {
+	df, ok := bs.files[ptr.FileID]
+	if !ok {
+		return nil, ErrDataFileNotFound
+	}
+
+	pos := ptr.Offset - int64(df.Codec().HeaderSize()+len(key))
+	if pos < codec.FileHeaderSize {
+		return nil, ErrInvalidBlobPtr
+	}
+
+	e, err := df.Read(pos, uint32(bs.recordSize(key, ptr)))
+	if err != nil {
+		return nil, err
+	}
+	return e.Val, nil
+}
+
+// release 在值被覆盖或删除后, 将其占用的空间计入失效数据
+func (bs *blobStore) release(key []byte, old *internal.KeydirEntry) {
+	if old == nil || old.Blob == nil {
+		return
+	}
+	if stat, ok := bs.stats[old.Blob.FileID]; ok {
+		stat.dead += bs.recordSize(key, old.Blob)
+	}
+}
+
+func (bs *blobStore) activeFile() (*datafile.DataFile, error) {
+	if bs.active != nil {
+		return bs.active, nil
+	}
+	return bs.rotate()
+}
+
+func (bs *blobStore) rotate() (*datafile.DataFile, error) {
+	if bs.active != nil {
+		if err := bs.active.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	id := bs.maxID + 1
+	df, err := datafile.Open(datafile.Name(bs.opts.Dir, id, datafile.BlobExt), id, bs.newFileHeader())
+	if err != nil {
+		return nil, err
+	}
+
+	bs.files[id] = df
+	bs.stats[id] = &blobStat{}
+	bs.maxID = id
+	bs.active = df
+	return df, nil
+}
+
+// candidates 返回失效数据占比达到 BlobGCRatio 的非活跃 blob 文件
+func (bs *blobStore) candidates() []uint32 {
+	var ids []uint32
+	for id, stat := range bs.stats {
+		if bs.active != nil && id == bs.active.ID() {
+			continue
+		}
+		if stat.total > 0 && float64(stat.dead) >= bs.opts.BlobGCRatio*float64(stat.total) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (bs *blobStore) remove(id uint32) error {
+	df, ok := bs.files[id]
+	if !ok {
+		return nil
+	}
+
+	delete(bs.files, id)
+	delete(bs.stats, id)
+	if err := df.Close(); err != nil {
+		return err
+	}
+	return os.Remove(df.Path())
+}
+
+func (bs *blobStore) sync() error {
+	if bs.active == nil {
+		return nil
+	}
+	return bs.active.Sync()
+}
+
+func (bs *blobStore) close() error {
+	var err error
+	for _, df := range bs.files {
+		if cerr := df.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// BlobGC 回收失效数据占比达到 BlobGCRatio 的 blob 文件
+//
+// 仍然有效的值被复制到活跃 blob 文件, 并在活跃数据文件中追加新的指针记录,
+// 指针落盘后再删除旧的 blob 文件. 回收期间持有写锁, 被快照引用的 blob 文件在快照释放前不会被回收
+func (b *Bitcask) BlobGC() error {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+
+	pinned, err := b.retainedBlobs()
+	if err != nil {
+		return err
+	}
+	for id := range b.snapshotBlobs() {
+		pinned[id] = true
+	}
+	for _, id := range b.blobs.candidates() {
+		if pinned[id] {
+			continue
+		}
+		if err := b.collectBlobFile(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bitcask) collectBlobFile(id uint32) error {
+	df := b.blobs.files[id]
+
+	err := df.Scan(func(e *internal.Entry, pos int64, size uint32) error {
+		entry, ok := b.keydir.Get(e.Key)
+		if !ok || entry.Blob == nil || entry.Blob.FileID != id ||
+			entry.Blob.Offset != pos+int64(size)-int64(len(e.Val)) {
+			return nil
+		}
+
+		ptr, err := b.blobs.write(e.Type, e.Key, e.Val)
+		if err != nil {
+			return err
+		}
+		moved, err := b.writeEntry(&internal.Entry{
+			Type:   internal.TypeBlobPointer,
+			Tstamp: entry.Tstamp,
+			Seq:    entry.Seq,
+			Expiry: entry.Expiry,
+			Key:    e.Key,
+			Val:    encodeBlobPointer(ptr),
+		})
+		if err != nil {
+			return err
+		}
+		moved.Blob = ptr
+
+		b.keydir.Put(e.Key, moved)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.blobs.sync(); err != nil {
+		return err
+	}
+	if b.active != nil {
+		if err := b.active.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return b.blobs.remove(id)
+}
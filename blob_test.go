@@ -0,0 +1,73 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlob_PutGet(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir, WithBlobThreshold(1024))
+	require.NoError(t, err)
+
+	large := bytes.Repeat([]byte("x"), 4096)
+	require.NoError(t, b.Put([]byte("large"), large))
+	require.NoError(t, b.Put([]byte("small"), []byte("v")))
+
+	assert.Less(t, dirSize(t, dir, datafile.DataExt), int64(len(large)),
+		"Large values should not be stored in data files")
+	assert.Greater(t, dirSize(t, dir, datafile.BlobExt), int64(len(large)))
+
+	require.NoError(t, b.Merge())
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir, WithBlobThreshold(1024))
+	val, err := b.Get([]byte("large"))
+	require.NoError(t, err)
+	assert.Equal(t, large, val)
+
+	val, err = b.Get([]byte("small"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+}
+
+func TestBlob_GC(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir, WithBlobThreshold(1024), WithMaxFileSize(16*1024), WithBlobGCRatio(0.5))
+	require.NoError(t, err)
+
+	value := func(i, round int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("%d-%d|", i, round)), 512)
+	}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%02d", i)), value(i, round)))
+		}
+	}
+	require.NoError(t, b.Delete([]byte("key-00")))
+
+	before := dirSize(t, dir, datafile.BlobExt)
+	require.NoError(t, b.BlobGC())
+	assert.Less(t, dirSize(t, dir, datafile.BlobExt), before, "BlobGC should reclaim dead values")
+
+	check := func(b *Bitcask) {
+		_, err := b.Get([]byte("key-00"))
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		for i := 1; i < 20; i++ {
+			val, err := b.Get([]byte(fmt.Sprintf("key-%02d", i)))
+			require.NoError(t, err)
+			assert.Equal(t, value(i, 2), val)
+		}
+	}
+
+	check(b)
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir, WithBlobThreshold(1024))
+	check(b)
+}
@@ -0,0 +1,171 @@
+package bitcask
+
+import (
+	"bytes"
+	"math"
+	"time"
+)
+
+// CompareAndSwap 当 key 的当前值等于 old 时写入 new, 返回条件是否成立
+//
+// key 不存在时条件不成立. 比较与写入在写锁内完成
+func (b *Bitcask) CompareAndSwap(key, old, new []byte) (bool, error) {
+	if err := checkKeyValue(key, new); err != nil {
+		return false, err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return false, err
+	}
+
+	ok, err := b.valueEquals(key, old)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, b.put(key, new, 0)
+}
+
+// PutIfAbsent 当 key 不存在时写入 val, 返回条件是否成立
+func (b *Bitcask) PutIfAbsent(key, val []byte) (bool, error) {
+	if err := checkKeyValue(key, val); err != nil {
+		return false, err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return false, err
+	}
+
+	if _, ok := lookup(b.keydir, key); ok {
+		return false, nil
+	}
+	return true, b.put(key, val, 0)
+}
+
+// DeleteIfEquals 当 key 的当前值等于 val 时删除 key, 返回条件是否成立
+func (b *Bitcask) DeleteIfEquals(key, val []byte) (bool, error) {
+	if err := checkKeyValue(key, nil); err != nil {
+		return false, err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return false, err
+	}
+
+	ok, err := b.valueEquals(key, val)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, b.delete(key)
+}
+
+// valueEquals 判断 key 的当前值是否等于 val, key 不存在时返回 false
+func (b *Bitcask) valueEquals(key, val []byte) (bool, error) {
+	entry, ok := lookup(b.keydir, key)
+	if !ok {
+		return false, nil
+	}
+
+	// 长度不同时无需读盘
+	if !entry.Chunked && !entry.Counter && entry.Blob == nil && int(entry.ValueSz) != len(val) {
+		return false, nil
+	}
+
+	cur, err := b.readValue(key, entry)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(cur, val), nil
+}
+
+// AnyVersion 作为 PutIfVersion 和 DeleteIfVersion 的条件时不检查当前版本
+const AnyVersion uint64 = math.MaxUint64
+
+// Version 返回 key 当前记录的版本号, key 不存在时返回 0
+//
+// 版本号为记录的序列号, 每次写入都会分配新的版本号, 合并和 blob 回收移动记录时版本号保持不变.
+// 序列号单调递增, 被覆盖或删除的版本号不会再次出现
+func (b *Bitcask) Version(key []byte) (uint64, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+
+	entry, ok := lookup(b.keydir, key)
+	if !ok {
+		return 0, nil
+	}
+	return entry.Seq, nil
+}
+
+// GetVersion 返回 key 的值和版本号
+func (b *Bitcask) GetVersion(key []byte) ([]byte, uint64, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, 0, ErrClosed
+	}
+
+	entry, ok := lookup(b.keydir, key)
+	if !ok {
+		return nil, 0, ErrKeyNotFound
+	}
+	val, err := b.readValue(key, entry)
+	if err != nil {
+		return nil, 0, err
+	}
+	return val, entry.Seq, nil
+}
+
+// PutIfVersion 当 key 的版本号等于 version 时写入 val, 返回新的版本号
+//
+// version 为 0 时要求 key 不存在, 为 AnyVersion 时无条件写入. 条件不成立时返回 ErrVersionMismatch
+func (b *Bitcask) PutIfVersion(key, val []byte, version uint64) (uint64, error) {
+	return b.PutIfVersionWithExpiry(key, val, version, time.Time{})
+}
+
+// DeleteIfVersion 当 key 的版本号等于 version 时删除 key
+//
+// key 不存在且 version 为 0 或 AnyVersion 时返回 ErrKeyNotFound
+func (b *Bitcask) DeleteIfVersion(key []byte, version uint64) error {
+	if err := checkKeyValue(key, nil); err != nil {
+		return err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+
+	if _, ok := lookup(b.keydir, key); !ok && (version == 0 || version == AnyVersion) {
+		return ErrKeyNotFound
+	}
+	if !b.versionEquals(key, version) {
+		return ErrVersionMismatch
+	}
+	return b.delete(key)
+}
+
+func (b *Bitcask) versionEquals(key []byte, version uint64) bool {
+	if version == AnyVersion {
+		return true
+	}
+	entry, ok := lookup(b.keydir, key)
+	if !ok {
+		return version == 0
+	}
+	return entry.Seq == version
+}
@@ -0,0 +1,136 @@
+package bitcask
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitcask_ConditionalWrites(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+	k := []byte("lock")
+
+	ok, err := b.CompareAndSwap(k, nil, []byte("a"))
+	require.NoError(t, err)
+	assert.False(t, ok, "CAS on absent key should fail")
+
+	ok, err = b.PutIfAbsent(k, []byte("a"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = b.PutIfAbsent(k, []byte("b"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = b.CompareAndSwap(k, []byte("x"), []byte("b"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = b.CompareAndSwap(k, []byte("a"), []byte("b"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = b.DeleteIfEquals(k, []byte("a"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = b.DeleteIfEquals(k, []byte("b"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = b.Get(k)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestBitcask_PutIfAbsentConcurrent(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		wins int
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := b.PutIfAbsent([]byte("leader"), []byte("me"))
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				wins++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, wins, "Only one writer should win")
+}
+
+func TestBitcask_VersionedWrites(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+	k := []byte("doc")
+
+	v, err := b.Version(k)
+	require.NoError(t, err)
+	assert.Zero(t, v)
+
+	v1, err := b.PutIfVersion(k, []byte("a"), 0)
+	require.NoError(t, err)
+	_, err = b.PutIfVersion(k, []byte("b"), 0)
+	assert.ErrorIs(t, err, ErrVersionMismatch, "key already exists")
+
+	val, cur, err := b.GetVersion(k)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(val))
+	assert.Equal(t, v1, cur)
+
+	v2, err := b.PutIfVersion(k, []byte("b"), v1)
+	require.NoError(t, err)
+	assert.NotEqual(t, v1, v2)
+	_, err = b.PutIfVersion(k, []byte("c"), v1)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	assert.ErrorIs(t, b.DeleteIfVersion(k, v1), ErrVersionMismatch)
+	require.NoError(t, b.DeleteIfVersion(k, v2))
+	assert.ErrorIs(t, b.DeleteIfVersion(k, AnyVersion), ErrKeyNotFound)
+	assert.ErrorIs(t, b.DeleteIfVersion(k, v2), ErrVersionMismatch)
+}
+
+func TestBitcask_VersionAfterMerge(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir, WithMaxFileSize(256))
+	require.NoError(t, err)
+	k := []byte("doc")
+
+	stale, err := b.PutIfVersion(k, []byte("a"), 0)
+	require.NoError(t, err)
+	cur, err := b.PutIfVersion(k, []byte("b"), stale)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte("v")))
+	}
+	require.NoError(t, b.Delete([]byte("key-19")))
+	last, err := b.Version([]byte("key-18"))
+	require.NoError(t, err)
+
+	require.NoError(t, b.Merge())
+	v, err := b.Version(k)
+	require.NoError(t, err)
+	assert.Equal(t, cur, v, "Merge should not change the version")
+	_, err = b.PutIfVersion(k, []byte("c"), stale)
+	assert.ErrorIs(t, err, ErrVersionMismatch, "Stale version should not match after merge")
+	require.NoError(t, b.Close())
+
+	// 合并删除了所有旧文件, 重新打开后也不能复用已分配的版本
+	b = openTestBitcask(t, dir)
+	v, err = b.Version(k)
+	require.NoError(t, err)
+	assert.Equal(t, cur, v)
+	next, err := b.PutIfVersion(k, []byte("c"), cur)
+	require.NoError(t, err)
+	assert.Greater(t, next, last+1, "New versions should follow the deleted key's version")
+}
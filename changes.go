@@ -0,0 +1,301 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+// floorFileName 保存 CDC 消费者已确认的序列号
+const floorFileName = "CHANGES_FLOOR"
+
+// ChangeIter 按日志顺序遍历已提交的变更, 直接从数据文件读取
+//
+// 迭代器只包含创建时已经写入的记录, 之后的变更使用 Token 重新调用 ChangesSince 获取.
+// blob 回收移动的记录保留原有的序列号, 序列号大于 since 时会再次返回.
+// 未开启 RetainChanges 时, 合并会改写旧数据文件, 无法保证旧位置之后的变更完整
+type ChangeIter struct {
+	db      *Bitcask
+	since   uint64
+	readers []*changeReader
+	batch   []Event // 尚未读到提交标记的批次
+	inBatch bool
+	queue   []Event
+	ev      Event
+	token   uint64
+	err     error
+}
+
+type changeReader struct {
+	id uint32
+	r  *datafile.Reader
+}
+
+// ChangesSince 返回序列号大于 seq 的变更, seq 为 0 时从头开始
+func (b *Bitcask) ChangesSince(seq uint64) (*ChangeIter, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	// 只读取包含更大序列号的数据文件
+	ids := make([]uint32, 0, len(b.files))
+	for id := range b.files {
+		if b.seqs[id] > seq {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	it := &ChangeIter{db: b, since: seq, token: seq}
+	for _, id := range ids {
+		df := b.files[id]
+		r, err := datafile.OpenReader(df.Path(), 0, df.Size())
+		if err != nil {
+			_ = it.Close()
+			return nil, err
+		}
+		it.readers = append(it.readers, &changeReader{id: id, r: r})
+	}
+	return it, nil
+}
+
+// Next 前进到下一条变更, 没有更多变更或出错时返回 false
+func (it *ChangeIter) Next() bool {
+	for it.err == nil {
+		if len(it.queue) > 0 {
+			it.ev, it.queue = it.queue[0], it.queue[1:]
+			it.token = max(it.token, it.ev.Seq)
+			return true
+		}
+		if len(it.readers) == 0 {
+			return false
+		}
+
+		cr := it.readers[0]
+		e, pos, err := cr.r.Next()
+		if errors.Is(err, io.EOF) {
+			// 批次不会跨越数据文件, 文件末尾未提交的批次被丢弃
+			_ = cr.r.Close()
+			it.readers = it.readers[1:]
+			it.batch, it.inBatch = nil, false
+			continue
+		}
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		seq := e.Seq
+		if !cr.r.Codec().HasSeq() {
+			seq = datafile.LegacySeq(cr.id, pos)
+		}
+		switch e.Type {
+		case internal.TypeBatch:
+			it.batch, it.inBatch = it.batch[:0], true
+		case internal.TypeCommit:
+			if it.inBatch && len(e.Val) == 4 && int(binary.BigEndian.Uint32(e.Val)) == len(it.batch) {
+				for _, ev := range it.batch {
+					it.push(ev)
+				}
+			}
+			it.batch, it.inBatch = nil, false
+		default:
+			ev, err := it.event(e, seq)
+			if err != nil {
+				it.err = err
+				return false
+			}
+			if it.inBatch {
+				it.batch = append(it.batch, ev)
+			} else {
+				it.push(ev)
+			}
+		}
+	}
+	return false
+}
+
+func (it *ChangeIter) push(ev Event) {
+	if ev.Seq > it.since {
+		it.queue = append(it.queue, ev)
+	}
+}
+
+// event 将记录转换为变更事件, 值按记录类型还原为用户写入的值
+func (it *ChangeIter) event(e *internal.Entry, seq uint64) (Event, error) {
+	ev := Event{Seq: seq, Op: OpPut, Key: e.Key}
+
+	var err error
+	switch e.Type {
+	case internal.TypeDeleted:
+		ev.Op = OpDelete
+	case internal.TypeChunked:
+		ev.Value, err = decodeChunked(e.Val)
+	case internal.TypeCounter:
+		if len(e.Val) != counterSize {
+			return ev, ErrNotCounter
+		}
+		ev.Value = strconv.AppendInt(nil, int64(binary.BigEndian.Uint64(e.Val)), 10)
+	case internal.TypeBlobPointer:
+		ev.Value, err = it.readBlob(e)
+	default:
+		ev.Value = e.Val
+	}
+	return ev, err
+}
+
+func (it *ChangeIter) readBlob(e *internal.Entry) ([]byte, error) {
+	ptr, err := decodeBlobPointer(e.Val)
+	if err != nil {
+		return nil, err
+	}
+
+	it.db.rw.RLock()
+	defer it.db.rw.RUnlock()
+
+	if it.db.closed {
+		return nil, ErrClosed
+	}
+	val, err := it.db.blobs.read(e.Key, ptr)
+	if err != nil || !ptr.Chunked {
+		return val, err
+	}
+	return decodeChunked(val)
+}
+
+// Change 返回当前变更
+func (it *ChangeIter) Change() Event {
+	return it.ev
+}
+
+// Token 返回已返回变更中最大的序列号, 传给 ChangesSince 可以从该位置之后继续
+func (it *ChangeIter) Token() uint64 {
+	return it.token
+}
+
+// Err 返回迭代过程中遇到的错误
+func (it *ChangeIter) Err() error {
+	return it.err
+}
+
+// Close 关闭迭代器打开的文件
+func (it *ChangeIter) Close() error {
+	var err error
+	for _, cr := range it.readers {
+		if cerr := cr.r.Close(); err == nil {
+			err = cerr
+		}
+	}
+	it.readers = nil
+	return err
+}
+
+// AckChanges 确认序列号不大于 seq 的变更已被消费
+//
+// 开启 RetainChanges 时, 合并只会改写其中的变更都已确认的数据文件,
+// blob 回收会跳过之后的记录引用的 blob 文件. 确认位置会持久化, 只能前进
+func (b *Bitcask) AckChanges(seq uint64) error {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	if seq <= b.floor {
+		return nil
+	}
+
+	if err := writeFloor(b.options.Dir, seq); err != nil {
+		return err
+	}
+	b.floor = seq
+	return nil
+}
+
+// floorFile 返回 CDC 需要保留的第一个数据文件, 未开启 RetainChanges 时不保留
+func (b *Bitcask) floorFile() uint32 {
+	floor := ^uint32(0)
+	if !b.options.RetainChanges {
+		return floor
+	}
+	for id, seq := range b.seqs {
+		if seq > b.floor {
+			floor = min(floor, id)
+		}
+	}
+	return floor
+}
+
+// retainedBlobs 返回 CDC 保留的数据文件中引用的 blob 文件
+func (b *Bitcask) retainedBlobs() (map[uint32]bool, error) {
+	ids := make(map[uint32]bool)
+	if !b.options.RetainChanges {
+		return ids, nil
+	}
+
+	for id, df := range b.files {
+		if id < b.floorFile() {
+			continue
+		}
+		err := df.Scan(func(e *internal.Entry, _ int64, _ uint32) error {
+			if e.Type != internal.TypeBlobPointer {
+				return nil
+			}
+			ptr, err := decodeBlobPointer(e.Val)
+			if err != nil {
+				return err
+			}
+			ids[ptr.FileID] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func readFloor(dir string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, floorFileName))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// writeFloor 先写临时文件再重命名, 保证崩溃后文件内容完整
+func writeFloor(dir string, seq uint64) error {
+	path := filepath.Join(dir, floorFileName)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strconv.FormatUint(seq, 10) + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,97 @@
+package bitcask
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectChanges(t *testing.T, b *Bitcask, seq uint64) ([]Event, uint64) {
+	t.Helper()
+
+	it, err := b.ChangesSince(seq)
+	require.NoError(t, err)
+	defer it.Close()
+
+	var evs []Event
+	for it.Next() {
+		evs = append(evs, it.Change())
+	}
+	require.NoError(t, it.Err())
+	return evs, it.Token()
+}
+
+func TestChangesSince(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir, WithBlobThreshold(64), WithCompactCounter(true))
+	require.NoError(t, err)
+
+	require.NoError(t, b.Put([]byte("a"), []byte("1")))
+	require.NoError(t, b.Put([]byte("big"), make([]byte, 100)))
+	_, err = b.Incr([]byte("n"), 3)
+	require.NoError(t, err)
+
+	evs, token := collectChanges(t, b, 0)
+	require.Len(t, evs, 3)
+	assert.Equal(t, []byte("1"), evs[0].Value)
+	assert.Len(t, evs[1].Value, 100, "Blob values should be resolved")
+	assert.Equal(t, []byte("3"), evs[2].Value)
+	assert.Equal(t, evs[2].Seq, token)
+
+	wb := NewBatch()
+	require.NoError(t, wb.Delete([]byte("a")))
+	require.NoError(t, wb.Put([]byte("b"), []byte("2")))
+	require.NoError(t, b.WriteBatch(wb))
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir)
+	evs, _ = collectChanges(t, b, token)
+	require.Len(t, evs, 2, "Resume should skip consumed changes")
+	assert.Equal(t, OpDelete, evs[0].Op)
+	assert.Equal(t, []byte("a"), evs[0].Key)
+	assert.Equal(t, []byte("b"), evs[1].Key)
+	assert.Greater(t, evs[0].Seq, token)
+}
+
+func TestChangesSince_RetentionFloor(t *testing.T) {
+	dir := t.TempDir()
+	b := openTestBitcask(t, dir, WithMaxFileSize(256), WithRetainChanges(true))
+
+	for i := 0; i < 40; i++ {
+		require.NoError(t, b.Put([]byte(fmt.Sprintf("k%d", i%4)), []byte(fmt.Sprintf("v%d", i))))
+	}
+
+	evs, _ := collectChanges(t, b, 0)
+	require.Len(t, evs, 40)
+	floor := evs[19].Seq
+	require.NoError(t, b.AckChanges(floor))
+
+	require.NoError(t, b.Merge())
+
+	after, _ := collectChanges(t, b, floor)
+	assert.Equal(t, evs[20:], after, "Changes after the floor should survive merge")
+
+	val, err := b.Get([]byte("k3"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v39"), val)
+}
+
+func TestChangesSince_AfterMerge(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir(), WithMaxFileSize(256))
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, b.Put([]byte(fmt.Sprintf("k%d", i%4)), []byte(fmt.Sprintf("v%d", i))))
+	}
+	_, token := collectChanges(t, b, 0)
+	require.NoError(t, b.Merge())
+
+	evs, _ := collectChanges(t, b, token)
+	assert.Empty(t, evs, "Merged records should keep their sequence numbers")
+
+	require.NoError(t, b.Put([]byte("k0"), []byte("new")))
+	evs, _ = collectChanges(t, b, token)
+	require.Len(t, evs, 1)
+	assert.Equal(t, token+1, evs[0].Seq, "Sequence numbers should stay monotonic after merge")
+}
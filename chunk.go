@@ -0,0 +1,144 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// 开启 Options.ChunkChecksum 后, 大于一个分块的值按分块存储, 每个分块后附带自身的校验和:
+//
+// | chunk_0 | crc_0 | chunk_1 | crc_1 | ... | chunk_n | crc_n |
+//
+// 记录的校验和仍覆盖整个值, 分块校验和仅用于 GetRange 只读取部分值时的校验.
+// 分块大小固定, 使得记录在合并等重写过程中不需要重新编码
+const (
+	chunkSize    = 64 * 1024
+	chunkSumSize = 4
+)
+
+var chunkTable = crc32.MakeTable(crc32.Castagnoli)
+
+// chunkedSize 返回长度为 n 的值分块存储后的大小
+func chunkedSize(n int64) int64 {
+	chunks := (n + chunkSize - 1) / chunkSize
+	return n + chunks*chunkSumSize
+}
+
+// unchunkedSize 返回分块存储大小为 n 的值的原始长度
+func unchunkedSize(n int64) int64 {
+	chunks := (n + chunkSize + chunkSumSize - 1) / (chunkSize + chunkSumSize)
+	return n - chunks*chunkSumSize
+}
+
+func encodeChunked(val []byte) []byte {
+	buf := make([]byte, 0, chunkedSize(int64(len(val))))
+	for len(val) > 0 {
+		n := min(len(val), chunkSize)
+		buf = append(buf, val[:n]...)
+		buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(val[:n], chunkTable))
+		val = val[n:]
+	}
+	return buf
+}
+
+// decodeChunked 去除分块校验和, 并校验每个分块
+func decodeChunked(buf []byte) ([]byte, error) {
+	val := make([]byte, 0, unchunkedSize(int64(len(buf))))
+	for len(buf) > 0 {
+		n := min(len(buf), chunkSize+chunkSumSize)
+		chunk, err := verifyChunk(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		val = append(val, chunk...)
+		buf = buf[n:]
+	}
+	return val, nil
+}
+
+// verifyChunk 校验一个带校验和的分块, 返回分块数据
+func verifyChunk(b []byte) ([]byte, error) {
+	if len(b) <= chunkSumSize {
+		return nil, ErrCRCValidation
+	}
+
+	data := b[:len(b)-chunkSumSize]
+	if crc32.Checksum(data, chunkTable) != binary.BigEndian.Uint32(b[len(data):]) {
+		return nil, ErrCRCValidation
+	}
+	return data, nil
+}
+
+// chunkEncoder 将 r 中的数据转换为分块存储格式, 用于流式写入
+type chunkEncoder struct {
+	r   io.Reader
+	buf []byte
+	off int
+	err error
+}
+
+func newChunkEncoder(r io.Reader) *chunkEncoder {
+	return &chunkEncoder{r: r, buf: make([]byte, 0, chunkSize+chunkSumSize)}
+}
+
+func (ce *chunkEncoder) Read(p []byte) (int, error) {
+	if ce.off == len(ce.buf) {
+		if ce.err != nil {
+			return 0, ce.err
+		}
+
+		n, err := io.ReadFull(ce.r, ce.buf[:chunkSize])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		ce.err = err
+		if n == 0 {
+			return 0, ce.err
+		}
+
+		ce.buf = binary.BigEndian.AppendUint32(ce.buf[:n], crc32.Checksum(ce.buf[:n], chunkTable))
+		ce.off = 0
+	}
+
+	n := copy(p, ce.buf[ce.off:])
+	ce.off += n
+	return n, nil
+}
+
+// chunkDecoder 从分块存储格式中读取原始数据, 并校验每个分块
+type chunkDecoder struct {
+	r   io.Reader
+	buf []byte
+	off int
+	cap int
+}
+
+func newChunkDecoder(r io.Reader) *chunkDecoder {
+	return &chunkDecoder{r: r, buf: make([]byte, chunkSize+chunkSumSize)}
+}
+
+func (cd *chunkDecoder) Read(p []byte) (int, error) {
+	if cd.off == cd.cap {
+		n, err := io.ReadFull(cd.r, cd.buf)
+		if n == 0 {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+
+		data, verr := verifyChunk(cd.buf[:n])
+		if verr != nil {
+			return 0, verr
+		}
+		cd.off, cd.cap = 0, len(data)
+	}
+
+	n := copy(p, cd.buf[cd.off:cd.cap])
+	cd.off += n
+	return n, nil
+}
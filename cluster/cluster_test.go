@@ -0,0 +1,277 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chhz0/bitcask"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCluster struct {
+	net   *MemNetwork
+	nodes []*Node
+}
+
+func newTestCluster(t *testing.T, size int) *testCluster {
+	t.Helper()
+
+	c := &testCluster{net: NewMemNetwork()}
+	var servers []raft.Server
+	for i := range size {
+		id := raft.ServerID(fmt.Sprintf("node%d", i))
+		n := c.start(t, id, t.TempDir())
+		servers = append(servers, raft.Server{ID: id, Address: n.Addr()})
+	}
+	require.NoError(t, c.nodes[0].Bootstrap(servers))
+	return c
+}
+
+// start 在 dir 上启动节点并加入测试网络
+func (c *testCluster) start(t *testing.T, id raft.ServerID, dir string) *Node {
+	t.Helper()
+
+	addr := raft.ServerAddress(id)
+	rc := raft.DefaultConfig()
+	rc.HeartbeatTimeout = 50 * time.Millisecond
+	rc.ElectionTimeout = 50 * time.Millisecond
+	rc.LeaderLeaseTimeout = 50 * time.Millisecond
+	rc.CommitTimeout = 5 * time.Millisecond
+	rc.TrailingLogs = 10
+	rc.SnapshotThreshold = 1 << 20
+	rc.LogOutput = io.Discard
+
+	n, err := NewNode(Config{
+		ID:        id,
+		Dir:       dir,
+		Transport: c.net.Transport(addr),
+		Forwarder: c.net.Forwarder(addr),
+		Raft:      rc,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = n.Close() })
+
+	c.net.Register(n)
+	c.nodes = append(c.nodes, n)
+	return n
+}
+
+// leader 等待 nodes 中选出主节点, 且所有节点都已知道主节点的地址
+func (c *testCluster) leader(t *testing.T, nodes ...*Node) *Node {
+	t.Helper()
+
+	if len(nodes) == 0 {
+		nodes = c.nodes
+	}
+	var leader *Node
+	require.Eventually(t, func() bool {
+		leader = nil
+		for _, n := range nodes {
+			if n.IsLeader() {
+				leader = n
+			}
+		}
+		if leader == nil {
+			return false
+		}
+		for _, n := range nodes {
+			if n.Leader() != leader.Addr() {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond, "cluster should elect a leader")
+	return leader
+}
+
+func (c *testCluster) follower(leader *Node) *Node {
+	for _, n := range c.nodes {
+		if n != leader {
+			return n
+		}
+	}
+	return nil
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestCluster_ForwardAndRead(t *testing.T) {
+	c := newTestCluster(t, 3)
+	ctx := testContext(t)
+	leader := c.leader(t)
+	follower := c.follower(leader)
+
+	// 非主节点的写入转发给主节点
+	require.NoError(t, follower.Put(ctx, []byte("a"), []byte("1")))
+	require.NoError(t, leader.Put(ctx, []byte("b"), []byte("2")))
+
+	wb := bitcask.NewBatch()
+	require.NoError(t, wb.Put([]byte("c"), []byte("3")))
+	require.NoError(t, wb.Delete([]byte("b")))
+	require.NoError(t, follower.WriteBatch(ctx, wb))
+
+	// 每个节点上的读取都能看到之前完成的写入
+	for _, n := range c.nodes {
+		val, err := n.Get(ctx, []byte("a"))
+		require.NoError(t, err)
+		assert.Equal(t, "1", string(val))
+
+		val, err = n.Get(ctx, []byte("c"))
+		require.NoError(t, err)
+		assert.Equal(t, "3", string(val))
+
+		_, err = n.Get(ctx, []byte("b"))
+		assert.ErrorIs(t, err, bitcask.ErrKeyNotFound)
+	}
+
+	require.NoError(t, follower.Delete(ctx, []byte("a")))
+	_, err := follower.Get(ctx, []byte("a"))
+	assert.ErrorIs(t, err, bitcask.ErrKeyNotFound)
+}
+
+func TestCluster_Partition(t *testing.T) {
+	c := newTestCluster(t, 3)
+	ctx := testContext(t)
+	old := c.leader(t)
+	require.NoError(t, old.Put(ctx, []byte("k"), []byte("v1")))
+
+	// 隔离主节点, 多数派选出新的主节点并继续接受写入
+	c.net.Partition(old.Addr())
+	var rest []*Node
+	for _, n := range c.nodes {
+		if n != old {
+			rest = append(rest, n)
+		}
+	}
+	leader := c.leader(t, rest...)
+	require.NoError(t, leader.Put(ctx, []byte("k"), []byte("v2")))
+
+	// 旧主节点无法提交写入, 也不能返回过期的读取结果
+	short, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	assert.Error(t, old.Put(short, []byte("k"), []byte("stale")))
+	_, err := old.Get(short, []byte("k"))
+	assert.Error(t, err)
+
+	other := rest[0]
+	if other == leader {
+		other = rest[1]
+	}
+	val, err := other.Get(ctx, []byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(val))
+
+	// 恢复网络后旧主节点追上最新数据
+	c.net.Heal()
+	require.Eventually(t, func() bool {
+		val, err := old.Get(ctx, []byte("k"))
+		return err == nil && string(val) == "v2"
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestCluster_InstallSnapshot(t *testing.T) {
+	c := newTestCluster(t, 3)
+	ctx := testContext(t)
+	leader := c.leader(t)
+	lagging := c.follower(leader)
+	require.NoError(t, leader.Put(ctx, []byte("gone"), []byte("x")))
+	require.Eventually(t, func() bool {
+		_, err := lagging.DB().Get([]byte("gone"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	c.net.Partition(lagging.Addr())
+	require.NoError(t, leader.Delete(ctx, []byte("gone")))
+	for i := range 100 {
+		key := fmt.Sprintf("key%03d", i)
+		require.NoError(t, leader.Put(ctx, []byte(key), []byte(key)))
+	}
+
+	// 快照后日志被截断, 落后的节点只能通过安装快照追上
+	require.NoError(t, leader.raft.Snapshot().Error())
+	c.net.Heal()
+
+	require.Eventually(t, func() bool {
+		keys, err := lagging.DB().ListKeys()
+		return err == nil && len(keys) == 100
+	}, 5*time.Second, 20*time.Millisecond)
+
+	_, err := lagging.DB().Get([]byte("gone"))
+	assert.ErrorIs(t, err, bitcask.ErrKeyNotFound)
+	val, err := lagging.Get(ctx, []byte("key042"))
+	require.NoError(t, err)
+	assert.Equal(t, "key042", string(val))
+}
+
+func TestCluster_Restart(t *testing.T) {
+	c := newTestCluster(t, 1)
+	ctx := testContext(t)
+	n := c.leader(t)
+	dir := n.cfg.Dir
+
+	require.NoError(t, n.Put(ctx, []byte("a"), []byte("1")))
+	require.NoError(t, n.raft.Snapshot().Error())
+	require.NoError(t, n.Put(ctx, []byte("b"), []byte("2")))
+	require.NoError(t, n.Close())
+
+	// 日志, 任期和快照保存在磁盘上, 重启后不需要重新初始化集群
+	c = &testCluster{net: NewMemNetwork()}
+	n = c.start(t, "node0", dir)
+	c.leader(t)
+	for k, want := range map[string]string{"a": "1", "b": "2"} {
+		val, err := n.Get(ctx, []byte(k))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(val))
+	}
+}
+
+func TestFSM_Restore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	f, err := openFSM(dir, nil)
+	require.NoError(t, err)
+	defer f.close()
+	require.NoError(t, f.current().Put([]byte("a"), []byte("1")))
+
+	var snap bytes.Buffer
+	require.NoError(t, writePair(&snap, []byte("b"), []byte("2")))
+	require.NoError(t, writePair(&snap, []byte("c"), []byte("3")))
+
+	// 快照不完整时原有数据不变
+	truncated := snap.Bytes()[:snap.Len()-1]
+	assert.Error(t, f.Restore(io.NopCloser(bytes.NewReader(truncated))))
+	val, err := f.get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(val))
+	_, err = f.get([]byte("b"))
+	assert.ErrorIs(t, err, bitcask.ErrKeyNotFound)
+	assert.NoDirExists(t, dir+restoreSuffix)
+
+	require.NoError(t, f.Restore(io.NopCloser(bytes.NewReader(snap.Bytes()))))
+	keys, err := f.current().ListKeys()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c")}, keys)
+	assert.NoDirExists(t, dir+oldSuffix)
+	require.NoError(t, f.close())
+
+	// 原目录已改名但新目录未换入时崩溃, 重新打开时改回原目录
+	require.NoError(t, os.Rename(dir, dir+oldSuffix))
+	require.NoError(t, os.MkdirAll(dir+restoreSuffix, 0o755))
+	f, err = openFSM(dir, nil)
+	require.NoError(t, err)
+	val, err = f.get([]byte("c"))
+	require.NoError(t, err)
+	assert.Equal(t, "3", string(val))
+	assert.NoDirExists(t, dir+restoreSuffix)
+}
@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/chhz0/bitcask"
+)
+
+var ErrBadCommand = errors.New("bad raft command.")
+
+// 写命令编码: | count | op... |
+// op: | deleted | key_sz | key | value_sz | value |
+func encodeCommand(wb *bitcask.Batch) []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(wb.Len()))
+	wb.ForEach(func(key, value []byte, deleted bool) bool {
+		if deleted {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(key)))
+		buf = append(buf, key...)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+		buf = append(buf, value...)
+		return true
+	})
+	return buf
+}
+
+func decodeCommand(b []byte) (*bitcask.Batch, error) {
+	if len(b) < 4 {
+		return nil, ErrBadCommand
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+
+	wb := bitcask.NewBatch()
+	for i := uint32(0); i < n; i++ {
+		if len(b) < 1 {
+			return nil, ErrBadCommand
+		}
+		deleted := b[0] == 1
+		b = b[1:]
+
+		key, rest, err := readBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		value, rest, err := readBytes(rest)
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+
+		if deleted {
+			err = wb.Delete(key)
+		} else {
+			err = wb.Put(key, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return wb, nil
+}
+
+// readBytes 读取 | size | data |, 返回 data 和剩余部分
+func readBytes(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, ErrBadCommand
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, ErrBadCommand
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
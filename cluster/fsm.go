@@ -0,0 +1,286 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/chhz0/bitcask"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// restoreBatchSize 恢复快照时每个批次写入的键值对数量
+	restoreBatchSize = 1024
+
+	// 恢复快照时先写入 Dir + restoreSuffix, 替换时原数据目录改名为 Dir + oldSuffix
+	restoreSuffix = ".restore"
+	oldSuffix     = ".old"
+)
+
+// fsm 以 bitcask 作为 Raft 状态机
+//
+// 重放日志时 Put/Delete 是幂等的, 节点重启后从快照之后的日志重新应用即可.
+// Apply 和 Restore 由 Raft 依次调用, mu 保护 Restore 替换 db 时的并发读取
+type fsm struct {
+	dir  string
+	opts []bitcask.Option
+
+	mu sync.RWMutex
+	db *bitcask.Bitcask
+}
+
+// openFSM 打开 dir 中的 bitcask, 先处理上次替换数据目录时崩溃留下的目录
+func openFSM(dir string, opts []bitcask.Option) (*fsm, error) {
+	if err := recoverRestore(dir); err != nil {
+		return nil, err
+	}
+	db, err := bitcask.Open(dir, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &fsm{dir: dir, opts: opts, db: db}, nil
+}
+
+// recoverRestore 数据目录不存在时说明已改名但新目录未换入, 改回原目录; 之后清理遗留的目录.
+// Raft 启动时会重新安装最新的快照
+func recoverRestore(dir string) error {
+	old := dir + oldSuffix
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if _, err := os.Stat(old); err == nil {
+			if err := os.Rename(old, dir); err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range []string{dir + restoreSuffix, old} {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fsm) current() *bitcask.Bitcask {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.db
+}
+
+func (f *fsm) get(key []byte) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.db.Get(key)
+}
+
+func (f *fsm) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.db.Close()
+}
+
+func (f *fsm) Apply(l *raft.Log) any {
+	if l.Type != raft.LogCommand {
+		return nil
+	}
+
+	wb, err := decodeCommand(l.Data)
+	if err != nil {
+		return err
+	}
+	return applyBatch(f.db, wb)
+}
+
+// applyBatch 单个操作直接写入, 避免批次标记的开销
+func applyBatch(db *bitcask.Bitcask, wb *bitcask.Batch) error {
+	if wb.Len() != 1 {
+		return db.WriteBatch(wb)
+	}
+
+	var err error
+	wb.ForEach(func(key, value []byte, deleted bool) bool {
+		if deleted {
+			err = db.Delete(key)
+		} else {
+			err = db.Put(key, value)
+		}
+		return false
+	})
+	return err
+}
+
+// Snapshot 使用 bitcask 快照, Persist 与后续的 Apply 并发执行互不影响
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	snap, err := f.db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &fsmSnapshot{snap: snap}, nil
+}
+
+// Restore 用快照替换状态机的全部数据
+//
+// 快照先完整写入临时目录, 再替换数据目录, 读取快照失败时原有数据不变
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	tmp := f.dir + restoreSuffix
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := load(tmp, f.opts, rc); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.swap(tmp)
+}
+
+// load 将快照写入 dir 中新建的 bitcask
+func load(dir string, opts []bitcask.Option, r io.Reader) error {
+	db, err := bitcask.Open(dir, opts...)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		wb := bitcask.NewBatch()
+		br := bufio.NewReader(r)
+		for {
+			key, value, err := readPair(br)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := wb.Put(key, value); err != nil {
+				return err
+			}
+			if wb.Len() >= restoreBatchSize {
+				if err := db.WriteBatch(wb); err != nil {
+					return err
+				}
+				wb.Reset()
+			}
+		}
+		if err := db.WriteBatch(wb); err != nil {
+			return err
+		}
+		return db.Sync()
+	}()
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// swap 关闭当前的 bitcask, 用 dir 替换数据目录后重新打开, 调用方持有 mu
+//
+// 原数据目录先改名为 Dir + oldSuffix, 新目录换入后再删除, 崩溃后由 recoverRestore 处理
+func (f *fsm) swap(dir string) error {
+	if err := f.db.Close(); err != nil {
+		return err
+	}
+
+	old := f.dir + oldSuffix
+	if err := os.RemoveAll(old); err != nil {
+		return f.reopen(err)
+	}
+	if err := os.Rename(f.dir, old); err != nil {
+		return f.reopen(err)
+	}
+	if err := os.Rename(dir, f.dir); err != nil {
+		_ = os.Rename(old, f.dir)
+		return f.reopen(err)
+	}
+	if err := f.reopen(nil); err != nil {
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// reopen 重新打开数据目录, 返回 cause 或打开时的错误
+func (f *fsm) reopen(cause error) error {
+	db, err := bitcask.Open(f.dir, f.opts...)
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+	f.db = db
+	return cause
+}
+
+// fsmSnapshot 快照编码为连续的 | key_sz | key | value_sz | value |
+type fsmSnapshot struct {
+	snap *bitcask.Snapshot
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.persist(sink); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) persist(w io.Writer) error {
+	keys, err := s.snap.ListKeys()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, key := range keys {
+		value, err := s.snap.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := writePair(bw, key, value); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (s *fsmSnapshot) Release() {
+	_ = s.snap.Release()
+}
+
+func writePair(w io.Writer, key, value []byte) error {
+	for _, b := range [][]byte{key, value} {
+		if err := binary.Write(w, binary.BigEndian, uint32(len(b))); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readPair(r io.Reader) ([]byte, []byte, error) {
+	var pair [2][]byte
+	for i := range pair {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			if i == 1 && errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, nil, err
+		}
+		pair[i] = make([]byte, n)
+		if _, err := io.ReadFull(r, pair[i]); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, nil, err
+		}
+	}
+	return pair[0], pair[1], nil
+}
@@ -0,0 +1,118 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+var ErrUnreachable = errors.New("node is unreachable.")
+
+// MemNetwork 进程内网络, 为节点提供 Raft 传输和请求转发, 可以模拟网络分区
+type MemNetwork struct {
+	mu    sync.Mutex
+	trans map[raft.ServerAddress]*raft.InmemTransport
+	nodes map[raft.ServerAddress]*Node
+	cut   map[[2]raft.ServerAddress]bool
+}
+
+func NewMemNetwork() *MemNetwork {
+	return &MemNetwork{
+		trans: make(map[raft.ServerAddress]*raft.InmemTransport),
+		nodes: make(map[raft.ServerAddress]*Node),
+		cut:   make(map[[2]raft.ServerAddress]bool),
+	}
+}
+
+// Transport 创建地址为 addr 的传输并与网络中已有的节点互联
+func (m *MemNetwork) Transport(addr raft.ServerAddress) *raft.InmemTransport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, t := raft.NewInmemTransport(addr)
+	for other, ot := range m.trans {
+		t.Connect(other, ot)
+		ot.Connect(addr, t)
+	}
+	m.trans[addr] = t
+	return t
+}
+
+// Forwarder 返回 from 节点使用的转发器
+func (m *MemNetwork) Forwarder(from raft.ServerAddress) Forwarder {
+	return &memForwarder{net: m, from: from}
+}
+
+// Register 注册节点, 使其可以接收转发的请求
+func (m *MemNetwork) Register(n *Node) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[n.Addr()] = n
+}
+
+// Partition 将 group 中的节点与其余节点隔离
+func (m *MemNetwork) Partition(group ...raft.ServerAddress) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	in := make(map[raft.ServerAddress]bool, len(group))
+	for _, addr := range group {
+		in[addr] = true
+	}
+	for a := range in {
+		for b, bt := range m.trans {
+			if in[b] {
+				continue
+			}
+			m.trans[a].Disconnect(b)
+			bt.Disconnect(a)
+			m.cut[[2]raft.ServerAddress{a, b}] = true
+			m.cut[[2]raft.ServerAddress{b, a}] = true
+		}
+	}
+}
+
+// Heal 恢复所有节点之间的连接
+func (m *MemNetwork) Heal() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for pair := range m.cut {
+		m.trans[pair[0]].Connect(pair[1], m.trans[pair[1]])
+	}
+	clear(m.cut)
+}
+
+func (m *MemNetwork) route(from, to raft.ServerAddress) (*Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.nodes[to]
+	if !ok || m.cut[[2]raft.ServerAddress{from, to}] {
+		return nil, ErrUnreachable
+	}
+	return n, nil
+}
+
+type memForwarder struct {
+	net  *MemNetwork
+	from raft.ServerAddress
+}
+
+func (f *memForwarder) Apply(ctx context.Context, leader raft.ServerAddress, cmd []byte) error {
+	n, err := f.net.route(f.from, leader)
+	if err != nil {
+		return err
+	}
+	return n.HandleApply(ctx, cmd)
+}
+
+func (f *memForwarder) ReadIndex(ctx context.Context, leader raft.ServerAddress) (uint64, error) {
+	n, err := f.net.route(f.from, leader)
+	if err != nil {
+		return 0, err
+	}
+	return n.HandleReadIndex(ctx)
+}
@@ -0,0 +1,268 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/chhz0/bitcask"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+var (
+	ErrNoLeader  = errors.New("cluster has no leader.")
+	ErrNotLeader = errors.New("node is not the leader.")
+)
+
+const (
+	// defaultTimeout ctx 没有截止时间时, 提交命令和确认主节点身份的超时时间
+	defaultTimeout = 10 * time.Second
+
+	// raftDBName RaftDir 中保存日志和元数据的文件
+	raftDBName = "raft.db"
+	// snapshotRetain RaftDir 中保留的快照数量
+	snapshotRetain = 2
+)
+
+// Forwarder 非主节点通过 Forwarder 将写入和读索引请求发往主节点,
+// 主节点一侧调用 HandleApply 和 HandleReadIndex 处理
+type Forwarder interface {
+	Apply(ctx context.Context, leader raft.ServerAddress, cmd []byte) error
+	ReadIndex(ctx context.Context, leader raft.ServerAddress) (uint64, error)
+}
+
+// Config 节点配置
+type Config struct {
+	ID        raft.ServerID
+	Dir       string // bitcask 数据目录, 作为状态机
+	RaftDir   string // Raft 日志, 元数据和快照的目录, 为空时使用 Dir + ".raft"
+	Options   []bitcask.Option
+	Transport raft.Transport
+	Forwarder Forwarder
+
+	// 以下为空时使用默认值, 日志和元数据保存在 RaftDir 下的 raft.db 中, 快照保存在 RaftDir 下.
+	// raft.NewInmemStore 等内存实现重启后丢失数据, 只适用于测试
+	Raft          *raft.Config
+	LogStore      raft.LogStore
+	StableStore   raft.StableStore
+	SnapshotStore raft.SnapshotStore
+}
+
+// Node Raft 集群中的一个节点, 写入经 Raft 日志复制后应用到本地 bitcask
+type Node struct {
+	cfg   Config
+	fsm   *fsm
+	store *raftboltdb.BoltStore
+	raft  *raft.Raft
+
+	// readyTerm 已提交过本任期日志的任期, 此后 CommitIndex 才能作为读索引
+	readyTerm atomic.Uint64
+}
+
+// NewNode 打开 bitcask 并启动 Raft, 新集群需要在一个节点上调用 Bootstrap
+func NewNode(cfg Config) (*Node, error) {
+	cfg.Dir = filepath.Clean(cfg.Dir)
+	if cfg.RaftDir == "" {
+		cfg.RaftDir = cfg.Dir + ".raft"
+	}
+
+	f, err := openFSM(cfg.Dir, cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{cfg: cfg, fsm: f}
+
+	rc := raft.DefaultConfig()
+	if cfg.Raft != nil {
+		c := *cfg.Raft
+		rc = &c
+	}
+	rc.LocalID = cfg.ID
+
+	logs, stable, snaps := cfg.LogStore, cfg.StableStore, cfg.SnapshotStore
+	if logs == nil || stable == nil || snaps == nil {
+		if err := os.MkdirAll(cfg.RaftDir, 0o755); err != nil {
+			return nil, n.closeStores(err)
+		}
+	}
+	if logs == nil || stable == nil {
+		n.store, err = raftboltdb.New(raftboltdb.Options{Path: filepath.Join(cfg.RaftDir, raftDBName)})
+		if err != nil {
+			return nil, n.closeStores(err)
+		}
+		if logs == nil {
+			logs = n.store
+		}
+		if stable == nil {
+			stable = n.store
+		}
+	}
+	if snaps == nil {
+		if snaps, err = raft.NewFileSnapshotStore(cfg.RaftDir, snapshotRetain, rc.LogOutput); err != nil {
+			return nil, n.closeStores(err)
+		}
+	}
+
+	if n.raft, err = raft.NewRaft(rc, f, logs, stable, snaps, cfg.Transport); err != nil {
+		return nil, n.closeStores(err)
+	}
+	return n, nil
+}
+
+// closeStores 关闭 bitcask 和日志存储, 返回 err 和关闭时的第一个错误
+func (n *Node) closeStores(err error) error {
+	if n.store != nil {
+		if cerr := n.store.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := n.fsm.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Bootstrap 以 servers 为初始成员创建集群
+func (n *Node) Bootstrap(servers []raft.Server) error {
+	return n.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+}
+
+// Addr 返回节点的 Raft 地址
+func (n *Node) Addr() raft.ServerAddress {
+	return n.cfg.Transport.LocalAddr()
+}
+
+// IsLeader 判断节点当前是否为主节点
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Leader 返回当前主节点的地址, 未知时为空
+func (n *Node) Leader() raft.ServerAddress {
+	addr, _ := n.raft.LeaderWithID()
+	return addr
+}
+
+// DB 返回本地 bitcask, 直接读取可能读到旧数据, 不能直接写入.
+// 安装快照时会替换数据目录并重新打开, 之后之前返回的实例被关闭
+func (n *Node) DB() *bitcask.Bitcask {
+	return n.fsm.current()
+}
+
+// Put 经 Raft 写入 key/value, 非主节点转发给主节点
+func (n *Node) Put(ctx context.Context, key, value []byte) error {
+	wb := bitcask.NewBatch()
+	if err := wb.Put(key, value); err != nil {
+		return err
+	}
+	return n.WriteBatch(ctx, wb)
+}
+
+// Delete 经 Raft 删除 key
+func (n *Node) Delete(ctx context.Context, key []byte) error {
+	wb := bitcask.NewBatch()
+	if err := wb.Delete(key); err != nil {
+		return err
+	}
+	return n.WriteBatch(ctx, wb)
+}
+
+// WriteBatch 经 Raft 原子写入批次
+func (n *Node) WriteBatch(ctx context.Context, wb *bitcask.Batch) error {
+	if wb.Len() == 0 {
+		return nil
+	}
+
+	cmd := encodeCommand(wb)
+	if n.IsLeader() {
+		return n.HandleApply(ctx, cmd)
+	}
+
+	leader := n.Leader()
+	if leader == "" {
+		return ErrNoLeader
+	}
+	return n.cfg.Forwarder.Apply(ctx, leader, cmd)
+}
+
+// Get 线性一致读: 从主节点获取读索引, 等待本地应用到该位置后读取本地 bitcask
+func (n *Node) Get(ctx context.Context, key []byte) ([]byte, error) {
+	var (
+		idx uint64
+		err error
+	)
+	if n.IsLeader() {
+		idx, err = n.HandleReadIndex(ctx)
+	} else if leader := n.Leader(); leader == "" {
+		err = ErrNoLeader
+	} else {
+		idx, err = n.cfg.Forwarder.ReadIndex(ctx, leader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for n.raft.AppliedIndex() < idx {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return n.fsm.get(key)
+}
+
+// HandleApply 在主节点上提交命令并等待状态机应用
+func (n *Node) HandleApply(ctx context.Context, cmd []byte) error {
+	f := n.raft.Apply(cmd, timeout(ctx))
+	if err := f.Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return ErrNotLeader
+		}
+		return err
+	}
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// HandleReadIndex 在主节点上返回读索引
+//
+// 新任期内先通过 Barrier 提交一条日志, 保证 CommitIndex 包含之前任期的全部日志;
+// 返回前确认自己仍是主节点, 避免分区后的旧主节点返回过期的位置
+func (n *Node) HandleReadIndex(ctx context.Context) (uint64, error) {
+	if !n.IsLeader() {
+		return 0, ErrNotLeader
+	}
+
+	term := n.raft.CurrentTerm()
+	if n.readyTerm.Load() != term {
+		if err := n.raft.Barrier(timeout(ctx)).Error(); err != nil {
+			return 0, ErrNotLeader
+		}
+		n.readyTerm.Store(term)
+	}
+
+	idx := n.raft.CommitIndex()
+	if err := n.raft.VerifyLeader().Error(); err != nil {
+		return 0, ErrNotLeader
+	}
+	return idx, nil
+}
+
+// Close 停止 Raft 并关闭 bitcask 和日志存储
+func (n *Node) Close() error {
+	return n.closeStores(n.raft.Shutdown().Error())
+}
+
+func timeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return defaultTimeout
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+	bcodec "github.com/chhz0/bitcask/internal/codec"
+)
+
+// 记录的检查结果
+const (
+	statusOK        = "ok"
+	statusBadCRC    = "bad-crc"   // 记录头可以解析, 校验和不匹配
+	statusTruncated = "truncated" // 记录超出文件末尾, 通常是未写完的最后一条记录
+	statusSkipped   = "skipped"   // 重新同步时跳过的无法解析的字节
+)
+
+// hint 记录值的布局与 hint.go 一致:
+//
+// | record_pos(8) | record_sz(4) | value_pos(8) | value_sz(4) | blob pointer(可选) |
+//
+// blob pointer 的布局与 blob.go 一致: | file_id(4) | offset(8) | size(4) | flags(1) |
+const (
+	hintValueSize   = 8 + 4 + 8 + 4
+	blobPointerSize = 4 + 8 + 4 + 1
+	blobFlagChunked = 1 << 0
+)
+
+// dumpMissingField 文本输出中缺失字段的占位符
+const dumpMissingField = "-"
+
+// dumpRecord dump 输出的一条记录或一段跳过的字节
+type dumpRecord struct {
+	Offset int64     `json:"offset"`
+	Size   int64     `json:"size"`
+	Status string    `json:"status"`
+	Tstamp int64     `json:"tstamp,omitempty"`
+	Seq    uint64    `json:"seq,omitempty"`
+	Expiry int64     `json:"expiry,omitempty"`
+	Type   string    `json:"type,omitempty"`
+	KSz    uint32    `json:"ksz,omitempty"`
+	VSz    uint32    `json:"vsz,omitempty"`
+	Key    *string   `json:"key,omitempty"`
+	Hint   *dumpHint `json:"hint,omitempty"`
+
+	header bool   // 是否解析出了记录头
+	key    []byte // 记录头之后的 ksz 字节, 超出文件末尾时为 nil
+	entry  *internal.Entry
+}
+
+// dumpHint hint 记录指向的数据记录位置
+type dumpHint struct {
+	RecordPos int64     `json:"record_pos"`
+	RecordSz  uint32    `json:"record_sz"`
+	ValuePos  int64     `json:"value_pos"`
+	ValueSz   uint32    `json:"value_sz"`
+	Blob      *dumpBlob `json:"blob,omitempty"`
+}
+
+type dumpBlob struct {
+	FileID  uint32 `json:"file_id"`
+	Offset  int64  `json:"offset"`
+	Size    uint32 `json:"size"`
+	Chunked bool   `json:"chunked,omitempty"`
+}
+
+func cmdDump(c *cli, args []string) error {
+	return c.dump("dump", args, false)
+}
+
+func cmdDumpHint(c *cli, args []string) error {
+	return c.dump("dump-hint", args, true)
+}
+
+// dump 按记录顺序输出文件内容, 遇到损坏的记录时从下一条可以通过校验的记录处继续
+func (c *cli) dump(name string, args []string, hint bool) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := fs.Bool("json", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return usageError{}
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fh, err := bcodec.DecodeFileHeader(data)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(c.stdout)
+	var (
+		tw  *tabwriter.Writer
+		enc *json.Encoder
+	)
+	if *asJSON {
+		enc = json.NewEncoder(bw)
+	} else {
+		tw = tabwriter.NewWriter(bw, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "# checksum=%s format=%s base_tstamp=%d\n", fh.Checksum, fh.Format, fh.BaseTstamp)
+		if hint {
+			fmt.Fprintln(tw, "offset\tsize\tstatus\ttstamp\ttype\tksz\tvsz\trecord_pos\trecord_sz\tvalue_pos\tvalue_sz\tblob\tkey")
+		} else {
+			fmt.Fprintln(tw, "offset\tsize\tstatus\ttstamp\ttype\tksz\tvsz\tkey")
+		}
+	}
+
+	err = walkRecords(bcodec.New(fh), data, func(r *dumpRecord) error {
+		if r.key != nil {
+			key := c.keyEnc.encode(r.key)
+			r.Key = &key
+		}
+		if hint && r.entry != nil && r.entry.Type != internal.TypeDeleted {
+			r.Hint = decodeDumpHint(r.entry)
+		}
+
+		if enc != nil {
+			return enc.Encode(r)
+		}
+		return writeDumpRecord(tw, r, hint)
+	})
+	if err != nil {
+		return err
+	}
+	if tw != nil {
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// walkRecords 依次对 data 中文件头之后的每条记录调用 fn
+//
+// 解码失败时向后逐字节查找下一条可以通过校验的记录, 失败的记录和跳过的字节也会传给 fn
+func walkRecords(rc *bcodec.Codec, data []byte, fn func(r *dumpRecord) error) error {
+	end := int64(len(data))
+	for off := int64(bcodec.FileHeaderSize); off < end; {
+		r := inspectRecord(rc, data, off)
+		if r.Status == statusOK {
+			if err := fn(r); err != nil {
+				return err
+			}
+			off += r.Size
+			continue
+		}
+
+		next := resync(rc, data, r)
+		switch {
+		case r.header && r.Status == statusBadCRC && off+r.Size <= next:
+			// 记录头可信, 只有记录本身损坏
+			if err := fn(r); err != nil {
+				return err
+			}
+			if off+r.Size < next {
+				if err := fn(&dumpRecord{Offset: off + r.Size, Size: next - off - r.Size, Status: statusSkipped}); err != nil {
+					return err
+				}
+			}
+		case r.Status == statusTruncated && next == end:
+			r.Size = end - off
+			if err := fn(r); err != nil {
+				return err
+			}
+		default:
+			if err := fn(&dumpRecord{Offset: off, Size: next - off, Status: statusSkipped}); err != nil {
+				return err
+			}
+		}
+		off = next
+	}
+	return nil
+}
+
+// inspectRecord 解析 off 处的记录, 记录头无法解析时 header 为 false
+func inspectRecord(rc *bcodec.Codec, data []byte, off int64) *dumpRecord {
+	b := data[off:]
+	r := &dumpRecord{Offset: off, Status: statusSkipped}
+
+	h, err := rc.DecodeHeader(b)
+	if err != nil {
+		if len(b) < rc.HeaderSize() {
+			r.Status = statusTruncated
+		}
+		return r
+	}
+
+	r.header = true
+	r.Size = int64(h.Size) + int64(h.KSz) + int64(h.VSz)
+	r.Tstamp, r.Seq, r.Expiry = h.Tstamp, h.Seq, h.Expiry
+	r.Type, r.KSz, r.VSz = typeName(h.Type), h.KSz, h.VSz
+	if int64(h.Size)+int64(h.KSz) <= int64(len(b)) {
+		r.key = b[h.Size : h.Size+int(h.KSz)]
+	}
+
+	e, err := rc.Decode(b)
+	switch {
+	case err == nil:
+		r.Status, r.entry = statusOK, e
+	case errors.Is(err, bcodec.ErrCRCValidation):
+		r.Status = statusBadCRC
+	default:
+		r.Status = statusTruncated
+	}
+	return r
+}
+
+// resync 返回 r 之后第一条可以通过校验的记录的偏移, 找不到时返回文件末尾
+//
+// 记录头可以解析时优先尝试紧随其后的位置, 否则从 r 的下一个字节开始逐字节查找
+func resync(rc *bcodec.Codec, data []byte, r *dumpRecord) int64 {
+	end := int64(len(data))
+	if r.header && r.Offset+r.Size < end && validAt(rc, data, r.Offset+r.Size) {
+		return r.Offset + r.Size
+	}
+	for off := r.Offset + 1; off < end; off++ {
+		if validAt(rc, data, off) {
+			return off
+		}
+	}
+	return end
+}
+
+func validAt(rc *bcodec.Codec, data []byte, off int64) bool {
+	h, err := rc.DecodeHeader(data[off:])
+	if err != nil || h.Type > internal.TypeCounter {
+		return false
+	}
+	_, err = rc.Decode(data[off:])
+	return err == nil
+}
+
+func typeName(t internal.RecordType) string {
+	switch t {
+	case internal.TypeNormal:
+		return "normal"
+	case internal.TypeDeleted:
+		return "deleted"
+	case internal.TypeBlobPointer:
+		return "blob"
+	case internal.TypeChunked:
+		return "chunked"
+	case internal.TypeBatch:
+		return "batch"
+	case internal.TypeCommit:
+		return "commit"
+	case internal.TypeCounter:
+		return "counter"
+	}
+	return "type(" + strconv.Itoa(int(t)) + ")"
+}
+
+// decodeDumpHint 解码 hint 记录的值, 长度不符时返回 nil
+func decodeDumpHint(e *internal.Entry) *dumpHint {
+	if len(e.Val) < hintValueSize {
+		return nil
+	}
+	h := &dumpHint{
+		RecordPos: int64(binary.BigEndian.Uint64(e.Val[0:8])),
+		RecordSz:  binary.BigEndian.Uint32(e.Val[8:12]),
+		ValuePos:  int64(binary.BigEndian.Uint64(e.Val[12:20])),
+		ValueSz:   binary.BigEndian.Uint32(e.Val[20:24]),
+	}
+	if ptr := e.Val[hintValueSize:]; e.Type == internal.TypeBlobPointer && len(ptr) == blobPointerSize {
+		h.Blob = &dumpBlob{
+			FileID:  binary.BigEndian.Uint32(ptr[0:4]),
+			Offset:  int64(binary.BigEndian.Uint64(ptr[4:12])),
+			Size:    binary.BigEndian.Uint32(ptr[12:16]),
+			Chunked: ptr[16]&blobFlagChunked != 0,
+		}
+	}
+	return h
+}
+
+func writeDumpRecord(w io.Writer, r *dumpRecord, hint bool) error {
+	fields := []string{strconv.FormatInt(r.Offset, 10), strconv.FormatInt(r.Size, 10), r.Status}
+	if r.header {
+		fields = append(fields,
+			time.Unix(r.Tstamp, 0).UTC().Format(time.RFC3339),
+			r.Type,
+			strconv.FormatUint(uint64(r.KSz), 10),
+			strconv.FormatUint(uint64(r.VSz), 10))
+	} else {
+		fields = append(fields, dumpMissingField, dumpMissingField, dumpMissingField, dumpMissingField)
+	}
+
+	if hint {
+		if h := r.Hint; h != nil {
+			blob := dumpMissingField
+			if h.Blob != nil {
+				blob = fmt.Sprintf("%d@%d+%d", h.Blob.FileID, h.Blob.Offset, h.Blob.Size)
+			}
+			fields = append(fields,
+				strconv.FormatInt(h.RecordPos, 10),
+				strconv.FormatUint(uint64(h.RecordSz), 10),
+				strconv.FormatInt(h.ValuePos, 10),
+				strconv.FormatUint(uint64(h.ValueSz), 10),
+				blob)
+		} else {
+			fields = append(fields, dumpMissingField, dumpMissingField, dumpMissingField, dumpMissingField, dumpMissingField)
+		}
+	}
+
+	key := dumpMissingField
+	if r.Key != nil {
+		key = *r.Key
+	}
+	fields = append(fields, key)
+
+	for i, f := range fields {
+		sep := "\t"
+		if i == len(fields)-1 {
+			sep = "\n"
+		}
+		if _, err := io.WriteString(w, f+sep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
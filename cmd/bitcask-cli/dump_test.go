@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chhz0/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dumpJSON 执行 dump -json 并解析输出的每一行
+func dumpJSON(t *testing.T, cmd, file string) []dumpRecord {
+	t.Helper()
+
+	code, out := runCLI(t, "", cmd, "-json", file)
+	require.Equal(t, 0, code)
+
+	var recs []dumpRecord
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var r dumpRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		recs = append(recs, r)
+	}
+	return recs
+}
+
+func statuses(recs []dumpRecord) []string {
+	var out []string
+	for _, r := range recs {
+		out = append(out, r.Status)
+	}
+	return out
+}
+
+func TestCLI_Dump(t *testing.T) {
+	dir := t.TempDir()
+	db, err := bitcask.Open(dir)
+	require.NoError(t, err)
+	for _, kv := range [][2]string{{"a", "one"}, {"b", "two"}, {"c", "three"}} {
+		require.NoError(t, db.Put([]byte(kv[0]), []byte(kv[1])))
+	}
+	require.NoError(t, db.Delete([]byte("a")))
+	require.NoError(t, db.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.data"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	recs := dumpJSON(t, "dump", files[0])
+	require.Len(t, recs, 4)
+	assert.Equal(t, []string{"ok", "ok", "ok", "ok"}, statuses(recs))
+	assert.Equal(t, "a", *recs[0].Key)
+	assert.Equal(t, "normal", recs[0].Type)
+	assert.Equal(t, uint32(3), recs[0].VSz)
+	assert.Equal(t, "deleted", recs[3].Type)
+	assert.Equal(t, recs[0].Offset+recs[0].Size, recs[1].Offset)
+
+	// 篡改第二条记录的值, 在第三条记录前插入垃圾字节, 截断最后一条记录
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	data[recs[1].Offset+recs[1].Size-1] ^= 0xff
+	third := recs[2].Offset
+	data = append(data[:third:third], append(bytes.Repeat([]byte{0xee}, 7), data[third:]...)...)
+	data = data[:len(data)-2]
+	require.NoError(t, os.WriteFile(files[0], data, 0o644))
+
+	recs = dumpJSON(t, "dump", files[0])
+	assert.Equal(t, []string{"ok", "bad-crc", "skipped", "ok", "truncated"}, statuses(recs))
+	assert.Equal(t, "b", *recs[1].Key)
+	assert.Equal(t, third, recs[2].Offset)
+	assert.Equal(t, int64(7), recs[2].Size)
+	assert.Equal(t, "c", *recs[3].Key)
+
+	code, out := runCLI(t, "", "-key-enc", "hex", "dump", files[0])
+	require.Equal(t, 0, code)
+	assert.Contains(t, out, "bad-crc")
+	assert.Contains(t, out, " 63\n")
+
+	assert.Equal(t, 2, first(runCLI(t, "", "dump")))
+	assert.Equal(t, 1, first(runCLI(t, "", "dump", filepath.Join(dir, "missing.data"))))
+}
+
+func TestCLI_DumpHint(t *testing.T) {
+	dir := t.TempDir()
+	for _, kv := range [][2]string{{"a", "one"}, {"b", "two"}} {
+		require.Equal(t, 0, first(runCLI(t, "", "-dir", dir, "put", kv[0], kv[1])))
+	}
+	require.Equal(t, 0, first(runCLI(t, "", "-dir", dir, "merge")))
+
+	hints, err := filepath.Glob(filepath.Join(dir, "*.hint"))
+	require.NoError(t, err)
+	require.Len(t, hints, 1)
+	data := strings.TrimSuffix(hints[0], ".hint") + ".data"
+
+	recs := dumpJSON(t, "dump-hint", hints[0])
+	records := dumpJSON(t, "dump", data)
+	// 合并在末尾写入保存序列号的提交标记
+	require.Len(t, recs, 3)
+	require.Len(t, records, 3)
+	assert.Equal(t, "commit", recs[2].Type)
+	assert.Equal(t, "commit", records[2].Type)
+	for i, r := range recs[:2] {
+		assert.Equal(t, "ok", r.Status)
+		assert.Equal(t, *records[i].Key, *r.Key)
+		require.NotNil(t, r.Hint)
+		assert.Equal(t, records[i].Offset, r.Hint.RecordPos)
+		assert.Equal(t, uint32(records[i].Size), r.Hint.RecordSz)
+		assert.Equal(t, uint32(3), r.Hint.ValueSz)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/chhz0/bitcask"
+)
+
+// importBatchSize import 每个批次写入的键值对数量
+const importBatchSize = 1024
+
+// record export 输出的一行, []byte 在 JSON 中编码为 base64, 与 -key-enc 等选项无关
+type record struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// cmdExport 在快照上导出, 导出期间的写入不影响结果
+func cmdExport(c *cli, db *bitcask.Bitcask, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	out := fs.String("o", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return usageError{}
+	}
+
+	var (
+		w = c.stdout
+		f *os.File
+	)
+	if *out != "" {
+		var err error
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	snap, err := db.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	keys, err := snap.ListKeys()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, key := range keys {
+		val, err := snap.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(record{Key: key, Value: val}); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if f != nil {
+		return f.Sync()
+	}
+	return nil
+}
+
+// cmdImport 分批写入, 中途失败时已写入的批次保留
+func cmdImport(c *cli, db *bitcask.Bitcask, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	in := fs.String("i", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return usageError{}
+	}
+
+	r := c.stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	wb := bitcask.NewBatch()
+	for {
+		var rec record
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := wb.Put(rec.Key, rec.Value); err != nil {
+			return err
+		}
+		if wb.Len() >= importBatchSize {
+			if err := db.WriteBatch(wb); err != nil {
+				return err
+			}
+			wb.Reset()
+		}
+	}
+	return db.WriteBatch(wb)
+}
@@ -0,0 +1,417 @@
+// bitcask-cli 操作一个 bitcask 目录
+//
+//	bitcask-cli -dir ./data put foo bar
+//	bitcask-cli -dir ./data -read-only scan -prefix f
+//	bitcask-cli -dir ./data -key-enc hex get 666f6f
+//	bitcask-cli dump -json ./data/000000001.data
+//
+// 默认以读写模式打开并持有目录的排他锁. -read-only 持有共享锁, 可以与其他只读进程同时打开,
+// 但与读写进程(如 bitcask-server)互斥
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chhz0/bitcask"
+)
+
+// codec 键和值在命令行参数与输出中的编码
+type codec string
+
+const (
+	codecRaw    codec = "raw"
+	codecHex    codec = "hex"
+	codecBase64 codec = "base64"
+)
+
+func (c codec) decode(s string) ([]byte, error) {
+	switch c {
+	case codecRaw:
+		return []byte(s), nil
+	case codecHex:
+		return hex.DecodeString(s)
+	case codecBase64:
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return nil, fmt.Errorf("unknown encoding %q", string(c))
+}
+
+func (c codec) encode(b []byte) string {
+	switch c {
+	case codecHex:
+		return hex.EncodeToString(b)
+	case codecBase64:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return string(b)
+}
+
+func (c codec) valid() bool {
+	return c == codecRaw || c == codecHex || c == codecBase64
+}
+
+// cli 一次命令执行的上下文
+type cli struct {
+	dir      string
+	readOnly bool
+	keyEnc   codec
+	valueEnc codec
+
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+type command struct {
+	usage string
+	write bool // 是否需要写入, 用于提前拒绝 -read-only
+	run   func(c *cli, db *bitcask.Bitcask, args []string) error
+}
+
+var commands = map[string]command{
+	"get":    {"get <key>", false, cmdGet},
+	"put":    {"put <key> [value], reads the value from stdin when omitted", true, cmdPut},
+	"del":    {"del <key>...", true, cmdDel},
+	"scan":   {"scan [-prefix p] [-limit n], prints key and value separated by a tab", false, cmdScan},
+	"keys":   {"keys [-prefix p] [-limit n]", false, cmdKeys},
+	"merge":  {"merge", true, cmdMerge},
+	"stats":  {"stats", false, cmdStats},
+	"sync":   {"sync", true, cmdSync},
+	"backup": {"backup [-since backup] [-compress none|gzip|zstd] <dir|->, writes a point-in-time copy into dir, which must be new or empty, or a tar stream to stdout; -since only copies files changed after that backup", false, cmdBackup},
+	"export": {"export [-o file], writes JSON lines of base64 key and value", false, cmdExport},
+	"import": {"import [-i file], reads the output of export", true, cmdImport},
+	"shell":  {"shell [dir], interactive prompt, dir overrides -dir", false, cmdShell},
+	"verify": {"verify [-json], checks every record and index entry, exits with 1 when problems are found", false, cmdVerify},
+}
+
+var commandOrder = []string{"get", "put", "del", "scan", "keys", "merge", "stats", "sync", "backup", "export", "import", "shell", "verify"}
+
+// fileCommand 离线命令, 不通过 bitcask.Open 打开目录
+type fileCommand struct {
+	usage string
+	run   func(c *cli, args []string) error
+}
+
+var fileCommands = map[string]fileCommand{
+	"dump":      {"dump [-json] <file>, prints every record of a data file, corrupt ranges are skipped", cmdDump},
+	"dump-hint": {"dump-hint [-json] <file>, prints every record of a hint file with the position it points to", cmdDumpHint},
+	"repair":    {"repair [-json] [dir], salvages every readable record, damaged files are moved to lost+found", cmdRepair},
+	"restore":   {"restore <dir> <full backup> [incremental backup]..., rebuilds dir from a backup chain, - reads a tar stream from stdin", cmdRestore},
+}
+
+var fileCommandOrder = []string{"dump", "dump-hint", "repair", "restore"}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run 返回进程退出码
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	fs := flag.NewFlagSet("bitcask-cli", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&c.dir, "dir", ".", "bitcask data directory")
+	fs.BoolVar(&c.readOnly, "read-only", false, "open under a shared lock so other readers can open the directory too, writes are rejected")
+	keyEnc := fs.String("key-enc", "raw", "key encoding: raw, hex or base64")
+	valueEnc := fs.String("value-enc", "raw", "value encoding: raw, hex or base64")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: bitcask-cli [flags] <command> [args]\n\ncommands:\n")
+		for _, name := range commandOrder {
+			fmt.Fprintf(stderr, "  %s\n", commands[name].usage)
+		}
+		for _, name := range fileCommandOrder {
+			fmt.Fprintf(stderr, "  %s\n", fileCommands[name].usage)
+		}
+		fmt.Fprintf(stderr, "\nflags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	c.keyEnc, c.valueEnc = codec(*keyEnc), codec(*valueEnc)
+	if !c.keyEnc.valid() || !c.valueEnc.valid() {
+		fmt.Fprintln(stderr, "bitcask-cli: encoding must be raw, hex or base64")
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if fc, ok := fileCommands[fs.Arg(0)]; ok {
+		return exit(stderr, fs.Arg(0), fc.usage, fc.run(c, fs.Args()[1:]))
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "bitcask-cli: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	args = fs.Args()[1:]
+	if fs.Arg(0) == "shell" && len(args) > 0 {
+		c.dir, args = args[0], args[1:]
+	}
+	if cmd.write && c.readOnly {
+		fmt.Fprintf(stderr, "bitcask-cli: %s: %v\n", fs.Arg(0), bitcask.ErrReadOnly)
+		return 1
+	}
+
+	open := bitcask.Open
+	if c.readOnly {
+		open = bitcask.OpenReadOnly
+	}
+	db, err := open(c.dir)
+	if err != nil {
+		if errors.Is(err, bitcask.ErrDirLocked) {
+			if c.readOnly {
+				err = fmt.Errorf("%w (a writer holds the lock)", err)
+			} else {
+				err = fmt.Errorf("%w (use -read-only if the lock is held by readers only)", err)
+			}
+		}
+		fmt.Fprintf(stderr, "bitcask-cli: open %s: %v\n", c.dir, err)
+		return 1
+	}
+
+	err = cmd.run(c, db, args)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	return exit(stderr, fs.Arg(0), cmd.usage, err)
+}
+
+// exit 打印命令的错误并返回退出码
+func exit(stderr io.Writer, name, usage string, err error) int {
+	if err == nil {
+		return 0
+	}
+	var ue usageError
+	if errors.As(err, &ue) {
+		fmt.Fprintf(stderr, "usage: bitcask-cli %s\n", usage)
+		return 2
+	}
+	fmt.Fprintf(stderr, "bitcask-cli: %s: %v\n", name, err)
+	return 1
+}
+
+// usageError 参数错误, 打印命令用法
+type usageError struct{}
+
+func (usageError) Error() string { return "usage" }
+
+func (c *cli) key(s string) ([]byte, error) {
+	key, err := c.keyEnc.decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+	return key, nil
+}
+
+// parseList 解析 scan 和 keys 的参数
+func parseList(name string, args []string) (prefix string, limit int, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&prefix, "prefix", "", "")
+	fs.IntVar(&limit, "limit", 0, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return "", 0, usageError{}
+	}
+	return prefix, limit, nil
+}
+
+func cmdGet(c *cli, db *bitcask.Bitcask, args []string) error {
+	if len(args) != 1 {
+		return usageError{}
+	}
+	key, err := c.key(args[0])
+	if err != nil {
+		return err
+	}
+	val, err := db.Get(key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.stdout, c.valueEnc.encode(val))
+	return err
+}
+
+func cmdPut(c *cli, db *bitcask.Bitcask, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError{}
+	}
+	key, err := c.key(args[0])
+	if err != nil {
+		return err
+	}
+
+	var val []byte
+	if len(args) == 2 {
+		val, err = c.valueEnc.decode(args[1])
+	} else {
+		var raw []byte
+		if raw, err = io.ReadAll(c.stdin); err == nil {
+			val = raw
+			if c.valueEnc != codecRaw {
+				val, err = c.valueEnc.decode(strings.TrimSpace(string(raw)))
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("decode value: %w", err)
+	}
+	return db.Put(key, val)
+}
+
+func cmdDel(c *cli, db *bitcask.Bitcask, args []string) error {
+	if len(args) == 0 {
+		return usageError{}
+	}
+	wb := bitcask.NewBatch()
+	for _, arg := range args {
+		key, err := c.key(arg)
+		if err != nil {
+			return err
+		}
+		if err := wb.Delete(key); err != nil {
+			return err
+		}
+	}
+	return db.WriteBatch(wb)
+}
+
+func cmdScan(c *cli, db *bitcask.Bitcask, args []string) error {
+	return c.list(db, "scan", args, true)
+}
+
+func cmdKeys(c *cli, db *bitcask.Bitcask, args []string) error {
+	return c.list(db, "keys", args, false)
+}
+
+func (c *cli) list(db *bitcask.Bitcask, name string, args []string, values bool) error {
+	p, limit, err := parseList(name, args)
+	if err != nil {
+		return err
+	}
+	prefix, err := c.key(p)
+	if err != nil {
+		return err
+	}
+
+	keys, err := db.ScanKeys(prefix, nil, limit)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !values {
+			if _, err := fmt.Fprintln(c.stdout, c.keyEnc.encode(key)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		val, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(c.stdout, "%s\t%s\n", c.keyEnc.encode(key), c.valueEnc.encode(val)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdMerge(_ *cli, db *bitcask.Bitcask, args []string) error {
+	if len(args) != 0 {
+		return usageError{}
+	}
+	return db.Merge()
+}
+
+// compressions backup -compress 的取值
+var compressions = map[string]bitcask.Compression{
+	"none": bitcask.CompressionNone,
+	"gzip": bitcask.CompressionGzip,
+	"zstd": bitcask.CompressionZstd,
+}
+
+func cmdBackup(c *cli, db *bitcask.Bitcask, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	since := fs.String("since", "", "")
+	compress := fs.String("compress", "none", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return usageError{}
+	}
+	comp, ok := compressions[*compress]
+	if !ok {
+		return usageError{}
+	}
+	if fs.Arg(0) == "-" {
+		if *since != "" {
+			return usageError{}
+		}
+		return db.BackupTo(c.stdout, comp)
+	}
+	if *since == "" {
+		return db.Backup(fs.Arg(0))
+	}
+	m, err := bitcask.ReadManifest(*since)
+	if err != nil {
+		return err
+	}
+	return db.BackupIncremental(fs.Arg(0), m)
+}
+
+// cmdRestore 按顺序读取完整备份和增量备份的清单并恢复到 dir
+func cmdRestore(c *cli, args []string) error {
+	if len(args) < 2 {
+		return usageError{}
+	}
+	if args[1] == "-" {
+		if len(args) != 2 {
+			return usageError{}
+		}
+		return bitcask.RestoreFrom(c.stdin, args[0])
+	}
+	chain := make([]bitcask.Manifest, 0, len(args)-1)
+	for _, dir := range args[1:] {
+		m, err := bitcask.ReadManifest(dir)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, m)
+	}
+	return bitcask.Restore(chain, args[0])
+}
+
+func cmdSync(_ *cli, db *bitcask.Bitcask, args []string) error {
+	if len(args) != 0 {
+		return usageError{}
+	}
+	return db.Sync()
+}
+
+func cmdStats(c *cli, db *bitcask.Bitcask, args []string) error {
+	if len(args) != 0 {
+		return usageError{}
+	}
+	st, err := db.Stats()
+	if err != nil {
+		return err
+	}
+	return writeStats(c.stdout, st)
+}
+
+func writeStats(w io.Writer, st bitcask.Stats) error {
+	_, err := fmt.Fprintf(w,
+		"keys\t%d\ndata_files\t%d\ndata_size\t%d\nblob_files\t%d\nblob_size\t%d\nblob_dead\t%d\n",
+		st.Keys, st.DataFiles, st.DataSize, st.BlobFiles, st.BlobSize, st.BlobDead)
+	return err
+}
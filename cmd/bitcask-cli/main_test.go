@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chhz0/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCLI 执行命令并返回退出码和标准输出
+func runCLI(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	if code != 0 {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func TestCLI(t *testing.T) {
+	dir := t.TempDir()
+
+	code, _ := runCLI(t, "", "-dir", dir, "put", "user:1", "alice")
+	require.Equal(t, 0, code)
+	code, _ = runCLI(t, "bob", "-dir", dir, "put", "user:2")
+	require.Equal(t, 0, code)
+	code, _ = runCLI(t, "", "-dir", dir, "-key-enc", "hex", "-value-enc", "base64", "put", "6f74686572", "AAE=")
+	require.Equal(t, 0, code)
+
+	_, out := runCLI(t, "", "-dir", dir, "get", "user:2")
+	assert.Equal(t, "bob\n", out)
+	_, out = runCLI(t, "", "-dir", dir, "-value-enc", "hex", "get", "other")
+	assert.Equal(t, "0001\n", out)
+
+	_, out = runCLI(t, "", "-dir", dir, "scan", "-prefix", "user:")
+	assert.Equal(t, "user:1\talice\nuser:2\tbob\n", out)
+	_, out = runCLI(t, "", "-dir", dir, "keys", "-limit", "1")
+	assert.Equal(t, "other\n", out)
+
+	code, _ = runCLI(t, "", "-dir", dir, "del", "other", "user:1")
+	require.Equal(t, 0, code)
+	code, _ = runCLI(t, "", "-dir", dir, "get", "other")
+	assert.Equal(t, 1, code)
+
+	require.Equal(t, 0, first(runCLI(t, "", "-dir", dir, "merge")))
+	require.Equal(t, 0, first(runCLI(t, "", "-dir", dir, "sync")))
+	_, out = runCLI(t, "", "-dir", dir, "stats")
+	assert.Contains(t, out, "keys\t1\n")
+
+	backup := filepath.Join(t.TempDir(), "backup")
+	require.Equal(t, 0, first(runCLI(t, "", "-dir", dir, "backup", backup)))
+	_, out = runCLI(t, "", "-dir", backup, "get", "user:2")
+	assert.Equal(t, "bob\n", out)
+
+	require.Equal(t, 0, first(runCLI(t, "", "-dir", dir, "put", "user:3", "carol")))
+	inc := filepath.Join(t.TempDir(), "inc")
+	require.Equal(t, 0, first(runCLI(t, "", "-dir", dir, "backup", "-since", backup, inc)))
+	restored := filepath.Join(t.TempDir(), "restored")
+	require.Equal(t, 0, first(runCLI(t, "", "restore", restored, backup, inc)))
+	_, out = runCLI(t, "", "-dir", restored, "get", "user:3")
+	assert.Equal(t, "carol\n", out)
+
+	code, archive := runCLI(t, "", "-dir", dir, "backup", "-compress", "zstd", "-")
+	require.Equal(t, 0, code)
+	restored = filepath.Join(t.TempDir(), "restored")
+	require.Equal(t, 0, first(runCLI(t, archive, "restore", restored, "-")))
+	_, out = runCLI(t, "", "-dir", restored, "get", "user:3")
+	assert.Equal(t, "carol\n", out)
+
+	assert.Equal(t, 2, first(runCLI(t, "", "-dir", dir, "get")))
+	assert.Equal(t, 2, first(runCLI(t, "", "-dir", dir, "nope")))
+}
+
+func TestCLI_Lock(t *testing.T) {
+	dir := t.TempDir()
+	db, err := bitcask.Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, db.Put([]byte("k"), []byte("v")))
+
+	// 写入方持有排他锁时只读打开也被拒绝
+	assert.Equal(t, 1, first(runCLI(t, "", "-dir", dir, "get", "k")))
+	assert.Equal(t, 1, first(runCLI(t, "", "-dir", dir, "-read-only", "get", "k")))
+	require.NoError(t, db.Close())
+
+	// 只读实例之间共享锁, 但排斥写入方
+	ro, err := bitcask.OpenReadOnly(dir)
+	require.NoError(t, err)
+	defer ro.Close()
+	code, out := runCLI(t, "", "-dir", dir, "-read-only", "get", "k")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "v\n", out)
+	assert.Equal(t, 1, first(runCLI(t, "", "-dir", dir, "get", "k")))
+	assert.Equal(t, 1, first(runCLI(t, "", "-dir", dir, "-read-only", "put", "k", "x")))
+}
+
+func TestCLI_ExportImport(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, kv := range [][2]string{{"a", "1"}, {"b", "\x00\xff"}, {"c", ""}} {
+		require.Equal(t, 0, first(runCLI(t, "", "-dir", src, "put", kv[0], kv[1])))
+	}
+
+	file := filepath.Join(t.TempDir(), "dump.jsonl")
+	require.Equal(t, 0, first(runCLI(t, "", "-dir", src, "export", "-o", file)))
+	require.Equal(t, 0, first(runCLI(t, "", "-dir", dst, "import", "-i", file)))
+
+	_, want := runCLI(t, "", "-dir", src, "-value-enc", "hex", "scan")
+	_, got := runCLI(t, "", "-dir", dst, "-value-enc", "hex", "scan")
+	assert.Equal(t, want, got)
+	assert.Equal(t, "a\t31\nb\t00ff\nc\t\n", got)
+
+	// 标准输入输出
+	_, dump := runCLI(t, "", "-dir", src, "export")
+	other := t.TempDir()
+	require.Equal(t, 0, first(runCLI(t, dump, "-dir", other, "import")))
+	_, got = runCLI(t, "", "-dir", other, "-value-enc", "hex", "scan")
+	assert.Equal(t, want, got)
+}
+
+func first(code int, _ string) int {
+	return code
+}
+
+func TestCLI_Verify(t *testing.T) {
+	dir := t.TempDir()
+	db, err := bitcask.Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, db.Put([]byte("a"), []byte("1")))
+	require.NoError(t, db.Put([]byte("b"), []byte("2")))
+	require.NoError(t, db.Close())
+
+	code, out := runCLI(t, "", "-dir", dir, "verify")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "records\t2\n")
+
+	// 篡改最后一条记录, 加载时被当作未写完的记录忽略, verify 报告损坏的区间
+	file := filepath.Join(dir, "000000001.data")
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(file, data, 0o644))
+
+	code, out = runCLI(t, "", "-dir", dir, "verify", "-json")
+	assert.Equal(t, 1, code)
+	var report verifyJSON
+	require.NoError(t, json.Unmarshal([]byte(out), &report))
+	assert.False(t, report.OK)
+	assert.Empty(t, report.Unreadable)
+	require.Len(t, report.Corrupt, 1)
+	assert.Equal(t, "000000001.data", report.Corrupt[0].File)
+	assert.Equal(t, 1, report.Records)
+
+	_, out = runCLI(t, "", "-dir", dir, "get", "b")
+	assert.Empty(t, out)
+}
+
+func TestCLI_Repair(t *testing.T) {
+	dir := t.TempDir()
+	db, err := bitcask.Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, db.Put([]byte("a"), []byte("1")))
+	require.NoError(t, db.Put([]byte("b"), []byte("2")))
+	require.NoError(t, db.Close())
+
+	// 篡改第一条记录的值, 损坏的记录位于文件中间, 目录无法打开
+	file := filepath.Join(dir, "000000001.data")
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	data[bytes.Index(data, []byte("a1"))+1] ^= 0xff
+	require.NoError(t, os.WriteFile(file, data, 0o644))
+
+	code, _ := runCLI(t, "", "-dir", dir, "get", "b")
+	assert.Equal(t, 1, code)
+
+	code, out := runCLI(t, "", "repair", "-json", dir)
+	require.Equal(t, 0, code)
+	var report repairJSON
+	require.NoError(t, json.Unmarshal([]byte(out), &report))
+	assert.Equal(t, 1, report.Records)
+	assert.Equal(t, []string{"000000001.data"}, report.Rewritten)
+	assert.Equal(t, []string{"a"}, report.Lost)
+	assert.Empty(t, report.RolledBack)
+	require.Len(t, report.Corrupt, 1)
+	require.Len(t, report.Quarantined, 1)
+	assert.FileExists(t, filepath.Join(dir, report.Quarantined[0]))
+
+	code, out = runCLI(t, "", "-dir", dir, "get", "b")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "2\n", out)
+
+	code, out = runCLI(t, "", "-dir", dir, "repair")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "records\t0\n", out)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/chhz0/bitcask"
+)
+
+// repairJSON repair -json 的输出, 键按 -key-enc 编码
+type repairJSON struct {
+	Records     int           `json:"records"`
+	Rewritten   []string      `json:"rewritten"`
+	Hints       []string      `json:"hints"`
+	Quarantined []string      `json:"quarantined"`
+	Corrupt     []corruptJSON `json:"corrupt"`
+	Lost        []string      `json:"lost"`
+	RolledBack  []string      `json:"rolled_back"`
+}
+
+// cmdRepair 修复数据目录, 目录默认为 -dir, 不能被其他进程打开
+func cmdRepair(c *cli, args []string) error {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := fs.Bool("json", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return usageError{}
+	}
+	dir := c.dir
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+
+	r, err := bitcask.Repair(dir)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return c.writeRepairJSON(r)
+	}
+	return c.writeRepair(r)
+}
+
+func (c *cli) writeRepair(r bitcask.RepairReport) error {
+	w := c.stdout
+	fmt.Fprintf(w, "records\t%d\n", r.Records)
+	for _, name := range r.Rewritten {
+		fmt.Fprintf(w, "rewritten\t%s\n", name)
+	}
+	for _, name := range r.Hints {
+		fmt.Fprintf(w, "hint\t%s\n", name)
+	}
+	for _, name := range r.Quarantined {
+		fmt.Fprintf(w, "quarantined\t%s\n", name)
+	}
+	for _, cr := range r.Corrupt {
+		fmt.Fprintf(w, "corrupt\t%s\t%d\t%d\t%v\n", cr.File, cr.Offset, cr.Size, cr.Err)
+	}
+	for _, key := range r.Lost {
+		fmt.Fprintf(w, "lost\t%s\n", c.keyEnc.encode(key))
+	}
+	for _, key := range r.RolledBack {
+		if _, err := fmt.Fprintf(w, "rolled-back\t%s\n", c.keyEnc.encode(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cli) writeRepairJSON(r bitcask.RepairReport) error {
+	out := repairJSON{
+		Records:     r.Records,
+		Rewritten:   append([]string{}, r.Rewritten...),
+		Hints:       append([]string{}, r.Hints...),
+		Quarantined: append([]string{}, r.Quarantined...),
+		Corrupt:     []corruptJSON{},
+		Lost:        []string{},
+		RolledBack:  []string{},
+	}
+	for _, cr := range r.Corrupt {
+		out.Corrupt = append(out.Corrupt, corruptJSON{File: cr.File, Offset: cr.Offset, Size: cr.Size, Err: cr.Err.Error()})
+	}
+	for _, key := range r.Lost {
+		out.Lost = append(out.Lost, c.keyEnc.encode(key))
+	}
+	for _, key := range r.RolledBack {
+		out.RolledBack = append(out.RolledBack, c.keyEnc.encode(key))
+	}
+
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
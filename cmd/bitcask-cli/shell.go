@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chhz0/bitcask"
+	"golang.org/x/term"
+)
+
+// completeLimit 补全键时最多列出的候选数量
+const completeLimit = 64
+
+type shellCommand struct {
+	usage string
+	run   func(s *shell, args [][]byte) error
+}
+
+var shellCommands map[string]shellCommand
+
+func init() {
+	shellCommands = map[string]shellCommand{
+		"get":      {"get <key>", (*shell).get},
+		"put":      {"put <key> <value>", (*shell).put},
+		"del":      {"del <key>...", (*shell).del},
+		"scan":     {"scan [prefix] [limit]", (*shell).scan},
+		"keys":     {"keys [prefix] [limit]", (*shell).keys},
+		"stats":    {"stats", (*shell).stats},
+		"sync":     {"sync", (*shell).sync},
+		"merge":    {"merge", (*shell).merge},
+		"begin":    {"begin, starts a transaction for get, put and del", (*shell).begin},
+		"commit":   {"commit", (*shell).commit},
+		"rollback": {"rollback", (*shell).rollback},
+		"help":     {"help", (*shell).help},
+		"exit":     {"exit", nil},
+	}
+}
+
+// shell 交互式会话, 参数支持双引号字符串和 Go 风格的转义
+type shell struct {
+	c   *cli
+	db  *bitcask.Bitcask
+	txn *bitcask.Txn
+	out io.Writer
+}
+
+// cmdShell 终端中使用行编辑(历史记录和 Tab 补全), 否则逐行执行标准输入
+func cmdShell(c *cli, db *bitcask.Bitcask, args []string) error {
+	if len(args) > 0 {
+		return usageError{}
+	}
+	s := &shell{c: c, db: db, out: c.stdout}
+	defer func() {
+		if s.txn != nil {
+			_ = s.txn.Rollback()
+		}
+	}()
+
+	if f, ok := c.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		return s.interactive(f)
+	}
+
+	sc := bufio.NewScanner(c.stdin)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		if s.exec(sc.Text()) {
+			return nil
+		}
+	}
+	return sc.Err()
+}
+
+func (s *shell) interactive(f *os.File) error {
+	state, err := term.MakeRaw(int(f.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(f.Fd()), state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{f, s.c.stdout}, s.prompt())
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return s.complete(t, line, pos)
+	}
+	s.out = t
+
+	for {
+		line, err := t.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s.exec(line) {
+			return nil
+		}
+		t.SetPrompt(s.prompt())
+	}
+}
+
+func (s *shell) prompt() string {
+	if s.txn != nil {
+		return "bitcask(txn)> "
+	}
+	return "bitcask> "
+}
+
+// exec 执行一行命令, 返回是否退出
+func (s *shell) exec(line string) bool {
+	words, err := splitWords(line)
+	if err != nil {
+		fmt.Fprintf(s.out, "error: %v\n", err)
+		return false
+	}
+	if len(words) == 0 {
+		return false
+	}
+
+	name := strings.ToLower(words[0])
+	if name == "exit" || name == "quit" {
+		return true
+	}
+	cmd, ok := shellCommands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command %q, type help for a list\n", words[0])
+		return false
+	}
+
+	args := make([][]byte, 0, len(words)-1)
+	for _, w := range words[1:] {
+		args = append(args, []byte(w))
+	}
+	if err := cmd.run(s, args); err != nil {
+		if errors.As(err, new(usageError)) {
+			fmt.Fprintf(s.out, "usage: %s\n", cmd.usage)
+		} else {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+	return false
+}
+
+// splitWords 按空白切分, 双引号中的内容按 Go 字符串字面量解析
+func splitWords(line string) ([]string, error) {
+	var words []string
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			return words, nil
+		}
+
+		if line[0] != '"' {
+			end := strings.IndexFunc(line, unicode.IsSpace)
+			if end < 0 {
+				end = len(line)
+			}
+			words = append(words, line[:end])
+			line = line[end:]
+			continue
+		}
+
+		quoted, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			return nil, fmt.Errorf("unterminated quoted string")
+		}
+		word, _ := strconv.Unquote(quoted)
+		words = append(words, word)
+		line = line[len(quoted):]
+	}
+}
+
+// complete 第一个词补全命令, 之后补全键, 多个候选时补全公共前缀并列出候选
+func (s *shell) complete(t *term.Terminal, line string, pos int) (string, int, bool) {
+	head := line[:pos]
+	start := strings.LastIndexFunc(head, unicode.IsSpace) + 1
+	word := head[start:]
+	if strings.HasPrefix(word, `"`) {
+		return "", 0, false
+	}
+
+	var cands []string
+	if strings.TrimSpace(head[:start]) == "" {
+		for name := range shellCommands {
+			if strings.HasPrefix(name, word) {
+				cands = append(cands, name)
+			}
+		}
+	} else {
+		prefix, err := s.c.keyEnc.decode(word)
+		if err != nil {
+			return "", 0, false
+		}
+		keys, err := s.db.ScanKeys(prefix, nil, completeLimit)
+		if err != nil {
+			return "", 0, false
+		}
+		for _, key := range keys {
+			cands = append(cands, s.c.keyEnc.encode(key))
+		}
+	}
+	if len(cands) == 0 {
+		return "", 0, false
+	}
+
+	common := cands[0]
+	for _, cand := range cands[1:] {
+		for !strings.HasPrefix(cand, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(cands) == 1 {
+		common += " "
+	}
+	if len(common) == len(word) {
+		if len(cands) > completeLimit-1 {
+			cands = append(cands[:completeLimit-1], "...")
+		}
+		fmt.Fprintln(t, strings.Join(cands, "  "))
+		return "", 0, false
+	}
+
+	newLine := head[:start] + common + line[pos:]
+	return newLine, start + len(common), true
+}
+
+func (s *shell) key(arg []byte) ([]byte, error) {
+	return s.c.key(string(arg))
+}
+
+func (s *shell) get(args [][]byte) error {
+	if len(args) != 1 {
+		return usageError{}
+	}
+	key, err := s.key(args[0])
+	if err != nil {
+		return err
+	}
+
+	var val []byte
+	if s.txn != nil {
+		val, err = s.txn.Get(key)
+	} else {
+		val, err = s.db.Get(key)
+	}
+	if err != nil {
+		return err
+	}
+	printValue(s.out, val)
+	return nil
+}
+
+func (s *shell) put(args [][]byte) error {
+	if len(args) != 2 {
+		return usageError{}
+	}
+	key, err := s.key(args[0])
+	if err != nil {
+		return err
+	}
+	val, err := s.c.valueEnc.decode(string(args[1]))
+	if err != nil {
+		return fmt.Errorf("decode value: %w", err)
+	}
+
+	if s.txn != nil {
+		return s.txn.Put(key, val)
+	}
+	return s.db.Put(key, val)
+}
+
+func (s *shell) del(args [][]byte) error {
+	if len(args) == 0 {
+		return usageError{}
+	}
+	for _, arg := range args {
+		key, err := s.key(arg)
+		if err != nil {
+			return err
+		}
+		if s.txn != nil {
+			err = s.txn.Delete(key)
+		} else {
+			err = s.db.Delete(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shell) scan(args [][]byte) error {
+	return s.list(args, true)
+}
+
+func (s *shell) keys(args [][]byte) error {
+	return s.list(args, false)
+}
+
+// list 读取已提交的数据, 不包含事务中未提交的写入
+func (s *shell) list(args [][]byte, values bool) error {
+	if len(args) > 2 {
+		return usageError{}
+	}
+	var (
+		prefix []byte
+		limit  int
+		err    error
+	)
+	if len(args) > 0 {
+		if prefix, err = s.key(args[0]); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		if limit, err = strconv.Atoi(string(args[1])); err != nil {
+			return usageError{}
+		}
+	}
+
+	keys, err := s.db.ScanKeys(prefix, nil, limit)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !values {
+			fmt.Fprintln(s.out, s.c.keyEnc.encode(key))
+			continue
+		}
+		val, err := s.db.Get(key)
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "%s => ", s.c.keyEnc.encode(key))
+		printValue(s.out, val)
+	}
+	return nil
+}
+
+func (s *shell) stats(args [][]byte) error {
+	if len(args) != 0 {
+		return usageError{}
+	}
+	st, err := s.db.Stats()
+	if err != nil {
+		return err
+	}
+	return writeStats(s.out, st)
+}
+
+func (s *shell) sync(args [][]byte) error {
+	return cmdSync(s.c, s.db, strArgs(args))
+}
+
+func (s *shell) merge(args [][]byte) error {
+	return cmdMerge(s.c, s.db, strArgs(args))
+}
+
+func (s *shell) begin(args [][]byte) error {
+	if len(args) != 0 {
+		return usageError{}
+	}
+	if s.txn != nil {
+		return errors.New("transaction already in progress")
+	}
+	txn, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	s.txn = txn
+	return nil
+}
+
+// commit 无论成功与否都结束当前事务
+func (s *shell) commit(args [][]byte) error {
+	if len(args) != 0 {
+		return usageError{}
+	}
+	if s.txn == nil {
+		return errors.New("no transaction in progress")
+	}
+	txn := s.txn
+	s.txn = nil
+	return txn.Commit()
+}
+
+func (s *shell) rollback(args [][]byte) error {
+	if len(args) != 0 {
+		return usageError{}
+	}
+	if s.txn == nil {
+		return errors.New("no transaction in progress")
+	}
+	txn := s.txn
+	s.txn = nil
+	return txn.Rollback()
+}
+
+func (s *shell) help([][]byte) error {
+	fmt.Fprintln(s.out, "commands:")
+	for _, name := range []string{"get", "put", "del", "scan", "keys", "stats", "sync", "merge", "begin", "commit", "rollback", "help", "exit"} {
+		fmt.Fprintf(s.out, "  %s\n", shellCommands[name].usage)
+	}
+	fmt.Fprintln(s.out, `arguments may be double-quoted with Go escapes, e.g. put "a key" "line\n"`)
+	return nil
+}
+
+func strArgs(args [][]byte) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = string(arg)
+	}
+	return out
+}
+
+// printValue JSON 缩进输出, 可打印的 UTF-8 原样输出, 其余以十六进制转储
+func printValue(w io.Writer, val []byte) {
+	trimmed := bytes.TrimSpace(val)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		var buf bytes.Buffer
+		if json.Indent(&buf, trimmed, "", "  ") == nil {
+			fmt.Fprintln(w, buf.String())
+			return
+		}
+	}
+	if utf8.Valid(val) && isPrintable(string(val)) {
+		fmt.Fprintln(w, string(val))
+		return
+	}
+	fmt.Fprint(w, hex.Dump(val))
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/chhz0/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/term"
+)
+
+func TestShell(t *testing.T) {
+	dir := t.TempDir()
+	script := strings.Join([]string{
+		`put user:1 {"name":"alice","age":30}`,
+		`put "a key" "line one\nline two"`,
+		`put bin "\x00\x01\xff"`,
+		`get user:1`,
+		`get "a key"`,
+		`get bin`,
+		`begin`,
+		`put user:2 bob`,
+		`del user:1`,
+		`get user:2`,
+		`rollback`,
+		`get user:2`,
+		`begin`,
+		`put user:2 bob`,
+		`commit`,
+		`keys user:`,
+		`nope`,
+		`exit`,
+		`get never`,
+	}, "\n")
+
+	code, out := runCLI(t, script, "shell", dir)
+	require.Equal(t, 0, code)
+	assert.Equal(t, strings.Join([]string{
+		"{",
+		`  "name": "alice",`,
+		`  "age": 30`,
+		"}",
+		"line one",
+		"line two",
+		"00000000  00 01 ff                                          |...|",
+		"bob",
+		"error: key not found.",
+		"user:1",
+		"user:2",
+		`unknown command "nope", type help for a list`,
+		"",
+	}, "\n"), out)
+
+	db, err := bitcask.Open(dir)
+	require.NoError(t, err)
+	defer db.Close()
+	val, err := db.Get([]byte("user:2"))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", string(val))
+}
+
+func TestShell_Complete(t *testing.T) {
+	db, err := bitcask.Open(t.TempDir())
+	require.NoError(t, err)
+	defer db.Close()
+	for _, key := range []string{"user:alice", "user:bob", "order:1"} {
+		require.NoError(t, db.Put([]byte(key), []byte("v")))
+	}
+
+	var out bytes.Buffer
+	s := &shell{c: &cli{keyEnc: codecRaw, valueEnc: codecRaw}, db: db}
+	tm := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(""), &out}, "")
+
+	line, pos, ok := s.complete(tm, "ro", 2)
+	require.True(t, ok)
+	assert.Equal(t, "rollback ", line)
+	assert.Equal(t, len(line), pos)
+
+	line, _, ok = s.complete(tm, "get o", 5)
+	require.True(t, ok)
+	assert.Equal(t, "get order:1 ", line)
+
+	// 多个候选时先补全公共前缀, 再次补全时列出候选
+	line, _, ok = s.complete(tm, "get u", 5)
+	require.True(t, ok)
+	assert.Equal(t, "get user:", line)
+	_, _, ok = s.complete(tm, line, len(line))
+	assert.False(t, ok)
+	assert.Contains(t, out.String(), "user:alice  user:bob")
+}
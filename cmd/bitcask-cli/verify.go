@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/chhz0/bitcask"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+var errVerifyFailed = errors.New("integrity check found problems")
+
+// verifyJSON verify -json 的输出, 错误转换为文本, 键按 -key-enc 编码
+type verifyJSON struct {
+	OK          bool             `json:"ok"`
+	Files       int              `json:"files"`
+	Records     int              `json:"records"`
+	Bytes       int64            `json:"bytes"`
+	Corrupt     []corruptJSON    `json:"corrupt"`
+	OrphanHints []orphanJSON     `json:"orphan_hints"`
+	Unreadable  []unreadableJSON `json:"unreadable"`
+}
+
+type corruptJSON struct {
+	File   string `json:"file"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Err    string `json:"error"`
+}
+
+type orphanJSON struct {
+	File      string `json:"file"`
+	Key       string `json:"key"`
+	RecordPos int64  `json:"record_pos"`
+	RecordSz  uint32 `json:"record_sz"`
+}
+
+type unreadableJSON struct {
+	Key  string `json:"key"`
+	File string `json:"file"`
+	Pos  int64  `json:"pos"`
+	Err  string `json:"error"`
+}
+
+// cmdVerify 发现问题时输出报告并以退出码 1 结束
+func cmdVerify(c *cli, db *bitcask.Bitcask, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := fs.Bool("json", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return usageError{}
+	}
+
+	r, err := db.Verify(context.Background())
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		err = c.writeVerifyJSON(r)
+	} else {
+		err = c.writeVerify(r)
+	}
+	if err != nil {
+		return err
+	}
+	if !r.OK() {
+		return errVerifyFailed
+	}
+	return nil
+}
+
+func (c *cli) writeVerify(r bitcask.VerifyReport) error {
+	w := c.stdout
+	fmt.Fprintf(w, "files\t%d\nrecords\t%d\nbytes\t%d\n", r.Files, r.Records, r.Bytes)
+	for _, cr := range r.Corrupt {
+		fmt.Fprintf(w, "corrupt\t%s\t%d\t%d\t%v\n", cr.File, cr.Offset, cr.Size, cr.Err)
+	}
+	for _, h := range r.OrphanHints {
+		fmt.Fprintf(w, "orphan-hint\t%s\t%d\t%d\t%s\n", hintName(h.FileID), h.RecordPos, h.RecordSz, c.keyEnc.encode(h.Key))
+	}
+	for _, k := range r.Unreadable {
+		_, err := fmt.Fprintf(w, "unreadable\t%s\t%d\t%v\t%s\n", keyFileName(k), k.Pos, k.Err, c.keyEnc.encode(k.Key))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cli) writeVerifyJSON(r bitcask.VerifyReport) error {
+	out := verifyJSON{
+		OK:          r.OK(),
+		Files:       r.Files,
+		Records:     r.Records,
+		Bytes:       r.Bytes,
+		Corrupt:     []corruptJSON{},
+		OrphanHints: []orphanJSON{},
+		Unreadable:  []unreadableJSON{},
+	}
+	for _, cr := range r.Corrupt {
+		out.Corrupt = append(out.Corrupt, corruptJSON{File: cr.File, Offset: cr.Offset, Size: cr.Size, Err: cr.Err.Error()})
+	}
+	for _, h := range r.OrphanHints {
+		out.OrphanHints = append(out.OrphanHints, orphanJSON{
+			File: hintName(h.FileID), Key: c.keyEnc.encode(h.Key), RecordPos: h.RecordPos, RecordSz: h.RecordSz,
+		})
+	}
+	for _, k := range r.Unreadable {
+		out.Unreadable = append(out.Unreadable, unreadableJSON{
+			Key: c.keyEnc.encode(k.Key), File: keyFileName(k), Pos: k.Pos, Err: k.Err.Error(),
+		})
+	}
+
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func hintName(id uint32) string {
+	return datafile.Name("", id, datafile.HintExt)
+}
+
+// keyFileName 返回无法读取的键所在的文件名
+func keyFileName(k bitcask.UnreadableKey) string {
+	if k.Blob {
+		return datafile.Name("", k.FileID, datafile.BlobExt)
+	}
+	return datafile.Name("", k.FileID, datafile.DataExt)
+}
@@ -0,0 +1,163 @@
+// bitcask-server 通过 Redis 协议, HTTP/JSON, gRPC 和 memcached 协议提供 bitcask 目录的访问
+//
+//	bitcask-server -dir ./data -addr 127.0.0.1:6379 -http 127.0.0.1:8080 -grpc 127.0.0.1:9090 -memcache 127.0.0.1:11211
+//	redis-cli -p 6379 set foo bar
+//	curl http://127.0.0.1:8080/kv/foo
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	nethttp "net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/chhz0/bitcask"
+	bitcaskgrpc "github.com/chhz0/bitcask/server/grpc"
+	"github.com/chhz0/bitcask/server/http"
+	"github.com/chhz0/bitcask/server/memcache"
+	"github.com/chhz0/bitcask/server/resp"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	var (
+		dir      = flag.String("dir", "./data", "bitcask data directory")
+		addr     = flag.String("addr", "127.0.0.1:6379", "RESP listen address, empty to disable")
+		httpAddr = flag.String("http", "", "HTTP listen address, empty to disable")
+		grpcAddr = flag.String("grpc", "", "gRPC listen address, empty to disable")
+		mcAddr   = flag.String("memcache", "", "memcached listen address, empty to disable")
+		backups  = flag.String("backup-dir", "", "directory for backups requested over gRPC, empty to disable the Backup RPC")
+		readOnly = flag.Bool("read-only", false, "open the directory in read-only mode")
+		sync     = flag.Bool("sync", false, "sync every write to disk")
+
+		scrubInterval = flag.Duration("scrub-interval", 0, "verify all files in the background at this interval, 0 to disable")
+		scrubRate     = flag.Int64("scrub-rate", 0, "background verification read limit in bytes per second, 0 for unlimited")
+	)
+	flag.Parse()
+
+	if *addr == "" && *httpAddr == "" && *grpcAddr == "" && *mcAddr == "" {
+		log.Fatal("at least one of -addr, -http, -grpc and -memcache is required")
+	}
+
+	open := bitcask.Open
+	if *readOnly {
+		open = bitcask.OpenReadOnly
+	}
+	db, err := open(*dir, bitcask.WithSyncOnWrite(*sync))
+	if err != nil {
+		log.Fatalf("open %s: %v", *dir, err)
+	}
+
+	var (
+		rs   *resp.Server
+		hs   *nethttp.Server
+		gs   *grpc.Server
+		ms   *memcache.Server
+		errc = make(chan error, 4)
+	)
+	if *addr != "" {
+		ln, err := net.Listen("tcp", *addr)
+		if err != nil {
+			_ = db.Close()
+			log.Fatalf("listen %s: %v", *addr, err)
+		}
+		rs = resp.NewServer(db)
+		log.Printf("serving RESP on %s", ln.Addr())
+		go func() { errc <- rs.Serve(ln) }()
+	}
+	if *httpAddr != "" {
+		hs = &nethttp.Server{Addr: *httpAddr, Handler: http.NewServer(db)}
+		log.Printf("serving HTTP on %s", *httpAddr)
+		go func() {
+			if err := hs.ListenAndServe(); !errors.Is(err, nethttp.ErrServerClosed) {
+				errc <- err
+			}
+		}()
+	}
+
+	if *grpcAddr != "" {
+		ln, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			_ = db.Close()
+			log.Fatalf("listen %s: %v", *grpcAddr, err)
+		}
+		gs = grpc.NewServer()
+		bitcaskgrpc.NewServer(db, bitcaskgrpc.WithBackupDir(*backups)).Register(gs)
+		log.Printf("serving gRPC on %s", ln.Addr())
+		go func() { errc <- gs.Serve(ln) }()
+	}
+	if *mcAddr != "" {
+		ln, err := net.Listen("tcp", *mcAddr)
+		if err != nil {
+			_ = db.Close()
+			log.Fatalf("listen %s: %v", *mcAddr, err)
+		}
+		ms = memcache.NewServer(db)
+		log.Printf("serving memcached on %s", ln.Addr())
+		go func() { errc <- ms.Serve(ln) }()
+	}
+
+	scrubCtx, stopScrub := context.WithCancel(context.Background())
+	if *scrubInterval > 0 {
+		go func() {
+			_ = db.Scrub(scrubCtx, bitcask.ScrubOptions{
+				Interval:  *scrubInterval,
+				RateLimit: *scrubRate,
+				OnReport:  logScrub,
+			})
+		}()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sig:
+	case err := <-errc:
+		if err != nil {
+			log.Printf("serve: %v", err)
+		}
+	}
+
+	stopScrub()
+	if rs != nil {
+		_ = rs.Close()
+	}
+	if hs != nil {
+		_ = hs.Shutdown(context.Background())
+	}
+	if gs != nil {
+		// Watch 流不会自行结束, 不能等待其完成
+		gs.Stop()
+	}
+	if ms != nil {
+		_ = ms.Close()
+	}
+	if err := db.Close(); err != nil {
+		log.Fatalf("close: %v", err)
+	}
+}
+
+func logScrub(r bitcask.VerifyReport, err error) {
+	if err != nil {
+		log.Printf("scrub: %v", err)
+		return
+	}
+	if r.OK() {
+		log.Printf("scrub: %d files, %d records, %d bytes ok", r.Files, r.Records, r.Bytes)
+		return
+	}
+	for _, c := range r.Corrupt {
+		log.Printf("scrub: %s: corrupt range at %d (%d bytes): %v", c.File, c.Offset, c.Size, c.Err)
+	}
+	for _, h := range r.OrphanHints {
+		log.Printf("scrub: hint file %d: %q points to missing record at %d", h.FileID, h.Key, h.RecordPos)
+	}
+	for _, k := range r.Unreadable {
+		log.Printf("scrub: key %q is unreadable: %v", k.Key, k.Err)
+	}
+}
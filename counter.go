@@ -0,0 +1,99 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+)
+
+// counterSize TypeCounter 记录的值大小
+const counterSize = 8
+
+// Incr 将 key 对应的整数加上 delta 并返回新值, key 不存在时视为 0
+//
+// 当前值必须是十进制整数文本或计数器记录, 否则返回 ErrNotCounter.
+// 读取和写入在写锁内完成, 保留 key 原有的过期时间
+func (b *Bitcask) Incr(key []byte, delta int64) (int64, error) {
+	if err := checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	return b.incr(key, delta)
+}
+
+// Decr 将 key 对应的整数减去 delta 并返回新值
+func (b *Bitcask) Decr(key []byte, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrCounterOverflow
+	}
+	return b.Incr(key, -delta)
+}
+
+func (b *Bitcask) incr(key []byte, delta int64) (int64, error) {
+	var cur, expiry int64
+	if entry, ok := lookup(b.keydir, key); ok {
+		expiry = entry.Expiry
+		val, err := b.readValue(key, entry)
+		if err != nil {
+			return 0, err
+		}
+		if cur, err = strconv.ParseInt(string(val), 10, 64); err != nil {
+			return 0, ErrNotCounter
+		}
+	}
+
+	n := cur + delta
+	if (delta > 0 && n < cur) || (delta < 0 && n > cur) {
+		return 0, ErrCounterOverflow
+	}
+
+	if !b.options.CompactCounter {
+		return n, b.put(key, strconv.AppendInt(nil, n, 10), expiry)
+	}
+
+	val := make([]byte, counterSize)
+	binary.BigEndian.PutUint64(val, uint64(n))
+	entry, err := b.writeEntry(&internal.Entry{
+		Type:   internal.TypeCounter,
+		Tstamp: time.Now().Unix(),
+		Expiry: expiry,
+		Key:    key,
+		Val:    val,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if old, ok := b.keydir.Put(bytes.Clone(key), entry); ok {
+		b.blobs.release(key, old)
+	}
+	b.watch.publish(OpPut, key, strconv.AppendInt(nil, n, 10), entry)
+	return n, nil
+}
+
+// readCounter 读取计数器记录, 返回十进制文本
+func (b *Bitcask) readCounter(entry *internal.KeydirEntry) ([]byte, error) {
+	df, ok := b.files[entry.FileID]
+	if !ok {
+		return nil, ErrDataFileNotFound
+	}
+
+	e, err := df.Read(entry.RecordPos, entry.RecordSz)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Val) != counterSize {
+		return nil, ErrNotCounter
+	}
+	return strconv.AppendInt(nil, int64(binary.BigEndian.Uint64(e.Val)), 10), nil
+}
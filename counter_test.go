@@ -0,0 +1,76 @@
+package bitcask
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitcask_Incr(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		t.Run(map[bool]string{false: "text", true: "compact"}[compact], func(t *testing.T) {
+			dir := t.TempDir()
+			b, err := Open(dir, WithCompactCounter(compact))
+			require.NoError(t, err)
+
+			n, err := b.Incr([]byte("c"), 5)
+			require.NoError(t, err)
+			assert.Equal(t, int64(5), n, "Missing key should count from zero")
+
+			n, err = b.Decr([]byte("c"), 7)
+			require.NoError(t, err)
+			assert.Equal(t, int64(-2), n)
+
+			val, err := b.Get([]byte("c"))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("-2"), val, "Counters should read as decimal text")
+
+			require.NoError(t, b.Put([]byte("p"), []byte("40")))
+			n, err = b.Incr([]byte("p"), 2)
+			require.NoError(t, err)
+			assert.Equal(t, int64(42), n)
+
+			require.NoError(t, b.Put([]byte("s"), []byte("abc")))
+			_, err = b.Incr([]byte("s"), 1)
+			assert.ErrorIs(t, err, ErrNotCounter)
+
+			require.NoError(t, b.Put([]byte("max"), []byte("9223372036854775807")))
+			_, err = b.Incr([]byte("max"), 1)
+			assert.ErrorIs(t, err, ErrCounterOverflow)
+			_, err = b.Decr([]byte("c"), math.MinInt64)
+			assert.ErrorIs(t, err, ErrCounterOverflow)
+
+			require.NoError(t, b.Merge())
+			require.NoError(t, b.Close())
+
+			b = openTestBitcask(t, dir)
+			val, err = b.Get([]byte("c"))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("-2"), val, "Counters should survive merge and reopen")
+		})
+	}
+}
+
+func TestBitcask_IncrConcurrent(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir(), WithCompactCounter(true))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := b.Incr([]byte("hits"), 1)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := b.Get([]byte("hits"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("800"), val)
+}
@@ -1,7 +1,44 @@
 package bitcask
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/chhz0/bitcask/internal/codec"
+)
 
 var (
-	ErrCheckOrMkdir = errors.New("check or mkdir error")
+	ErrCheckOrMkdir       = errors.New("check or mkdir error")
+	ErrDirLocked          = errors.New("directory is locked by another process.")
+	ErrClosed             = errors.New("bitcask is closed.")
+	ErrReadOnly           = errors.New("bitcask is opened in read-only mode.")
+	ErrKeyEmpty           = errors.New("key is empty.")
+	ErrKeyTooLarge        = errors.New("key is too large.")
+	ErrValueTooLarge      = errors.New("value is too large.")
+	ErrKeyNotFound        = errors.New("key not found.")
+	ErrDataFileNotFound   = errors.New("data file not found.")
+	ErrMergeInProgress    = errors.New("merge is in progress.")
+	ErrInvalidHint        = errors.New("invalid hint record.")
+	ErrInvalidBlobPtr     = errors.New("invalid blob pointer.")
+	ErrInvalidRange       = errors.New("invalid value range.")
+	ErrTxnConflict        = errors.New("transaction conflict.")
+	ErrTxnClosed          = errors.New("transaction is already committed or rolled back.")
+	ErrSnapshotReleased   = errors.New("snapshot is released.")
+	ErrNotCounter         = errors.New("value is not an integer.")
+	ErrCounterOverflow    = errors.New("counter overflow.")
+	ErrWatchLagged        = errors.New("watcher is too slow and has been dropped.")
+	ErrLogTruncated       = errors.New("replication log position is no longer available.")
+	ErrLogGap             = errors.New("replication log record is not contiguous.")
+	ErrNotReplica         = errors.New("bitcask is not opened as a replica.")
+	ErrVersionMismatch    = errors.New("version does not match.")
+	ErrRecordMismatch     = errors.New("record does not match the keydir entry.")
+	ErrDirNotEmpty        = errors.New("directory is not empty.")
+	ErrBackupChain        = errors.New("backup chain is broken.")
+	ErrBackupChecksum     = errors.New("backup file checksum mismatch.")
+	ErrInvalidBackup      = errors.New("invalid backup archive.")
+	ErrUnknownCompression = errors.New("unknown compression.")
+	ErrRecoveryPending    = errors.New("directory has an unfinished merge or repair, open it in read-write mode first.")
+	ErrInvalidFileSize    = errors.New("max file size is out of range.")
+
+	// ErrCRCValidation 读取到的记录校验失败
+	ErrCRCValidation = codec.ErrCRCValidation
 )
@@ -0,0 +1,142 @@
+package bitcask
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+)
+
+// PutWithExpiry 写入 key/value 并设置过期时间, expiry 为零值时不过期
+//
+// 过期的键对所有读取不可见, 其记录在合并时被清除
+func (b *Bitcask) PutWithExpiry(key, value []byte, expiry time.Time) error {
+	if err := checkKeyValue(key, value); err != nil {
+		return err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+
+	return b.put(key, value, expiryMilli(expiry))
+}
+
+// PutIfVersionWithExpiry 与 PutIfVersion 相同, 同时设置过期时间, expiry 为零值时不过期
+func (b *Bitcask) PutIfVersionWithExpiry(key, val []byte, version uint64, expiry time.Time) (uint64, error) {
+	if err := checkKeyValue(key, val); err != nil {
+		return 0, err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	if !b.versionEquals(key, version) {
+		return 0, ErrVersionMismatch
+	}
+	if err := b.put(key, val, expiryMilli(expiry)); err != nil {
+		return 0, err
+	}
+	entry, _ := b.keydir.Get(key)
+	return entry.Seq, nil
+}
+
+// Expire 修改 key 的过期时间, expiry 为零值时清除过期时间, 返回 key 是否存在
+//
+// 以新的过期时间重写 key 当前的记录, 值不变, 版本号更新, 并发布 OpExpire 事件
+func (b *Bitcask) Expire(key []byte, expiry time.Time) (bool, error) {
+	if err := checkKeyValue(key, nil); err != nil {
+		return false, err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return false, err
+	}
+
+	old, ok := lookup(b.keydir, key)
+	if !ok {
+		return false, nil
+	}
+	df, ok := b.files[old.FileID]
+	if !ok {
+		return false, ErrDataFileNotFound
+	}
+
+	// 大值位于 blob 文件中, 数据文件中只有指针记录, 重写时 blob 不变
+	e, err := df.Read(old.RecordPos, old.RecordSz)
+	if err != nil {
+		return false, err
+	}
+	e.Tstamp, e.Seq, e.Expiry = time.Now().Unix(), 0, expiryMilli(expiry)
+
+	entry, err := b.writeEntry(e)
+	if err != nil {
+		return false, err
+	}
+	entry.Blob = old.Blob
+
+	b.keydir.Put(bytes.Clone(key), entry)
+	b.watch.publish(OpExpire, key, nil, entry)
+	return true, nil
+}
+
+// Expiry 返回 key 的过期时间, 没有过期时间时返回零值
+func (b *Bitcask) Expiry(key []byte) (time.Time, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return time.Time{}, ErrClosed
+	}
+
+	entry, ok := lookup(b.keydir, key)
+	if !ok {
+		return time.Time{}, ErrKeyNotFound
+	}
+	return expiryTime(entry.Expiry), nil
+}
+
+// reap 清除读取时发现已过期的 key 并发布 OpExpire 事件, key 已被改写或清除时不做任何事
+func (b *Bitcask) reap(key []byte, expired *internal.KeydirEntry) {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	// 只清除内存索引, 磁盘上的记录在合并时被清除, 重新打开后仍然不可见
+	if cur, ok := b.keydir.Get(key); !ok || cur != expired {
+		return
+	}
+	b.keydir.Delete(key)
+	b.blobs.release(key, expired)
+	b.watch.publish(OpExpire, key, nil, expired)
+}
+
+// expiryMilli 将过期时间转换为记录中的 Unix 毫秒, 零值表示不过期
+func expiryMilli(expiry time.Time) int64 {
+	if expiry.IsZero() {
+		return 0
+	}
+	// 0 表示不过期, 早于该时刻的过期时间同样视为已经过期
+	return max(expiry.UnixMilli(), 1)
+}
+
+// expiryTime 将记录中的 Unix 毫秒转换为过期时间, 0 返回零值
+func expiryTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,155 @@
+package bitcask
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitcask_PutWithExpiry(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+	future := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	require.NoError(t, b.PutWithExpiry([]byte("live"), []byte("v"), future))
+	require.NoError(t, b.PutWithExpiry([]byte("gone"), []byte("v"), time.Now().Add(-time.Second)))
+	require.NoError(t, b.Put([]byte("plain"), []byte("v")))
+
+	val, err := b.Get([]byte("live"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+	exp, err := b.Expiry([]byte("live"))
+	require.NoError(t, err)
+	assert.True(t, future.Equal(exp), "Expiry should round trip")
+	exp, err = b.Expiry([]byte("plain"))
+	require.NoError(t, err)
+	assert.True(t, exp.IsZero(), "Keys without expiry should return the zero time")
+
+	_, err = b.Get([]byte("gone"))
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Expired key should not be readable")
+	_, err = b.Expiry([]byte("gone"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	ok, err := b.Has([]byte("gone"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	v, err := b.Version([]byte("gone"))
+	require.NoError(t, err)
+	assert.Zero(t, v)
+
+	keys, err := b.ListKeys()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("live"), []byte("plain")}, keys)
+	keys, err = b.ScanKeys(nil, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("live"), []byte("plain")}, keys)
+
+	ok, err = b.PutIfAbsent([]byte("gone"), []byte("new"))
+	require.NoError(t, err)
+	assert.True(t, ok, "Expired key should be treated as absent")
+	exp, err = b.Expiry([]byte("gone"))
+	require.NoError(t, err)
+	assert.True(t, exp.IsZero(), "Put should clear the expiry")
+}
+
+func TestBitcask_Expire(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir(), WithBlobThreshold(64), WithCompactCounter(true))
+	future := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	big := make([]byte, 100)
+
+	ok, err := b.Expire([]byte("missing"), future)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, b.Put([]byte("big"), big))
+	v1, err := b.Version([]byte("big"))
+	require.NoError(t, err)
+	ok, err = b.Expire([]byte("big"), future)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	val, err := b.Get([]byte("big"))
+	require.NoError(t, err)
+	assert.Equal(t, big, val, "Expire should keep blob values")
+	v2, err := b.Version([]byte("big"))
+	require.NoError(t, err)
+	assert.Greater(t, v2, v1)
+
+	ok, err = b.Expire([]byte("big"), time.Time{})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	exp, err := b.Expiry([]byte("big"))
+	require.NoError(t, err)
+	assert.True(t, exp.IsZero(), "Zero expiry should persist the key")
+
+	_, err = b.Incr([]byte("n"), 1)
+	require.NoError(t, err)
+	ok, err = b.Expire([]byte("n"), future)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	n, err := b.Incr([]byte("n"), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	exp, err = b.Expiry([]byte("n"))
+	require.NoError(t, err)
+	assert.True(t, future.Equal(exp), "Incr should keep the expiry")
+
+	ok, err = b.Expire([]byte("n"), time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	n, err = b.Incr([]byte("n"), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "Expired counter should restart from 0")
+}
+
+func TestMerge_Expired(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir, WithMaxFileSize(256), WithBlobThreshold(64))
+	require.NoError(t, err)
+	future := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	past := time.Now().Add(-time.Second)
+
+	require.NoError(t, b.PutWithExpiry([]byte("live"), []byte("v"), future))
+	require.NoError(t, b.PutWithExpiry([]byte("gone"), []byte("v"), past))
+	require.NoError(t, b.PutWithExpiry([]byte("gone-big"), make([]byte, 100), past))
+	require.NoError(t, b.Put([]byte("last"), []byte("v")))
+
+	require.NoError(t, b.Merge())
+	st, err := b.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, st.Keys, "Merge should drop expired keys")
+	assert.Positive(t, st.BlobDead, "Expired blob values should be reclaimable")
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir)
+	keys, err := b.ListKeys()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("last"), []byte("live")}, keys)
+	exp, err := b.Expiry([]byte("live"))
+	require.NoError(t, err)
+	assert.True(t, future.Equal(exp), "Expiry should survive merge and reopen")
+}
+
+func TestMerge_ReapedExpired(t *testing.T) {
+	dir := t.TempDir()
+	b := openTestBitcask(t, dir)
+
+	require.NoError(t, b.Put([]byte("k"), []byte("old")))
+	snap, err := b.Snapshot()
+	require.NoError(t, err)
+	require.NoError(t, b.PutWithExpiry([]byte("k"), []byte("new"), time.Now().Add(-time.Second)))
+	require.NoError(t, b.Put([]byte("last"), []byte("v")))
+
+	_, err = b.Get([]byte("k"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	require.NoError(t, b.Merge())
+
+	val, err := snap.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), val, "Snapshot should keep the old version")
+	require.NoError(t, snap.Release())
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir)
+	_, err = b.Get([]byte("k"))
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Reaped key should not resurrect after merge")
+}
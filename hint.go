@@ -1 +1,140 @@
 package bitcask
+
+import (
+	"encoding/binary"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+// hint 文件与数据文件使用相同的记录编码, 每条记录的键, 类型和时间戳与数据记录一致,
+// 值为数据记录的位置信息:
+//
+// | record_pos | record_sz | value_pos | value_sz | blob pointer(可选) |
+const hintValueSize = 8 + 4 + 8 + 4
+
+func encodeHint(entry *internal.KeydirEntry) []byte {
+	size := hintValueSize
+	if entry.Blob != nil {
+		size += blobPointerSize
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(entry.RecordPos))
+	binary.BigEndian.PutUint32(buf[8:12], entry.RecordSz)
+	binary.BigEndian.PutUint64(buf[12:20], uint64(entry.ValuePos))
+	binary.BigEndian.PutUint32(buf[20:24], entry.ValueSz)
+	if entry.Blob != nil {
+		copy(buf[hintValueSize:], encodeBlobPointer(entry.Blob))
+	}
+	return buf
+}
+
+func decodeHint(e *internal.Entry, id uint32) (*internal.KeydirEntry, error) {
+	if len(e.Val) < hintValueSize {
+		return nil, ErrInvalidHint
+	}
+
+	entry := &internal.KeydirEntry{
+		FileID:    id,
+		RecordPos: int64(binary.BigEndian.Uint64(e.Val[0:8])),
+		RecordSz:  binary.BigEndian.Uint32(e.Val[8:12]),
+		ValuePos:  int64(binary.BigEndian.Uint64(e.Val[12:20])),
+		ValueSz:   binary.BigEndian.Uint32(e.Val[20:24]),
+		Tstamp:    e.Tstamp,
+		Seq:       e.Seq,
+		Expiry:    e.Expiry,
+		Chunked:   e.Type == internal.TypeChunked,
+		Counter:   e.Type == internal.TypeCounter,
+	}
+
+	if e.Type == internal.TypeBlobPointer {
+		ptr, err := decodeBlobPointer(e.Val[hintValueSize:])
+		if err != nil {
+			return nil, err
+		}
+		entry.Blob = ptr
+	}
+	return entry, nil
+}
+
+func openHintFile(path string, id uint32) (*datafile.DataFile, error) {
+	return datafile.Open(path, id, hintFileHeader())
+}
+
+func hintFileHeader() codec.FileHeader {
+	return codec.NewFileHeader(codec.ChecksumIEEE, codec.FormatFixed)
+}
+
+// writeHint 向 hint 文件追加 key 对应的位置信息
+func writeHint(hf *datafile.DataFile, key []byte, entry *internal.KeydirEntry) error {
+	typ := internal.TypeNormal
+	if entry.Blob != nil {
+		typ = internal.TypeBlobPointer
+	} else if entry.Chunked {
+		typ = internal.TypeChunked
+	} else if entry.Counter {
+		typ = internal.TypeCounter
+	}
+
+	_, err := hf.Write(hf.Codec().EncodeEntry(&internal.Entry{
+		Type:   typ,
+		Tstamp: entry.Tstamp,
+		Seq:    entry.Seq,
+		Expiry: entry.Expiry,
+		Key:    key,
+		Val:    encodeHint(entry),
+	}))
+	return err
+}
+
+// writeHintTombstone 向 hint 文件追加 key 的墓碑记录
+func writeHintTombstone(hf *datafile.DataFile, key []byte, tstamp int64, seq uint64) error {
+	_, err := hf.Write(hf.Codec().EncodeEntry(&internal.Entry{
+		Type:   internal.TypeDeleted,
+		Tstamp: tstamp,
+		Seq:    seq,
+		Key:    key,
+	}))
+	return err
+}
+
+// loadHint 从 hint 文件加载 id 对应数据文件的 keydir, 返回 hint 记录中最大的序列号
+//
+// 旧版本的 hint 记录没有序列号, 与数据文件相同使用记录的位置代替
+func loadHint(path string, id uint32, kd *internal.Keydir) (uint64, error) {
+	hf, err := datafile.OpenReadOnly(path, id, hintFileHeader())
+	if err != nil {
+		return 0, err
+	}
+	defer hf.Close()
+
+	var maxSeq uint64
+	err = hf.Scan(func(e *internal.Entry, _ int64, _ uint32) error {
+		// 合并写入的提交标记只用于保存序列号
+		if e.Type == internal.TypeCommit {
+			maxSeq = max(maxSeq, e.Seq)
+			return nil
+		}
+		if e.Type == internal.TypeDeleted {
+			kd.Delete(e.Key)
+			if hf.Codec().HasSeq() {
+				maxSeq = max(maxSeq, e.Seq)
+			}
+			return nil
+		}
+
+		entry, err := decodeHint(e, id)
+		if err != nil {
+			return err
+		}
+		if !hf.Codec().HasSeq() {
+			entry.Seq = datafile.LegacySeq(id, entry.RecordPos)
+		}
+		maxSeq = max(maxSeq, entry.Seq)
+		kd.Put(e.Key, entry)
+		return nil
+	})
+	return maxSeq, err
+}
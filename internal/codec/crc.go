@@ -1,13 +1,100 @@
 package codec
 
-import "hash/crc32"
+import (
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
 
-// var crcTable = crc32.MakeTable(crc32.IEEE)
+	"github.com/cespare/xxhash/v2"
+)
 
-func calculateCRC(data []byte) uint32 {
-	return crc32.ChecksumIEEE(data)
+var ErrUnknownChecksum = errors.New("unknown checksum algorithm.")
+
+// Checksum 记录使用的校验和算法, 由数据文件的文件头指定
+type Checksum uint8
+
+const (
+	// ChecksumIEEE crc32(IEEE), 与旧数据文件兼容
+	ChecksumIEEE Checksum = iota
+	// ChecksumCastagnoli crc32c, amd64/arm64 上有硬件加速
+	ChecksumCastagnoli
+	// ChecksumXXHash64 64位校验和, 大值场景下检错能力更强
+	ChecksumXXHash64
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Valid 判断是否为已知的校验和算法
+func (c Checksum) Valid() bool {
+	return c <= ChecksumXXHash64
+}
+
+// Size 校验和在记录头中占用的字节数
+func (c Checksum) Size() int {
+	if c == ChecksumXXHash64 {
+		return 8
+	}
+	return 4
+}
+
+// Sum 计算 data 的校验和
+func (c Checksum) Sum(data []byte) uint64 {
+	switch c {
+	case ChecksumCastagnoli:
+		return uint64(crc32.Checksum(data, castagnoliTable))
+	case ChecksumXXHash64:
+		return xxhash.Sum64(data)
+	default:
+		return uint64(calculateCRC(data))
+	}
+}
+
+// Verify 校验 data 的校验和是否与 sum 一致
+func (c Checksum) Verify(data []byte, sum uint64) bool {
+	return c.Sum(data) == sum
 }
 
-func verifyCRC(data []byte, crc uint32) bool {
-	return crc32.ChecksumIEEE(data) == crc
+func (c Checksum) String() string {
+	switch c {
+	case ChecksumIEEE:
+		return "crc32-ieee"
+	case ChecksumCastagnoli:
+		return "crc32c"
+	case ChecksumXXHash64:
+		return "xxhash64"
+	default:
+		return "unknown"
+	}
+}
+
+// Digest 增量计算校验和, 用于流式读写
+type Digest interface {
+	io.Writer
+	Sum64() uint64
+}
+
+type crc32Digest struct {
+	hash.Hash32
+}
+
+func (d crc32Digest) Sum64() uint64 {
+	return uint64(d.Sum32())
+}
+
+// New 返回增量计算校验和的 Digest
+func (c Checksum) New() Digest {
+	switch c {
+	case ChecksumCastagnoli:
+		return crc32Digest{crc32.New(castagnoliTable)}
+	case ChecksumXXHash64:
+		return xxhash.New()
+	default:
+		return crc32Digest{crc32.NewIEEE()}
+	}
+}
+
+// calculateCRC 旧格式使用的 crc32(IEEE) 校验和
+func calculateCRC(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
 }
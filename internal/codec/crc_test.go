@@ -0,0 +1,142 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var checksums = []Checksum{ChecksumIEEE, ChecksumCastagnoli, ChecksumXXHash64}
+
+func TestCodec_ChecksumRoundTrip(t *testing.T) {
+	key := []byte("checksumKey")
+	val := []byte("checksumValue")
+
+	for _, cs := range checksums {
+		t.Run(cs.String(), func(t *testing.T) {
+			c := New(NewFileHeader(cs, FormatFixed))
+			encoded := c.Encode(key, val, false)
+			assert.Equal(t, c.HeaderSize()+len(key)+len(val), len(encoded),
+				"The total length after encoding does not match")
+
+			entry, err := c.Decode(encoded)
+			require.NoError(t, err, "Decoding should not return errors")
+			assert.Equal(t, cs.Sum(encoded[cs.Size():]), entry.CRC, "Checksum does not match")
+			assert.Equal(t, key, entry.Key, "The decoded key does not match")
+			assert.Equal(t, val, entry.Val, "The decoded value does not match")
+
+			encoded[len(encoded)-1] ^= 0x01
+			_, err = c.Decode(encoded)
+			assert.ErrorIs(t, err, ErrCRCValidation, "Tampered data should fail validation")
+		})
+	}
+}
+
+func TestCodec_DefaultIsIEEE(t *testing.T) {
+	key := []byte("k")
+	val := []byte("v")
+
+	c := New(FileHeader{Version: 1, Checksum: ChecksumIEEE, Format: FormatFixed})
+	assert.Equal(t, headerSize, c.HeaderSize(), "IEEE header size should match the default layout")
+
+	entry, err := Decode(c.Encode(key, val, false))
+	require.NoError(t, err, "IEEE records should decode with the default codec")
+	assert.Equal(t, val, entry.Val, "The decoded value does not match")
+}
+
+func TestFileHeader_RoundTrip(t *testing.T) {
+	for _, f := range []Format{FormatFixed, FormatCompact} {
+		for _, cs := range checksums {
+			want := NewFileHeader(cs, f)
+			b := EncodeFileHeader(want)
+			require.Len(t, b, FileHeaderSize, "File header size does not match")
+
+			h, err := DecodeFileHeader(b)
+			require.NoError(t, err, "Decoding file header should not return errors")
+			assert.Equal(t, want, h, "File header does not match")
+		}
+	}
+}
+
+func TestFileHeader_Invalid(t *testing.T) {
+	_, err := DecodeFileHeader(make([]byte, FileHeaderSize-1))
+	assert.ErrorIs(t, err, ErrInvalidFileHeader, "Short header should be rejected")
+
+	b := EncodeFileHeader(NewFileHeader(ChecksumIEEE, FormatFixed))
+	b[fhChecksumIdx] = 0xff
+	_, err = DecodeFileHeader(b)
+	assert.ErrorIs(t, err, ErrInvalidFileHeader, "Header crc should cover the checksum byte")
+
+	b = EncodeFileHeader(FileHeader{Version: fileHeaderVersion, Checksum: Checksum(0xff)})
+	_, err = DecodeFileHeader(b)
+	assert.ErrorIs(t, err, ErrUnknownChecksum, "Unknown checksum should be rejected")
+}
+
+func benchmarkValue() ([]byte, []byte) {
+	key := make([]byte, 1024*5)
+	for i := range key {
+		key[i] = byte(i % 256)
+	}
+	val := make([]byte, 1024*100)
+	for i := range val {
+		val[i] = byte((i + 128) % 256)
+	}
+	return key, val
+}
+
+func BenchmarkEncode_LargeData(b *testing.B) {
+	key, val := benchmarkValue()
+
+	for _, cs := range checksums {
+		b.Run(cs.String(), func(b *testing.B) {
+			c := New(NewFileHeader(cs, FormatFixed))
+			b.SetBytes(int64(len(key) + len(val)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = c.Encode(key, val, false)
+			}
+		})
+	}
+}
+
+func BenchmarkDecode_LargeData(b *testing.B) {
+	key, val := benchmarkValue()
+
+	for _, cs := range checksums {
+		b.Run(cs.String(), func(b *testing.B) {
+			c := New(NewFileHeader(cs, FormatFixed))
+			encoded := c.Encode(key, val, false)
+			b.SetBytes(int64(len(encoded)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Decode(encoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCodec_StreamHeader(t *testing.T) {
+	key := []byte("streamKey")
+	val := []byte("streamValue")
+
+	for _, f := range []Format{FormatFixed, FormatCompact} {
+		for _, cs := range checksums {
+			c := New(NewFileHeader(cs, f))
+
+			head := c.EncodeHeader(internal.TypeNormal, 1700000000, 42, 1700000000123, key, uint32(len(val)))
+			d := cs.New()
+			_, _ = d.Write(head[cs.Size():])
+			_, _ = d.Write(val[:5])
+			_, _ = d.Write(val[5:])
+			c.PutChecksum(head, d.Sum64())
+
+			want := c.EncodeEntry(&internal.Entry{Tstamp: 1700000000, Seq: 42, Expiry: 1700000000123, Key: key, Val: val})
+			assert.Equal(t, want, append(head, val...), "Streamed record does not match %s/%s", f, cs)
+			assert.Equal(t, cs.Sum(want[cs.Size():]), c.ReadChecksum(want))
+		}
+	}
+}
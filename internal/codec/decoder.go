@@ -1,8 +1,11 @@
 package codec
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"io"
+	"math"
 
 	"github.com/chhz0/bitcask/internal"
 )
@@ -13,40 +16,193 @@ var (
 	ErrCRCValidation  = errors.New("crc validation failed.")
 )
 
+// Decode 使用旧格式(FormatFixed, crc32 IEEE, 没有 seq 和 expiry)解码记录
 func Decode(b []byte) (*internal.Entry, error) {
-	if len(b) < headerSize {
-		return nil, ErrInvalidHeader
+	return legacyCodec.Decode(b)
+}
+
+func (c *Codec) Decode(b []byte) (*internal.Entry, error) {
+	if c.format == FormatCompact {
+		return c.decodeCompact(b)
+	}
+	return c.decodeFixed(b)
+}
+
+// Header 记录头中的字段
+type Header struct {
+	CRC    uint64
+	Type   internal.RecordType
+	Tstamp int64
+	KSz    uint32
+	VSz    uint32
+	Seq    uint64
+	Expiry int64
+	// Size 记录头的长度, 记录总长度为 Size+KSz+VSz
+	Size int
+}
+
+// DecodeHeader 解析 b 开头的记录头, 不读取键值也不校验校验和, 用于检查损坏的记录
+func (c *Codec) DecodeHeader(b []byte) (Header, error) {
+	if c.format == FormatCompact {
+		return c.decodeCompactHeader(b)
+	}
+	return c.decodeFixedHeader(b)
+}
+
+func (c *Codec) decodeFixedHeader(b []byte) (Header, error) {
+	csz := c.checksum.Size()
+	hsz := c.HeaderSize()
+	if len(b) < hsz {
+		return Header{}, ErrInvalidHeader
+	}
+
+	h := c.readFixedHeader(b[:hsz])
+	h.CRC = c.readChecksum(b[0:csz])
+	return h, nil
+}
+
+// readFixedHeader 解析固定格式记录头中校验和之后的字段, b 的长度为记录头的长度
+func (c *Codec) readFixedHeader(b []byte) Header {
+	csz := c.checksum.Size()
+	tstampEnd := csz + tstampSize
+	kszEnd := tstampEnd + keySize
+	vszEnd := kszEnd + valueSize
+
+	typ, ksz := splitFixedKsz(binary.BigEndian.Uint32(b[tstampEnd:kszEnd]))
+	h := Header{
+		Type:   typ,
+		Tstamp: int64(binary.BigEndian.Uint64(b[csz:tstampEnd])),
+		KSz:    ksz,
+		VSz:    binary.BigEndian.Uint32(b[kszEnd:vszEnd]),
+		Size:   len(b),
+	}
+	if c.seq {
+		h.Seq = binary.BigEndian.Uint64(b[vszEnd : vszEnd+seqSize])
+		h.Expiry = int64(binary.BigEndian.Uint64(b[vszEnd+seqSize : vszEnd+seqSize+expirySize]))
+	}
+	return h
+}
+
+func (c *Codec) decodeCompactHeader(b []byte) (Header, error) {
+	csz := c.checksum.Size()
+	if len(b) <= csz {
+		return Header{}, ErrInvalidHeader
+	}
+
+	h, err := c.readCompactHeader(b[csz:])
+	if err != nil {
+		return Header{}, err
+	}
+	h.CRC = c.readChecksum(b[0:csz])
+	h.Size += csz
+	return h, nil
+}
+
+func (c *Codec) decodeFixed(b []byte) (*internal.Entry, error) {
+	h, err := c.decodeFixedHeader(b)
+	if err != nil {
+		return nil, err
 	}
+	return c.decodeBody(b, h)
+}
 
-	crc := binary.BigEndian.Uint32(b[0:crcSize])
-	tstamp := int64(binary.BigEndian.Uint64(b[crcSize:bufTstampEndIdx]))
-	ksz := binary.BigEndian.Uint32(b[bufTstampEndIdx:bufKszEndIdx])
-	vsz := binary.BigEndian.Uint32(b[bufKszEndIdx:bufVszEndIdx])
+func (c *Codec) decodeCompact(b []byte) (*internal.Entry, error) {
+	h, err := c.decodeCompactHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	return c.decodeBody(b, h)
+}
 
-	totalSize := headerSize + ksz + vsz
-	if len(b) < int(totalSize) {
+// decodeBody 校验 h 描述的记录并拷贝出键值
+func (c *Codec) decodeBody(b []byte, h Header) (*internal.Entry, error) {
+	totalSize := uint64(h.Size) + uint64(h.KSz) + uint64(h.VSz)
+	if uint64(len(b)) < totalSize {
 		return nil, ErrIncompleteRead
 	}
 
-	if !verifyCRC(b[crcSize:totalSize], crc) {
+	if !c.checksum.Verify(b[c.checksum.Size():totalSize], h.CRC) {
 		return nil, ErrCRCValidation
 	}
 
-	keyStart := headerSize
-	keyEnd := keyStart + int(ksz)
+	e := newEntry(h.CRC, h.Type, h.Tstamp, b[h.Size:totalSize], int(h.KSz))
+	e.Seq, e.Expiry = h.Seq, h.Expiry
+	return e, nil
+}
+
+// readCompactHeader 解析紧凑格式记录头中校验和之后的字段, 返回的 Size 不含校验和
+func (c *Codec) readCompactHeader(b []byte) (Header, error) {
+	r := bytes.NewReader(b)
+	h, err := c.readCompactFields(r)
+	if err != nil {
+		return Header{}, ErrInvalidHeader
+	}
+	h.Size = len(b) - r.Len()
+	return h, nil
+}
+
+// readCompactFields 从 r 中依次读取紧凑格式记录头的字段
+func (c *Codec) readCompactFields(r io.ByteReader) (Header, error) {
+	delta, err := binary.ReadVarint(r)
+	if err != nil {
+		return Header{}, err
+	}
+
+	meta, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Header{}, err
+	}
+	if meta > math.MaxUint32 {
+		return Header{}, ErrInvalidHeader
+	}
+	typ, ksz := splitCompactMeta(meta)
+
+	vsz, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Header{}, err
+	}
+	if vsz > math.MaxUint32 {
+		return Header{}, ErrInvalidHeader
+	}
+
+	h := Header{Type: typ, Tstamp: c.base + delta, KSz: uint32(ksz), VSz: uint32(vsz)}
+	if c.seq {
+		if h.Seq, err = binary.ReadUvarint(r); err != nil {
+			return Header{}, err
+		}
+		expiry, err := binary.ReadUvarint(r)
+		if err != nil {
+			return Header{}, err
+		}
+		h.Expiry = int64(expiry)
+	}
+	return h, nil
+}
+
+func splitFixedKsz(v uint32) (internal.RecordType, uint32) {
+	return internal.RecordType(v >> typeShift), v & MaxKeySize
+}
+
+func splitCompactMeta(v uint64) (internal.RecordType, uint64) {
+	return internal.RecordType(v & uint64(internal.MaxRecordType)), v >> typeBits
+}
+
+// newEntry 从 key+value 数据中拷贝出键值, 避免引用调用方的缓冲区
+func newEntry(crc uint64, typ internal.RecordType, tstamp int64, kv []byte, ksz int) *internal.Entry {
 	key := make([]byte, ksz)
-	copy(key, b[keyStart:keyEnd])
+	copy(key, kv[:ksz])
 
 	value := []byte{}
-	if vsz > 0 {
-		value = make([]byte, vsz)
-		copy(value, b[keyEnd:keyEnd+int(vsz)])
+	if len(kv) > ksz {
+		value = make([]byte, len(kv)-ksz)
+		copy(value, kv[ksz:])
 	}
 
 	return &internal.Entry{
 		CRC:    crc,
+		Type:   typ,
 		Tstamp: tstamp,
 		Key:    key,
 		Val:    value,
-	}, nil
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/chhz0/bitcask/internal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -26,7 +27,7 @@ func TestDecode_NormalCase(t *testing.T) {
 		"The decoded result should not be nil")
 
 	// 验证元数据
-	assert.Equal(t, uint32(calculateCRC(encoded[crcSize:])), entry.CRC,
+	assert.Equal(t, uint64(calculateCRC(encoded[crcSize:])), entry.CRC,
 		"CRC value does not match")
 	assert.InDelta(t, time.Now().Unix(), entry.Tstamp, 1,
 		"Timestamp deviation is too large") // 允许1秒误差
@@ -131,3 +132,24 @@ func TestDecode_LargeData(t *testing.T) {
 	assert.Equal(t, largeKey, entry.Key, "Big key decoding mismatch")
 	assert.Equal(t, largeVal, entry.Val, "Big value decoding mismatch")
 }
+
+func TestCodec_DecodeHeader(t *testing.T) {
+	for _, f := range formats {
+		t.Run(f.String(), func(t *testing.T) {
+			c := New(NewFileHeader(ChecksumIEEE, f))
+			encoded := c.EncodeRecord(internal.TypeCounter, []byte("hdrKey"), []byte("hdrValue"))
+			encoded[len(encoded)-1] ^= 0x01
+
+			h, err := c.DecodeHeader(encoded)
+			require.NoError(t, err, "The header should decode without checking the CRC")
+			assert.Equal(t, internal.TypeCounter, h.Type, "Record type mismatch")
+			assert.Equal(t, uint32(6), h.KSz, "Key size mismatch")
+			assert.Equal(t, uint32(8), h.VSz, "Value size mismatch")
+			assert.Equal(t, len(encoded), h.Size+int(h.KSz+h.VSz), "Record size mismatch")
+			assert.InDelta(t, time.Now().Unix(), h.Tstamp, 1, "Timestamp deviation is too large")
+
+			_, err = c.DecodeHeader(encoded[:1])
+			assert.ErrorIs(t, err, ErrInvalidHeader, "A short header should be rejected")
+		})
+	}
+}
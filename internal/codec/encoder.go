@@ -3,6 +3,8 @@ package codec
 import (
 	"encoding/binary"
 	"time"
+
+	"github.com/chhz0/bitcask/internal"
 )
 
 const (
@@ -10,35 +12,181 @@ const (
 	tstampSize = 8
 	keySize    = 4
 	valueSize  = 4
+	seqSize    = 8
+	expirySize = 8
 
+	// headerSize 和 buf*Idx 为版本 1 文件头下 FormatFixed, crc32 IEEE 记录的布局
 	headerSize = crcSize + tstampSize + keySize + valueSize
 
 	bufTstampEndIdx = crcSize + tstampSize
 	bufKszEndIdx    = bufTstampEndIdx + keySize
 	bufVszEndIdx    = bufKszEndIdx + valueSize
+
+	// 记录类型与 ksz 共用一个字段:
+	// FormatFixed 中类型占 ksz 字段的高 4 bit, FormatCompact 中类型占 uvarint 的低 4 bit
+	typeBits  = 4
+	typeShift = keySize*8 - typeBits
+
+	// MaxKeySize 键的最大长度
+	MaxKeySize = 1<<typeShift - 1
 )
 
+// Codec 按数据文件头指定的参数编解码记录
+//
+// FormatFixed:   | checksum | tstamp | type+ksz | value_sz | seq | expiry | key | value |
+// FormatCompact: | checksum | tstamp_delta(varint) | ksz+type(uvarint) | value_sz(uvarint) | seq(uvarint) | expiry(uvarint) | key | value |
+//
+// checksum 的宽度由校验和算法决定, 调用方需保证键长度不超过 MaxKeySize.
+// 版本 1 的文件头对应的记录没有 seq 和 expiry 字段, 解码得到的 Seq 和 Expiry 为 0
+type Codec struct {
+	checksum Checksum
+	format   Format
+	base     int64
+	seq      bool // 记录中是否有 seq 和 expiry 字段
+}
+
+// legacyCodec 版本 1 文件头的 FormatFixed, crc32 IEEE 格式
+var legacyCodec = &Codec{checksum: ChecksumIEEE, format: FormatFixed}
+
+// New 根据文件头创建 Codec
+func New(h FileHeader) *Codec {
+	return &Codec{
+		checksum: h.Checksum,
+		format:   h.Format,
+		base:     h.BaseTstamp,
+		seq:      h.Version >= seqVersion,
+	}
+}
+
+// Checksum 返回记录使用的校验和算法
+func (c *Codec) Checksum() Checksum {
+	return c.checksum
+}
+
+// Format 返回记录格式
+func (c *Codec) Format() Format {
+	return c.format
+}
+
+// HasSeq 判断记录中是否保存了序列号和过期时间
+func (c *Codec) HasSeq() bool {
+	return c.seq
+}
+
+// HeaderSize 返回 FormatFixed 的记录头大小, FormatCompact 返回记录头的最大可能大小
+func (c *Codec) HeaderSize() int {
+	if c.format == FormatCompact {
+		if c.seq {
+			return c.checksum.Size() + 5*binary.MaxVarintLen64
+		}
+		return c.checksum.Size() + 3*binary.MaxVarintLen64
+	}
+	if c.seq {
+		return c.checksum.Size() + tstampSize + keySize + valueSize + seqSize + expirySize
+	}
+	return c.checksum.Size() + tstampSize + keySize + valueSize
+}
+
+// Encode 使用旧格式(FormatFixed, crc32 IEEE, 没有 seq 和 expiry)编码记录
 func Encode(key, val []byte, deleted bool) []byte {
-	ksz := len(key)
-	vsz := len(val)
+	return legacyCodec.Encode(key, val, deleted)
+}
 
+func (c *Codec) Encode(key, val []byte, deleted bool) []byte {
 	if deleted {
-		vsz = 0
+		return c.EncodeRecord(internal.TypeDeleted, key, nil)
 	}
+	return c.EncodeRecord(internal.TypeNormal, key, val)
+}
 
-	buf := make([]byte, headerSize+ksz+vsz)
+// EncodeRecord 编码指定类型的记录, 时间戳为当前时间
+func (c *Codec) EncodeRecord(typ internal.RecordType, key, val []byte) []byte {
+	return c.EncodeEntry(&internal.Entry{
+		Type:   typ,
+		Tstamp: time.Now().Unix(),
+		Key:    key,
+		Val:    val,
+	})
+}
 
-	binary.BigEndian.PutUint64(buf[crcSize:bufTstampEndIdx], uint64(time.Now().Unix()))
-	binary.BigEndian.PutUint32(buf[bufTstampEndIdx:bufKszEndIdx], uint32(ksz))
-	binary.BigEndian.PutUint32(buf[bufKszEndIdx:bufVszEndIdx], uint32(vsz))
+// EncodeEntry 编码记录, 保留 e 中的类型, 时间戳, 序列号和过期时间, 用于合并等重写记录的场景
+func (c *Codec) EncodeEntry(e *internal.Entry) []byte {
+	buf := c.encodeHeader(e.Type, e.Tstamp, e.Seq, e.Expiry, e.Key, len(e.Val))
+	buf = append(buf, e.Val...)
 
-	copy(buf[bufVszEndIdx:bufVszEndIdx+ksz], key)
+	csz := c.checksum.Size()
+	c.putChecksum(buf[:csz], c.checksum.Sum(buf[csz:]))
 
-	if !deleted {
-		copy(buf[bufVszEndIdx+ksz:bufVszEndIdx+ksz+vsz], val)
-	}
+	return buf
+}
+
+// EncodeHeader 编码记录头和键, 用于流式写入值, 校验和字段留空
+//
+// 校验和覆盖返回数据中校验和之后的部分以及值, 由调用方通过 Checksum().New() 增量计算,
+// 写完值后使用 PutChecksum 回填
+func (c *Codec) EncodeHeader(typ internal.RecordType, tstamp int64, seq uint64, expiry int64, key []byte, vsz uint32) []byte {
+	return c.encodeHeader(typ, tstamp, seq, expiry, key, int(vsz))
+}
 
-	binary.BigEndian.PutUint32(buf[:crcSize], calculateCRC(buf[crcSize:]))
+// encodeHeader 编码记录头和键, 返回的切片为值预留容量
+func (c *Codec) encodeHeader(typ internal.RecordType, tstamp int64, seq uint64, expiry int64, key []byte, vsz int) []byte {
+	csz := c.checksum.Size()
+	ksz := len(key)
+
+	var buf []byte
+	if c.format == FormatCompact {
+		var head [5 * binary.MaxVarintLen64]byte
+		n := binary.PutVarint(head[:], tstamp-c.base)
+		n += binary.PutUvarint(head[n:], uint64(ksz)<<typeBits|uint64(typ))
+		n += binary.PutUvarint(head[n:], uint64(vsz))
+		if c.seq {
+			n += binary.PutUvarint(head[n:], seq)
+			n += binary.PutUvarint(head[n:], uint64(expiry))
+		}
+
+		buf = make([]byte, csz+n+ksz, csz+n+ksz+vsz)
+		copy(buf[csz:], head[:n])
+	} else {
+		hsz := c.HeaderSize()
+		tstampEnd := csz + tstampSize
+		kszEnd := tstampEnd + keySize
+		vszEnd := kszEnd + valueSize
+
+		buf = make([]byte, hsz+ksz, hsz+ksz+vsz)
+		binary.BigEndian.PutUint64(buf[csz:tstampEnd], uint64(tstamp))
+		binary.BigEndian.PutUint32(buf[tstampEnd:kszEnd], uint32(typ)<<typeShift|uint32(ksz))
+		binary.BigEndian.PutUint32(buf[kszEnd:vszEnd], uint32(vsz))
+		if c.seq {
+			binary.BigEndian.PutUint64(buf[vszEnd:vszEnd+seqSize], seq)
+			binary.BigEndian.PutUint64(buf[vszEnd+seqSize:hsz], uint64(expiry))
+		}
+	}
 
+	copy(buf[len(buf)-ksz:], key)
 	return buf
 }
+
+// PutChecksum 回填 EncodeHeader 返回数据中的校验和字段
+func (c *Codec) PutChecksum(head []byte, sum uint64) {
+	c.putChecksum(head[:c.checksum.Size()], sum)
+}
+
+// ReadChecksum 读取记录中的校验和字段
+func (c *Codec) ReadChecksum(rec []byte) uint64 {
+	return c.readChecksum(rec[:c.checksum.Size()])
+}
+
+func (c *Codec) putChecksum(b []byte, sum uint64) {
+	if c.checksum.Size() == 8 {
+		binary.BigEndian.PutUint64(b, sum)
+		return
+	}
+	binary.BigEndian.PutUint32(b, uint32(sum))
+}
+
+func (c *Codec) readChecksum(b []byte) uint64 {
+	if c.checksum.Size() == 8 {
+		return binary.BigEndian.Uint64(b)
+	}
+	return uint64(binary.BigEndian.Uint32(b))
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/chhz0/bitcask/internal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -157,3 +158,29 @@ func TestEncode_LargeData(t *testing.T) {
 	assert.True(t, bytes.Equal(val, result[valStart:valEnd]),
 		"Large value content does not match")
 }
+
+func TestEncode_SeqLayout(t *testing.T) {
+	key := []byte("testKey")
+	val := []byte("testValue")
+	c := New(NewFileHeader(ChecksumIEEE, FormatFixed))
+
+	result := c.EncodeEntry(&internal.Entry{Tstamp: 1700000000, Seq: 42, Expiry: 1700000000123, Key: key, Val: val})
+
+	// 版本 2 的记录在 value_sz 之后依次是 seq 和 expiry
+	seqEnd := bufVszEndIdx + seqSize
+	expiryEnd := seqEnd + expirySize
+	assert.Equal(t, c.HeaderSize(), expiryEnd, "Header size should include seq and expiry")
+	assert.Equal(t, expiryEnd+len(key)+len(val), len(result),
+		"The total length after encoding does not match")
+	assert.Equal(t, uint64(42), binary.BigEndian.Uint64(result[bufVszEndIdx:seqEnd]),
+		"Sequence number encoding error")
+	assert.Equal(t, uint64(1700000000123), binary.BigEndian.Uint64(result[seqEnd:expiryEnd]),
+		"Expiry encoding error")
+	assert.Equal(t, key, result[expiryEnd:expiryEnd+len(key)], "Key content does not match")
+	assert.Equal(t, val, result[expiryEnd+len(key):], "Value content does not match")
+	assert.Equal(t, calculateCRC(result[crcSize:]), binary.BigEndian.Uint32(result[:crcSize]),
+		"CRC checksum value does not match")
+
+	_, err := Decode(result)
+	assert.Error(t, err, "Records with seq should not decode with the legacy layout")
+}
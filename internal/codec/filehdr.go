@@ -0,0 +1,123 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"time"
+)
+
+var (
+	ErrInvalidFileHeader = errors.New("invalid file header.")
+	ErrFileHeaderVersion = errors.New("unsupported file header version.")
+	ErrUnknownFormat     = errors.New("unknown record format.")
+)
+
+// Format 记录编码格式, 由数据文件的文件头指定
+type Format uint8
+
+const (
+	// FormatFixed 定长记录头, 字段位于固定下标
+	FormatFixed Format = iota
+	// FormatCompact 紧凑记录头, ksz/value_sz 使用 uvarint, 时间戳为相对文件头 BaseTstamp 的增量
+	FormatCompact
+)
+
+// Valid 判断是否为已知的记录格式
+func (f Format) Valid() bool {
+	return f <= FormatCompact
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatFixed:
+		return "fixed"
+	case FormatCompact:
+		return "compact"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	fileMagic         = "BKSK"
+	fileHeaderVersion = 2
+	// seqVersion 记录开始保存序列号的文件头版本, 之前版本的文件仍然可以读取
+	seqVersion = 2
+
+	// FileHeaderSize 数据文件头大小, 数据文件的第一条记录从该偏移开始
+	FileHeaderSize = 24
+
+	fhMagicEndIdx = 4
+	fhVersionIdx  = fhMagicEndIdx
+	fhChecksumIdx = fhVersionIdx + 1
+	fhFormatIdx   = fhChecksumIdx + 1
+	fhTstampIdx   = fhFormatIdx + 2
+	fhCRCStartIdx = FileHeaderSize - crcSize
+)
+
+// FileHeader 数据文件头, 记录该文件中所有记录使用的编码参数
+//
+// | magic | version | checksum | format | reserved | base_tstamp | reserved | crc |
+// | 4     | 1       | 1        | 1      | 1        | 8           | 4        | 4   |
+type FileHeader struct {
+	Version    uint8
+	Checksum   Checksum
+	Format     Format
+	BaseTstamp int64
+}
+
+// NewFileHeader 创建使用 cs 作为记录校验和算法, f 作为记录格式的文件头
+func NewFileHeader(cs Checksum, f Format) FileHeader {
+	return FileHeader{
+		Version:    fileHeaderVersion,
+		Checksum:   cs,
+		Format:     f,
+		BaseTstamp: time.Now().Unix(),
+	}
+}
+
+// EncodeFileHeader 编码文件头
+func EncodeFileHeader(h FileHeader) []byte {
+	buf := make([]byte, FileHeaderSize)
+
+	copy(buf[:fhMagicEndIdx], fileMagic)
+	buf[fhVersionIdx] = h.Version
+	buf[fhChecksumIdx] = byte(h.Checksum)
+	buf[fhFormatIdx] = byte(h.Format)
+	binary.BigEndian.PutUint64(buf[fhTstampIdx:fhTstampIdx+tstampSize], uint64(h.BaseTstamp))
+
+	binary.BigEndian.PutUint32(buf[fhCRCStartIdx:], crc32.ChecksumIEEE(buf[:fhCRCStartIdx]))
+
+	return buf
+}
+
+// DecodeFileHeader 解码并校验文件头
+func DecodeFileHeader(b []byte) (FileHeader, error) {
+	if len(b) < FileHeaderSize || string(b[:fhMagicEndIdx]) != fileMagic {
+		return FileHeader{}, ErrInvalidFileHeader
+	}
+
+	crc := binary.BigEndian.Uint32(b[fhCRCStartIdx:FileHeaderSize])
+	if crc32.ChecksumIEEE(b[:fhCRCStartIdx]) != crc {
+		return FileHeader{}, ErrInvalidFileHeader
+	}
+
+	h := FileHeader{
+		Version:    b[fhVersionIdx],
+		Checksum:   Checksum(b[fhChecksumIdx]),
+		Format:     Format(b[fhFormatIdx]),
+		BaseTstamp: int64(binary.BigEndian.Uint64(b[fhTstampIdx : fhTstampIdx+tstampSize])),
+	}
+	if h.Version < 1 || h.Version > fileHeaderVersion {
+		return FileHeader{}, ErrFileHeaderVersion
+	}
+	if !h.Checksum.Valid() {
+		return FileHeader{}, ErrUnknownChecksum
+	}
+	if !h.Format.Valid() {
+		return FileHeader{}, ErrUnknownFormat
+	}
+
+	return h, nil
+}
@@ -0,0 +1,136 @@
+package codec
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/chhz0/bitcask/internal"
+)
+
+const readerBufferSize = 64 * 1024
+
+// Decoder 从 io.Reader 中顺序解码记录
+//
+// 紧凑格式的字段没有固定下标, 只能按顺序读取, 因此扫描数据文件应使用 Decoder
+type Decoder struct {
+	c    *Codec
+	r    *bufio.Reader
+	head []byte
+	off  int64
+	size int64
+}
+
+// NewDecoder 创建从 r 中读取记录的 Decoder, r 应定位在第一条记录的起始位置
+//
+// size 为 r 中可读取的字节数, 记录头中的长度超过剩余字节数时不会按该长度分配内存, 直接返回 ErrIncompleteRead
+func (c *Codec) NewDecoder(r io.Reader, size int64) *Decoder {
+	return &Decoder{
+		c:    c,
+		r:    bufio.NewReaderSize(r, readerBufferSize),
+		head: make([]byte, 0, c.HeaderSize()),
+		size: size,
+	}
+}
+
+// Offset 返回下一条记录相对于起始位置的偏移量
+func (d *Decoder) Offset() int64 {
+	return d.off
+}
+
+// Decode 读取并校验下一条记录, 读取完毕时返回 io.EOF
+func (d *Decoder) Decode() (*internal.Entry, error) {
+	csz := d.c.checksum.Size()
+	d.head = d.head[:csz]
+	if n, err := io.ReadFull(d.r, d.head); err != nil {
+		if n == 0 && errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, ErrIncompleteRead
+	}
+	crc := d.c.readChecksum(d.head)
+
+	var (
+		h   Header
+		err error
+	)
+	if d.c.format == FormatCompact {
+		h, err = d.readCompactHeader()
+	} else {
+		h, err = d.readFixedHeader()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hsz := len(d.head)
+	ksz, vsz := uint64(h.KSz), uint64(h.VSz)
+	if ksz+vsz > uint64(max(d.size-d.off-int64(hsz), 0)) {
+		return nil, ErrIncompleteRead
+	}
+	rec := make([]byte, uint64(hsz-csz)+ksz+vsz)
+	copy(rec, d.head[csz:])
+	if _, err := io.ReadFull(d.r, rec[hsz-csz:]); err != nil {
+		return nil, ErrIncompleteRead
+	}
+
+	if !d.c.checksum.Verify(rec, crc) {
+		return nil, ErrCRCValidation
+	}
+
+	d.off += int64(csz + len(rec))
+
+	kv := rec[hsz-csz:]
+	val := kv[ksz:]
+	if len(val) == 0 {
+		val = []byte{}
+	}
+
+	return &internal.Entry{
+		CRC:    crc,
+		Type:   h.Type,
+		Tstamp: h.Tstamp,
+		Seq:    h.Seq,
+		Expiry: h.Expiry,
+		Key:    kv[:ksz:ksz],
+		Val:    val,
+	}, nil
+}
+
+func (d *Decoder) readFixedHeader() (Header, error) {
+	csz := len(d.head)
+	d.head = d.head[:d.c.HeaderSize()]
+	if _, err := io.ReadFull(d.r, d.head[csz:]); err != nil {
+		return Header{}, ErrIncompleteRead
+	}
+	return d.c.readFixedHeader(d.head), nil
+}
+
+func (d *Decoder) readCompactHeader() (Header, error) {
+	h, err := d.c.readCompactFields(headReader{d})
+	if err != nil {
+		return Header{}, compactHeaderErr(err)
+	}
+	return h, nil
+}
+
+// headReader 将读取的字节记录到记录头中, 供 binary.ReadUvarint 使用
+type headReader struct {
+	d *Decoder
+}
+
+func (hr headReader) ReadByte() (byte, error) {
+	b, err := hr.d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	hr.d.head = append(hr.d.head, b)
+	return b, nil
+}
+
+func compactHeaderErr(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrIncompleteRead
+	}
+	return ErrInvalidHeader
+}
@@ -0,0 +1,163 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var formats = []Format{FormatFixed, FormatCompact}
+
+func TestCodec_CompactRoundTrip(t *testing.T) {
+	c := New(NewFileHeader(ChecksumIEEE, FormatCompact))
+
+	key := []byte("counter:1")
+	val := []byte{0x2a}
+	encoded := c.Encode(key, val, false)
+	assert.Less(t, len(encoded), headerSize+len(key)+len(val),
+		"Compact records should be smaller than fixed records")
+
+	entry, err := c.Decode(encoded)
+	require.NoError(t, err, "Decoding should not return errors")
+	assert.Equal(t, key, entry.Key, "The decoded key does not match")
+	assert.Equal(t, val, entry.Val, "The decoded value does not match")
+	assert.InDelta(t, time.Now().Unix(), entry.Tstamp, 1,
+		"Timestamp deviation is too large")
+
+	_, err = c.Decode(encoded[:len(encoded)-1])
+	assert.ErrorIs(t, err, ErrIncompleteRead, "Truncated data should be rejected")
+
+	encoded[len(encoded)-1] ^= 0x01
+	_, err = c.Decode(encoded)
+	assert.ErrorIs(t, err, ErrCRCValidation, "Tampered data should fail validation")
+}
+
+func TestCodec_CompactDeletedEntry(t *testing.T) {
+	c := New(NewFileHeader(ChecksumXXHash64, FormatCompact))
+
+	entry, err := c.Decode(c.Encode([]byte("deletedKey"), []byte("ignored"), true))
+	require.NoError(t, err, "Decoding should not return errors")
+	assert.Equal(t, []byte("deletedKey"), entry.Key, "Delete entry key mismatch")
+	assert.Empty(t, entry.Val, "To delete an entry the value should be empty")
+}
+
+func TestDecoder_Stream(t *testing.T) {
+	kvs := [][2][]byte{
+		{[]byte("a"), []byte("1")},
+		{[]byte("bb"), []byte("")},
+		{[]byte("ccc"), bytes.Repeat([]byte("v"), 1024*100)},
+	}
+
+	for _, f := range formats {
+		for _, cs := range checksums {
+			t.Run(f.String()+"/"+cs.String(), func(t *testing.T) {
+				c := New(NewFileHeader(cs, f))
+
+				var buf bytes.Buffer
+				var offsets []int64
+				for _, kv := range kvs {
+					offsets = append(offsets, int64(buf.Len()))
+					buf.Write(c.Encode(kv[0], kv[1], false))
+				}
+
+				d := c.NewDecoder(&buf, int64(buf.Len()))
+				for i, kv := range kvs {
+					assert.Equal(t, offsets[i], d.Offset(), "Record offset does not match")
+
+					entry, err := d.Decode()
+					require.NoError(t, err, "Decoding should not return errors")
+					assert.Equal(t, kv[0], entry.Key, "The decoded key does not match")
+					assert.Equal(t, kv[1], entry.Val, "The decoded value does not match")
+				}
+
+				_, err := d.Decode()
+				assert.ErrorIs(t, err, io.EOF, "Should return io.EOF at the end of stream")
+			})
+		}
+	}
+}
+
+func TestDecoder_Truncated(t *testing.T) {
+	for _, f := range formats {
+		c := New(NewFileHeader(ChecksumIEEE, f))
+		encoded := c.Encode([]byte("key"), []byte("value"), false)
+
+		for _, n := range []int{1, 5, len(encoded) - 1} {
+			d := c.NewDecoder(bytes.NewReader(encoded[:n]), int64(n))
+			_, err := d.Decode()
+			assert.ErrorIs(t, err, ErrIncompleteRead,
+				"Truncated %s record should return an incomplete data error", f)
+		}
+
+		// 记录头中的长度超过剩余数据时不应按该长度分配内存
+		head := c.EncodeHeader(internal.TypeNormal, 1700000000, 1, 0, []byte("key"), math.MaxUint32)
+		forged := append(head, "keyvalue"...)
+		_, err := c.NewDecoder(bytes.NewReader(forged), int64(len(forged))).Decode()
+		assert.ErrorIs(t, err, ErrIncompleteRead, "Oversized %s record should return an incomplete data error", f)
+	}
+}
+
+func TestCodec_RecordType(t *testing.T) {
+	for _, f := range formats {
+		c := New(NewFileHeader(ChecksumIEEE, f))
+
+		e := &internal.Entry{
+			Type:   internal.TypeBlobPointer,
+			Tstamp: 1700000000,
+			Key:    bytes.Repeat([]byte("k"), 300),
+			Val:    []byte("pointer"),
+		}
+		entry, err := c.Decode(c.EncodeEntry(e))
+		require.NoError(t, err, "Decoding should not return errors")
+		assert.Equal(t, e.Type, entry.Type, "Record type does not match")
+		assert.Equal(t, e.Tstamp, entry.Tstamp, "Timestamp should be preserved")
+		assert.Equal(t, e.Key, entry.Key, "The decoded key does not match")
+
+		rec := c.Encode([]byte("k"), nil, true)
+		entry, err = c.NewDecoder(bytes.NewReader(rec), int64(len(rec))).Decode()
+		require.NoError(t, err, "Decoding should not return errors")
+		assert.Equal(t, internal.TypeDeleted, entry.Type, "Deleted records should carry the tombstone type")
+	}
+}
+
+func TestCodec_SeqAndExpiry(t *testing.T) {
+	e := &internal.Entry{Tstamp: 1700000000, Seq: 1<<40 + 7, Expiry: 1700000000123, Key: []byte("key"), Val: []byte("value")}
+
+	for _, f := range formats {
+		for _, version := range []uint8{1, fileHeaderVersion} {
+			h := NewFileHeader(ChecksumIEEE, f)
+			h.Version = version
+			c := New(h)
+			want, expiry := e.Seq, e.Expiry
+			if version < seqVersion {
+				want, expiry = 0, 0
+			}
+			assert.Equal(t, version >= seqVersion, c.HasSeq())
+
+			encoded := c.EncodeEntry(e)
+			entry, err := c.Decode(encoded)
+			require.NoError(t, err, "Decoding v%d %s record should not return errors", version, f)
+			assert.Equal(t, want, entry.Seq, "Sequence number mismatch in v%d %s record", version, f)
+			assert.Equal(t, expiry, entry.Expiry, "Expiry mismatch in v%d %s record", version, f)
+			assert.Equal(t, e.Val, entry.Val)
+
+			hdr, err := c.DecodeHeader(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, want, hdr.Seq)
+			assert.Equal(t, expiry, hdr.Expiry)
+			assert.Equal(t, len(encoded)-len(e.Key)-len(e.Val), hdr.Size)
+
+			entry, err = c.NewDecoder(bytes.NewReader(encoded), int64(len(encoded))).Decode()
+			require.NoError(t, err)
+			assert.Equal(t, want, entry.Seq)
+			assert.Equal(t, expiry, entry.Expiry)
+			assert.Equal(t, e.Key, entry.Key)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package datafile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/fileio"
+)
+
+const (
+	DataExt = ".data"
+	HintExt = ".hint"
+	BlobExt = ".blob"
+)
+
+// Name 返回 id 对应的文件路径, 如 000000001.data
+func Name(dir string, id uint32, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%09d%s", id, ext))
+}
+
+// List 返回目录中扩展名为 ext 的文件 id, 按升序排列
+func List(dir, ext string) ([]uint32, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint32
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// DataFile 数据文件, 以文件头开始, 之后是追加写入的记录
+type DataFile struct {
+	id     uint32
+	path   string
+	fio    fileio.FileIO
+	header codec.FileHeader
+	codec  *codec.Codec
+	size   int64
+}
+
+// Open 打开数据文件, 文件为空时写入 hdr 作为文件头, 否则使用文件中已有的文件头
+func Open(path string, id uint32, hdr codec.FileHeader) (*DataFile, error) {
+	f, err := fileio.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return open(f, path, id, hdr, true)
+}
+
+// OpenReadOnly 以只读方式打开数据文件, 不会写入文件头, 文件为空时视为使用 hdr 的空文件
+func OpenReadOnly(path string, id uint32, hdr codec.FileHeader) (*DataFile, error) {
+	f, err := fileio.OpenReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	return open(f, path, id, hdr, false)
+}
+
+func open(f fileio.FileIO, path string, id uint32, hdr codec.FileHeader, writable bool) (*DataFile, error) {
+	size, err := f.Size()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	if size == 0 {
+		if writable {
+			if _, err := f.Write(codec.EncodeFileHeader(hdr)); err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+		}
+		size = codec.FileHeaderSize
+	} else {
+		buf := make([]byte, codec.FileHeaderSize)
+		if _, err := f.ReadAt(buf, 0); err != nil {
+			_ = f.Close()
+			return nil, codec.ErrInvalidFileHeader
+		}
+		if hdr, err = codec.DecodeFileHeader(buf); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
+	return &DataFile{
+		id:     id,
+		path:   path,
+		fio:    f,
+		header: hdr,
+		codec:  codec.New(hdr),
+		size:   size,
+	}, nil
+}
+
+func (df *DataFile) ID() uint32 {
+	return df.id
+}
+
+func (df *DataFile) Path() string {
+	return df.path
+}
+
+func (df *DataFile) Header() codec.FileHeader {
+	return df.header
+}
+
+// Codec 返回该文件记录使用的编解码器
+func (df *DataFile) Codec() *codec.Codec {
+	return df.codec
+}
+
+// Size 返回文件大小, 包括文件头
+func (df *DataFile) Size() int64 {
+	return df.size
+}
+
+// Empty 判断文件中是否还没有记录
+func (df *DataFile) Empty() bool {
+	return df.size <= codec.FileHeaderSize
+}
+
+// Write 追加一条已编码的记录, 返回记录的偏移量
+func (df *DataFile) Write(rec []byte) (int64, error) {
+	pos := df.size
+	if _, err := (appender{df}).Write(rec); err != nil {
+		return 0, err
+	}
+	return pos, nil
+}
+
+// WriteStream 流式追加一条记录, 值从 r 中读取 size 字节, 写完值后回填校验和
+//
+// 流式写入的记录没有过期时间. 写入失败时文件被截断到写入前的大小, 返回记录的偏移量和大小
+func (df *DataFile) WriteStream(typ internal.RecordType, tstamp int64, seq uint64, key []byte, r io.Reader, size uint32) (int64, uint32, error) {
+	pos := df.size
+
+	head := df.codec.EncodeHeader(typ, tstamp, seq, 0, key, size)
+	csz := df.codec.Checksum().Size()
+	digest := df.codec.Checksum().New()
+	_, _ = digest.Write(head[csz:])
+
+	err := func() error {
+		if _, err := df.Write(head); err != nil {
+			return err
+		}
+
+		n, err := io.CopyN(io.MultiWriter(appender{df}, digest), r, int64(size))
+		if n < int64(size) && errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+
+		df.codec.PutChecksum(head, digest.Sum64())
+		_, err = df.fio.WriteAt(head[:csz], pos)
+		return err
+	}()
+	if err != nil {
+		_ = df.Truncate(pos)
+		return 0, 0, err
+	}
+
+	return pos, uint32(len(head)) + size, nil
+}
+
+// appender 以 io.Writer 的形式向文件追加数据
+type appender struct {
+	df *DataFile
+}
+
+func (a appender) Write(b []byte) (int, error) {
+	n, err := a.df.fio.Write(b)
+	a.df.size += int64(n)
+	return n, err
+}
+
+// Truncate 截断文件到 size, 丢弃之后的数据
+func (df *DataFile) Truncate(size int64) error {
+	if err := df.fio.Truncate(size); err != nil {
+		return err
+	}
+	df.size = size
+	return nil
+}
+
+// ReadAt 读取文件中 off 处的数据
+func (df *DataFile) ReadAt(b []byte, off int64) (int, error) {
+	return df.fio.ReadAt(b, off)
+}
+
+// Read 读取并解码 pos 处大小为 size 的记录
+func (df *DataFile) Read(pos int64, size uint32) (*internal.Entry, error) {
+	buf := make([]byte, size)
+	if _, err := df.fio.ReadAt(buf, pos); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, codec.ErrIncompleteRead
+		}
+		return nil, err
+	}
+	e, err := df.codec.Decode(buf)
+	if err != nil {
+		return nil, err
+	}
+	df.fillSeq(e, pos)
+	return e, nil
+}
+
+// LegacySeq 版本 1 的文件中的记录没有序列号, 使用记录的位置 | id(高32位) | pos(低32位) | 代替.
+// 新分配的序列号总是大于已加载的最大序列号, 两者不会重复
+func LegacySeq(id uint32, pos int64) uint64 {
+	return uint64(id)<<32 | uint64(pos)
+}
+
+func (df *DataFile) fillSeq(e *internal.Entry, pos int64) {
+	if !df.codec.HasSeq() {
+		e.Seq = LegacySeq(df.id, pos)
+	}
+}
+
+// Scan 从头顺序读取文件中的记录, fn 返回错误时停止
+//
+// 旧版本文件中记录的序列号由 LegacySeq 生成.
+// 文件末尾不完整的记录, 以及校验失败的最后一条记录(流式写入未回填校验和)
+// 视为崩溃时未写完的数据, 将被忽略
+func (df *DataFile) Scan(fn func(e *internal.Entry, pos int64, size uint32) error) error {
+	r := io.NewSectionReader(df.fio, codec.FileHeaderSize, df.size-codec.FileHeaderSize)
+	d := df.codec.NewDecoder(r, r.Size())
+
+	for {
+		pos := codec.FileHeaderSize + d.Offset()
+		e, err := d.Decode()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, codec.ErrIncompleteRead) {
+				return nil
+			}
+			if errors.Is(err, codec.ErrCRCValidation) {
+				if _, nerr := d.Decode(); errors.Is(nerr, io.EOF) {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s at offset %d: %w", df.path, pos, err)
+		}
+
+		size := codec.FileHeaderSize + d.Offset() - pos
+		df.fillSeq(e, pos)
+		if err := fn(e, pos, uint32(size)); err != nil {
+			return err
+		}
+	}
+}
+
+func (df *DataFile) Sync() error {
+	return df.fio.Sync()
+}
+
+func (df *DataFile) Close() error {
+	return df.fio.Close()
+}
@@ -0,0 +1,84 @@
+package datafile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+)
+
+// Reader 使用独立的只读句柄顺序读取数据文件的前 size 字节
+//
+// 打开后文件被合并删除, 或者继续被追加写入, 都不影响读取的内容
+type Reader struct {
+	f     *os.File
+	path  string
+	codec *codec.Codec
+	d     *codec.Decoder
+	base  int64
+}
+
+// OpenReader 打开数据文件, 从偏移 off 开始读取到 size 为止, off 必须是记录的起始位置
+func OpenReader(path string, off, size int64) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, codec.FileHeaderSize)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		_ = f.Close()
+		return nil, codec.ErrInvalidFileHeader
+	}
+	hdr, err := codec.DecodeFileHeader(buf)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	off = max(off, codec.FileHeaderSize)
+	c := codec.New(hdr)
+	return &Reader{
+		f:     f,
+		path:  path,
+		codec: c,
+		d:     c.NewDecoder(io.NewSectionReader(f, off, max(size-off, 0)), max(size-off, 0)),
+		base:  off,
+	}, nil
+}
+
+// Codec 返回文件使用的记录编码
+func (r *Reader) Codec() *codec.Codec {
+	return r.codec
+}
+
+// Next 返回下一条记录及其在文件中的位置, 读完时返回 io.EOF
+//
+// 与 Scan 相同, 末尾不完整的记录以及校验失败的最后一条记录被忽略
+func (r *Reader) Next() (*internal.Entry, int64, error) {
+	pos := r.base + r.d.Offset()
+	e, err := r.d.Decode()
+	if err == nil {
+		return e, pos, nil
+	}
+
+	if errors.Is(err, codec.ErrIncompleteRead) {
+		return nil, pos, io.EOF
+	}
+	if errors.Is(err, io.EOF) {
+		return nil, pos, err
+	}
+	if errors.Is(err, codec.ErrCRCValidation) {
+		if _, nerr := r.d.Decode(); errors.Is(nerr, io.EOF) {
+			return nil, pos, io.EOF
+		}
+	}
+	return nil, pos, fmt.Errorf("%s at offset %d: %w", r.path, pos, err)
+}
+
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,109 @@
+package datafile
+
+import (
+	"errors"
+	"io"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+)
+
+// resyncWindow 重新同步时每次读取的字节数
+const resyncWindow = 64 * 1024
+
+// Corruption 文件中无法通过校验的区间
+type Corruption struct {
+	Offset int64
+	Size   int64
+	Err    error
+}
+
+// Verify 校验 r 中前 size 字节的所有记录, 对每条通过校验的记录调用 fn
+//
+// 与 Scan 不同, 遇到无法解码或校验失败的记录时不会停止, 而是逐字节向后查找下一条
+// 可以通过校验的记录继续, 跳过的区间作为 Corruption 返回, 文件末尾不完整的记录同样视为损坏.
+// 读取 r 失败时返回该错误
+func Verify(r io.ReaderAt, size int64, fn func(e *internal.Entry, pos int64, size uint32)) ([]Corruption, error) {
+	hdr := make([]byte, codec.FileHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	fh, err := codec.DecodeFileHeader(hdr)
+	if err != nil {
+		// 没有文件头时无法确定记录格式
+		return []Corruption{{Offset: 0, Size: size, Err: err}}, nil
+	}
+	c := codec.New(fh)
+
+	var bad []Corruption
+	for off := int64(codec.FileHeaderSize); off < size; {
+		d := c.NewDecoder(io.NewSectionReader(r, off, size-off), size-off)
+		for {
+			pos := off + d.Offset()
+			e, err := d.Decode()
+			if err == nil {
+				fn(e, pos, uint32(off+d.Offset()-pos))
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return bad, nil
+			}
+
+			next, rerr := resync(r, c, pos+1, size)
+			if rerr != nil {
+				return nil, rerr
+			}
+			bad = append(bad, Corruption{Offset: pos, Size: next - pos, Err: err})
+			off = next
+			break
+		}
+	}
+	return bad, nil
+}
+
+// resync 返回 from 之后第一条可以通过校验的记录的位置, 找不到时返回 size
+func resync(r io.ReaderAt, c *codec.Codec, from, size int64) (int64, error) {
+	// 多读取一个记录头的长度, 使窗口末尾的候选位置也能解析记录头
+	buf := make([]byte, resyncWindow+c.HeaderSize())
+	for base := from; base < size; base += resyncWindow {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), size-base)], base)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := 0; i < min(n, resyncWindow); i++ {
+			ok, err := validAt(r, c, buf[i:n], base+int64(i), size)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return base + int64(i), nil
+			}
+		}
+	}
+	return size, nil
+}
+
+// validAt 判断 pos 处是否为一条完整且通过校验的记录, b 为从 pos 开始已读取的数据
+func validAt(r io.ReaderAt, c *codec.Codec, b []byte, pos, size int64) (bool, error) {
+	// 未知的记录类型只可能来自损坏的数据
+	h, err := c.DecodeHeader(b)
+	if err != nil || h.Type > internal.TypeCounter {
+		return false, nil
+	}
+	total := int64(h.Size) + int64(h.KSz) + int64(h.VSz)
+	if pos+total > size {
+		return false, nil
+	}
+
+	if total > int64(len(b)) {
+		b = make([]byte, total)
+		if _, err := r.ReadAt(b, pos); err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	_, err = c.Decode(b[:total])
+	return err == nil, nil
+}
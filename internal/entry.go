@@ -1,8 +1,35 @@
 package internal
 
+// RecordType 记录类型
+type RecordType uint8
+
+const (
+	// TypeNormal 普通键值记录
+	TypeNormal RecordType = iota
+	// TypeDeleted 墓碑记录
+	TypeDeleted
+	// TypeBlobPointer 值分离存储, 记录的值为指向 blob 文件的 BlobPointer
+	TypeBlobPointer
+	// TypeChunked 值按固定大小分块存储, 每个分块附带校验和, 支持部分读取时校验
+	TypeChunked
+	// TypeBatch 批量写入的开始标记, 之后的记录直到 TypeCommit 为止属于同一批次
+	TypeBatch
+	// TypeCommit 批量写入的提交标记, 值为批次中的记录数, 没有提交标记的批次在加载时被丢弃.
+	// 合并时写入的不属于任何批次的提交标记没有值, 只用于保存最后分配的序列号
+	TypeCommit
+	// TypeCounter 计数器记录, 值为定长 8 字节的有符号整数, 读取时转换为十进制文本
+	TypeCounter
+
+	// MaxRecordType 记录类型的上限, 记录头中仅为类型保留 4 bit
+	MaxRecordType RecordType = 0x0f
+)
+
 type Entry struct {
-	CRC    uint32
+	CRC    uint64
+	Type   RecordType
 	Tstamp int64
+	Seq    uint64 // 写入时分配的序列号, 批次标记和 blob 文件中的记录为 0
+	Expiry int64  // 过期时间, Unix 毫秒, 0 表示不过期
 	Key    []byte
 	Val    []byte
 }
@@ -2,6 +2,7 @@ package fileio
 
 import (
 	"bufio"
+	"io"
 	"os"
 )
 
@@ -18,12 +19,16 @@ type Bufile struct {
 
 func newBufile(f string, bufSize int) (*Bufile, error) {
 	file, err := os.OpenFile(f,
-		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		os.O_RDWR|os.O_CREATE,
 		0644,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
 
 	return &Bufile{
 		f: file,
@@ -42,6 +47,26 @@ func (bf *Bufile) Write(b []byte) (n int, err error) {
 	return bf.w.Write(b)
 }
 
+// WriteAt implements FileIO.
+func (bf *Bufile) WriteAt(b []byte, off int64) (n int, err error) {
+	if err := bf.w.Flush(); err != nil {
+		return 0, err
+	}
+	return bf.f.WriteAt(b, off)
+}
+
+// Truncate implements FileIO.
+func (bf *Bufile) Truncate(size int64) error {
+	if err := bf.w.Flush(); err != nil {
+		return err
+	}
+	if err := bf.f.Truncate(size); err != nil {
+		return err
+	}
+	_, err := bf.f.Seek(size, io.SeekStart)
+	return err
+}
+
 // Sync implements FileIO.
 func (bf *Bufile) Sync() error {
 	if err := bf.w.Flush(); err != nil {
@@ -2,6 +2,7 @@ package fileio
 
 import (
 	"errors"
+	"io"
 	"os"
 )
 
@@ -16,6 +17,8 @@ var (
 type FileIO interface {
 	ReadAt(b []byte, off int64) (n int, err error)
 	Write(b []byte) (n int, err error)
+	WriteAt(b []byte, off int64) (n int, err error)
+	Truncate(size int64) error
 	Sync() error
 	Close() error
 	Size() (size int64, err error)
@@ -25,8 +28,16 @@ func Open(filename string) (FileIO, error) {
 	return newFile(filename)
 }
 
+// OpenReadOnly 以只读方式打开已经存在的文件, 写入返回错误
+func OpenReadOnly(filename string) (FileIO, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: file}, nil
+}
+
 // func OpenWithBuf(filename string)   {}
-// func OpenReadOnly(filename string)  {}
 // func OpenWriteOnly(filename string) {}
 // func OpenAppend(filename string)    {}
 
@@ -46,14 +57,20 @@ type File struct {
 	f *os.File
 }
 
+// newFile 打开文件并定位到文件末尾
+// 不使用 O_APPEND, 以便通过 WriteAt 回填已写入的数据(如流式写入记录的校验和)
 func newFile(fName string) (*File, error) {
 	file, err := os.OpenFile(fName,
-		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		os.O_RDWR|os.O_CREATE,
 		0644,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
 	return &File{f: file}, nil
 }
 
@@ -65,6 +82,19 @@ func (f *File) Write(b []byte) (n int, err error) {
 	return f.f.Write(b)
 }
 
+func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	return f.f.WriteAt(b, off)
+}
+
+// Truncate 截断文件, 之后的写入从 size 处开始
+func (f *File) Truncate(size int64) error {
+	if err := f.f.Truncate(size); err != nil {
+		return err
+	}
+	_, err := f.f.Seek(size, io.SeekStart)
+	return err
+}
+
 func (f *File) Sync() error {
 	return f.f.Sync()
 }
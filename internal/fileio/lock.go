@@ -21,6 +21,7 @@ type Lock struct {
 	path    string
 	file    *os.File
 	locked  bool
+	shared  bool
 	timeout time.Duration
 }
 
@@ -32,15 +33,21 @@ func NewLock(dir string) *Lock {
 }
 
 func (l *Lock) Lock() error {
-	return l.lock(false, 0)
+	return l.lock(syscall.LOCK_EX, false, 0)
 }
 
 func (l *Lock) TryLock() error {
-	return l.lock(true, 0)
+	return l.lock(syscall.LOCK_EX, true, 0)
+}
+
+// TryRLock 非阻塞地获取共享锁, 多个共享锁可以同时持有, 与排他锁互斥.
+// 目录必须已经存在, 获取共享锁不会在目录中创建任何文件
+func (l *Lock) TryRLock() error {
+	return l.lock(syscall.LOCK_SH, true, 0)
 }
 
 func (l *Lock) LockWithTimeout(timeout time.Duration) error {
-	return l.lock(false, timeout)
+	return l.lock(syscall.LOCK_EX, false, timeout)
 }
 
 func (l *Lock) UnLock() error {
@@ -64,21 +71,28 @@ func (l *Lock) IsLocked() bool {
 	return l.locked
 }
 
+// IsShared 判断持有的是否为共享锁
+func (l *Lock) IsShared() bool {
+	return l.shared
+}
+
 func (l *Lock) Path() string {
 	return l.path
 }
 
-func (l *Lock) lock(nonblocking bool, timeout time.Duration) error {
+// lock 对目录本身加 flock, how 为 LOCK_EX 或 LOCK_SH
+func (l *Lock) lock(how int, nonblocking bool, timeout time.Duration) error {
 	if l.locked {
 		return ErrAlreadyLocked
 	}
 
-	if err := os.MkdirAll(l.path, 0755); err != nil {
-		return err
+	if how == syscall.LOCK_EX {
+		if err := os.MkdirAll(l.path, 0755); err != nil {
+			return err
+		}
 	}
 
-	lockFile := filepath.Join(l.path, ".flock")
-	file, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0644)
+	file, err := os.Open(l.path)
 	if err != nil {
 		return err
 	}
@@ -89,21 +103,22 @@ func (l *Lock) lock(nonblocking bool, timeout time.Duration) error {
 		deadline := time.Now().Add(timeout)
 
 		for {
-			err = syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+			err = syscall.Flock(fd, how|syscall.LOCK_NB)
 			if err == nil {
 				break
 			}
 
 			if time.Now().After(deadline) {
+				file.Close()
 				return ErrLockTimeout
 			}
 
 			time.Sleep(50 * time.Millisecond)
 		}
 	} else if nonblocking {
-		err = syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+		err = syscall.Flock(fd, how|syscall.LOCK_NB)
 	} else {
-		err = syscall.Flock(fd, syscall.LOCK_EX)
+		err = syscall.Flock(fd, how)
 	}
 
 	if err != nil {
@@ -113,6 +128,7 @@ func (l *Lock) lock(nonblocking bool, timeout time.Duration) error {
 
 	l.file = file
 	l.locked = true
+	l.shared = how == syscall.LOCK_SH
 	l.timeout = timeout
 	return nil
 }
@@ -52,3 +52,37 @@ func Test_ConcurrentAccess_Lock(t *testing.T) {
 		t.Errorf("expect successCount is 1, but actually is %d", successCount)
 	}
 }
+
+func Test_SharedLock(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	r1, r2 := NewLock(tmpDir), NewLock(tmpDir)
+	if err := r1.TryRLock(); err != nil {
+		t.Fatalf("shared lock failed: %v", err)
+	}
+	if err := r2.TryRLock(); err != nil {
+		t.Fatalf("second shared lock failed: %v", err)
+	}
+
+	w := NewLock(tmpDir)
+	if err := w.TryLock(); err == nil {
+		t.Fatal("exclusive lock should fail while shared locks are held")
+	}
+
+	_ = r1.UnLock()
+	_ = r2.UnLock()
+	if err := w.TryLock(); err != nil {
+		t.Fatalf("exclusive lock failed: %v", err)
+	}
+	defer w.UnLock()
+
+	if err := NewLock(tmpDir).TryRLock(); err == nil {
+		t.Fatal("shared lock should fail while an exclusive lock is held")
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("lock should not create files, got %d entries", len(entries))
+	}
+	if err := NewLock(filepath.Join(tmpDir, "missing")).TryRLock(); err == nil {
+		t.Error("shared lock should not create a missing directory")
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"bytes"
+
+	"github.com/google/btree"
+)
+
+// BlobPointer 指向 blob 文件中的值
+type BlobPointer struct {
+	FileID  uint32
+	Offset  int64
+	Size    uint32
+	Chunked bool
+}
+
+// KeydirEntry keydir 中每个键最新数据的元信息
+type KeydirEntry struct {
+	FileID    uint32
+	RecordPos int64
+	RecordSz  uint32
+	ValuePos  int64
+	ValueSz   uint32
+	Tstamp    int64
+	Seq       uint64
+	Expiry    int64 // 过期时间, Unix 毫秒, 0 表示不过期
+	Chunked   bool
+	Counter   bool
+	Blob      *BlobPointer
+}
+
+// Expired 判断记录在 now (Unix 毫秒) 时是否已经过期
+func (e *KeydirEntry) Expired(now int64) bool {
+	return e.Expiry != 0 && e.Expiry <= now
+}
+
+type keydirItem struct {
+	key   []byte
+	entry *KeydirEntry
+}
+
+func lessItem(a, b keydirItem) bool {
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// Keydir 内存索引, 键按字节序有序
+//
+// Keydir 不是并发安全的, 由调用方加锁
+type Keydir struct {
+	tree *btree.BTreeG[keydirItem]
+}
+
+func NewKeydir() *Keydir {
+	return &Keydir{
+		tree: btree.NewG(32, lessItem),
+	}
+}
+
+// Get 返回 key 对应的元信息
+func (kd *Keydir) Get(key []byte) (*KeydirEntry, bool) {
+	item, ok := kd.tree.Get(keydirItem{key: key})
+	return item.entry, ok
+}
+
+// Put 更新 key 的元信息, 返回旧的元信息
+func (kd *Keydir) Put(key []byte, entry *KeydirEntry) (*KeydirEntry, bool) {
+	old, ok := kd.tree.ReplaceOrInsert(keydirItem{key: key, entry: entry})
+	return old.entry, ok
+}
+
+// Delete 删除 key, 返回旧的元信息
+func (kd *Keydir) Delete(key []byte) (*KeydirEntry, bool) {
+	old, ok := kd.tree.Delete(keydirItem{key: key})
+	return old.entry, ok
+}
+
+// Clone 返回 keydir 的快照, 写时复制
+//
+// Clone 需要独占访问, 返回后两者可以分别并发使用
+func (kd *Keydir) Clone() *Keydir {
+	return &Keydir{tree: kd.tree.Clone()}
+}
+
+// Len 返回键的数量
+func (kd *Keydir) Len() int {
+	return kd.tree.Len()
+}
+
+// Ascend 按键的字节序遍历, fn 返回 false 时停止
+func (kd *Keydir) Ascend(fn func(key []byte, entry *KeydirEntry) bool) {
+	kd.tree.Ascend(func(item keydirItem) bool {
+		return fn(item.key, item.entry)
+	})
+}
+
+// AscendFrom 从不小于 from 的第一个键开始按字节序遍历, fn 返回 false 时停止
+func (kd *Keydir) AscendFrom(from []byte, fn func(key []byte, entry *KeydirEntry) bool) {
+	kd.tree.AscendGreaterOrEqual(keydirItem{key: from}, func(item keydirItem) bool {
+		return fn(item.key, item.entry)
+	})
+}
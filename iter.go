@@ -1 +1,40 @@
 package bitcask
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+)
+
+// ScanKeys 按字节序返回以 prefix 为前缀且大于 after 的键, 最多 limit 个
+//
+// limit 不大于 0 时不限制数量. 将上一次返回的最后一个键作为 after 即可分页遍历,
+// 遍历期间一直存在的键都会被返回. 返回的键为副本, 调用方可以修改
+func (b *Bitcask) ScanKeys(prefix, after []byte, limit int) ([][]byte, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	from := prefix
+	if bytes.Compare(after, prefix) >= 0 {
+		from = after
+	}
+
+	var keys [][]byte
+	now := time.Now().UnixMilli()
+	b.keydir.AscendFrom(from, func(key []byte, entry *internal.KeydirEntry) bool {
+		if !bytes.HasPrefix(key, prefix) {
+			return false
+		}
+		if (after != nil && bytes.Equal(key, after)) || entry.Expired(now) {
+			return true
+		}
+		keys = append(keys, bytes.Clone(key))
+		return limit <= 0 || len(keys) < limit
+	})
+	return keys, nil
+}
@@ -0,0 +1,75 @@
+package bitcask
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitcask_ScanKeys(t *testing.T) {
+	db := openTestBitcask(t, t.TempDir())
+
+	for i := range 10 {
+		require.NoError(t, db.Put([]byte(fmt.Sprintf("a%d", i)), []byte("v")))
+	}
+	require.NoError(t, db.Put([]byte("b"), []byte("v")))
+
+	keys, err := db.ScanKeys([]byte("a"), nil, 4)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a0"), []byte("a1"), []byte("a2"), []byte("a3")}, keys)
+
+	// 以上一页的最后一个键继续
+	keys, err = db.ScanKeys([]byte("a"), keys[len(keys)-1], 0)
+	require.NoError(t, err)
+	assert.Len(t, keys, 6)
+	assert.Equal(t, "a4", string(keys[0]))
+
+	keys, err = db.ScanKeys(nil, []byte("a9"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("b")}, keys)
+
+	ok, err := db.Has([]byte("b"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, db.Delete([]byte("b")))
+	ok, err = db.Has([]byte("b"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestBitcask_KeysAreCopies(t *testing.T) {
+	db := openTestBitcask(t, t.TempDir())
+	require.NoError(t, db.Put([]byte("a"), []byte("v")))
+
+	listed, err := db.ListKeys()
+	require.NoError(t, err)
+	scanned, err := db.ScanKeys(nil, nil, 0)
+	require.NoError(t, err)
+	listed[0][0], scanned[0][0] = 'x', 'y'
+
+	keys, err := db.ListKeys()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a")}, keys, "Modifying returned keys should not affect the keydir")
+	val, err := db.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+}
+
+func TestBitcask_Stats(t *testing.T) {
+	db := openTestBitcask(t, t.TempDir(), WithBlobThreshold(16))
+
+	require.NoError(t, db.Put([]byte("small"), []byte("v")))
+	require.NoError(t, db.Put([]byte("large"), make([]byte, 64)))
+	require.NoError(t, db.Put([]byte("large"), make([]byte, 64)))
+
+	st, err := db.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, st.Keys)
+	assert.Equal(t, 1, st.DataFiles)
+	assert.Positive(t, st.DataSize)
+	assert.Equal(t, 1, st.BlobFiles)
+	assert.Positive(t, st.BlobDead)
+	assert.Less(t, st.BlobDead, st.BlobSize)
+}
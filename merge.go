@@ -1 +1,449 @@
 package bitcask
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+const (
+	mergeDirName = "merge"
+	mergeFinName = "MERGE_FIN"
+)
+
+// relocation 合并过程中被移动的记录, to 为 nil 时记录已过期并被清除
+type relocation struct {
+	key  []byte
+	from *internal.KeydirEntry
+	to   *internal.KeydirEntry
+}
+
+// merger 将有效记录写入合并目录, 输出文件复用输入文件的 id
+//
+// 合并后的有效数据不会多于输入数据, 因此输出文件的 id 总是小于未参与合并的文件,
+// 加载时不会覆盖更新的数据; id 不够用时继续写入最后一个输出文件
+type merger struct {
+	dir  string
+	opts *Options
+	ids  []uint32
+	next int
+	out  *datafile.DataFile
+	hint *datafile.DataFile
+	outs []uint32
+	seqs map[uint32]uint64 // 每个输出文件中记录的最大序列号
+	last uint64            // 合并开始时最后分配的序列号
+}
+
+func (m *merger) write(e *internal.Entry, blob *internal.BlobPointer) (*internal.KeydirEntry, error) {
+	if m.out == nil {
+		if err := m.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	rec := m.out.Codec().EncodeEntry(e)
+	if !m.out.Empty() && m.out.Size()+int64(len(rec)) > m.opts.MaxFileSize && m.next < len(m.ids) {
+		if err := m.rotate(); err != nil {
+			return nil, err
+		}
+		rec = m.out.Codec().EncodeEntry(e)
+	}
+
+	pos, err := m.out.Write(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	m.seqs[m.out.ID()] = max(m.seqs[m.out.ID()], e.Seq)
+	entry := newKeydirEntry(m.out.ID(), e, pos, uint32(len(rec)), uint32(len(e.Val)))
+	entry.Blob = blob
+	if e.Type == internal.TypeDeleted {
+		return nil, writeHintTombstone(m.hint, e.Key, e.Tstamp, e.Seq)
+	}
+	if err := writeHint(m.hint, e.Key, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// writeSeq 写入不属于任何批次的提交标记, 保存合并开始时最后分配的序列号,
+// 该序列号所在的记录被清除后, 重新打开时也不会再次分配
+func (m *merger) writeSeq(seq uint64) error {
+	if m.out == nil {
+		if err := m.rotate(); err != nil {
+			return err
+		}
+	}
+
+	e := &internal.Entry{Type: internal.TypeCommit, Tstamp: time.Now().Unix(), Seq: seq}
+	if _, err := m.out.Write(m.out.Codec().EncodeEntry(e)); err != nil {
+		return err
+	}
+	m.seqs[m.out.ID()] = max(m.seqs[m.out.ID()], seq)
+	_, err := m.hint.Write(m.hint.Codec().EncodeEntry(e))
+	return err
+}
+
+func (m *merger) rotate() error {
+	if err := m.close(); err != nil {
+		return err
+	}
+
+	id := m.ids[m.next]
+	m.next++
+
+	out, err := datafile.Open(datafile.Name(m.dir, id, datafile.DataExt), id,
+		codec.NewFileHeader(m.opts.Checksum, m.opts.RecordFormat))
+	if err != nil {
+		return err
+	}
+	hint, err := openHintFile(datafile.Name(m.dir, id, datafile.HintExt), id)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	m.out, m.hint = out, hint
+	m.outs = append(m.outs, id)
+	return nil
+}
+
+func (m *merger) close() error {
+	if m.out == nil {
+		return nil
+	}
+
+	for _, df := range []*datafile.DataFile{m.out, m.hint} {
+		if err := df.Sync(); err != nil {
+			return err
+		}
+		if err := df.Close(); err != nil {
+			return err
+		}
+	}
+	m.out, m.hint = nil, nil
+	return nil
+}
+
+// Merge Merge several data files within a Bitcask datastore into a more compact form.
+// Also, produce hintfiles for faster startup.
+//
+// 合并所有非活跃文件, 仅保留每个键的最新版本. 重写记录期间不阻塞读写,
+// 仅在替换文件时短暂持有写锁
+func (b *Bitcask) Merge() error {
+	inputs, last, err := b.startMerge()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		b.rw.Lock()
+		b.isMerging = false
+		b.rw.Unlock()
+	}()
+
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	mergeDir := filepath.Join(b.options.Dir, mergeDirName)
+	if err := os.RemoveAll(mergeDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mergeDir, 0755); err != nil {
+		return err
+	}
+
+	ids := make([]uint32, len(inputs))
+	for i, df := range inputs {
+		ids[i] = df.ID()
+	}
+
+	m := &merger{dir: mergeDir, opts: b.options, ids: ids, seqs: make(map[uint32]uint64), last: last}
+	relocs, err := b.rewrite(m, inputs)
+	if cerr := m.close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = writeMergeFin(mergeDir, ids)
+	}
+	if err != nil {
+		_ = os.RemoveAll(mergeDir)
+		return err
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	// 关闭后合并结果会在下次打开时生效
+	if b.closed {
+		return ErrClosed
+	}
+
+	for _, df := range inputs {
+		_ = df.Close()
+		delete(b.files, df.ID())
+		delete(b.seqs, df.ID())
+	}
+
+	if err := finishMerge(b.options.Dir, ids); err != nil {
+		return err
+	}
+
+	for _, id := range m.outs {
+		df, err := datafile.Open(datafile.Name(b.options.Dir, id, datafile.DataExt), id, b.newFileHeader())
+		if err != nil {
+			return err
+		}
+		b.files[id] = df
+		b.seqs[id] = m.seqs[id]
+	}
+
+	for _, r := range relocs {
+		if r.apply(b.keydir) && r.to == nil {
+			b.blobs.release(r.key, r.from)
+			b.watch.publish(OpExpire, r.key, nil, r.from)
+		}
+		for s := range b.snapshots {
+			r.apply(s.keydir)
+		}
+	}
+
+	return nil
+}
+
+// apply 仅在 kd 仍指向旧位置时更新 key 的元信息, 返回是否更新
+func (r relocation) apply(kd *internal.Keydir) bool {
+	cur, ok := kd.Get(r.key)
+	if !ok || cur.FileID != r.from.FileID || cur.RecordPos != r.from.RecordPos {
+		return false
+	}
+	if r.to == nil {
+		kd.Delete(r.key)
+	} else {
+		kd.Put(r.key, r.to)
+	}
+	return true
+}
+
+// startMerge 封存活跃文件并返回参与合并的数据文件, 以及最后分配的序列号
+func (b *Bitcask) startMerge() ([]*datafile.DataFile, uint64, error) {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return nil, 0, err
+	}
+	if b.isMerging {
+		return nil, 0, ErrMergeInProgress
+	}
+	b.isMerging = true
+
+	if b.active != nil && !b.active.Empty() {
+		if err := b.active.Sync(); err != nil {
+			b.isMerging = false
+			return nil, 0, err
+		}
+		b.active = nil
+	}
+
+	inputs := make([]*datafile.DataFile, 0, len(b.files))
+	for _, df := range b.files {
+		if df != b.active && df.ID() < b.floorFile() {
+			inputs = append(inputs, df)
+		}
+	}
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].ID() < inputs[j].ID() })
+
+	return inputs, b.seq, nil
+}
+
+// rewrite 将输入文件中仍被 keydir 或快照引用的记录写入合并目录
+//
+// 批次中的记录在读到匹配的提交标记后才处理, 未提交批次中的记录全部丢弃, 与加载时一致.
+// 为快照保留了旧版本的键, 其后的墓碑记录也需要保留, 否则重新加载时旧版本会复活.
+// 已过期的键按相同的规则清除. 最后分配的序列号由 writeSeq 单独保存
+func (b *Bitcask) rewrite(m *merger, inputs []*datafile.DataFile) ([]relocation, error) {
+	var relocs []relocation
+	stale := make(map[string]bool)
+	now := time.Now().UnixMilli()
+
+	visit := func(df *datafile.DataFile, e *internal.Entry, pos int64) error {
+		if e.Type == internal.TypeDeleted {
+			if !stale[string(e.Key)] {
+				return nil
+			}
+			delete(stale, string(e.Key))
+			_, err := m.write(e, nil)
+			return err
+		}
+
+		b.rw.RLock()
+		cur, ok := b.keydir.Get(e.Key)
+		live := ok && cur.FileID == df.ID() && cur.RecordPos == pos
+		if !live {
+			cur, ok = b.retained(e.Key, df.ID(), pos)
+		}
+		b.rw.RUnlock()
+		if !ok {
+			// 读取时清除的过期键不再被引用, 其前保留了旧版本时改写为墓碑
+			if stale[string(e.Key)] && e.Expiry != 0 && e.Expiry <= now {
+				delete(stale, string(e.Key))
+				_, err := m.write(&internal.Entry{
+					Type:   internal.TypeDeleted,
+					Tstamp: e.Tstamp,
+					Seq:    e.Seq,
+					Key:    e.Key,
+				}, nil)
+				return err
+			}
+			return nil
+		}
+		if live && cur.Expired(now) && !stale[string(e.Key)] {
+			relocs = append(relocs, relocation{key: e.Key, from: cur})
+			return nil
+		}
+
+		to, err := m.write(e, cur.Blob)
+		if err != nil {
+			return err
+		}
+		if live {
+			delete(stale, string(e.Key))
+		} else {
+			stale[string(e.Key)] = true
+		}
+		relocs = append(relocs, relocation{key: e.Key, from: cur, to: to})
+		return nil
+	}
+
+	for _, df := range inputs {
+		var batch *pendingBatch
+		err := df.Scan(func(e *internal.Entry, pos int64, _ uint32) error {
+			switch {
+			case e.Type == internal.TypeBatch:
+				batch = &pendingBatch{}
+			case e.Type == internal.TypeCommit:
+				pb := batch
+				batch = nil
+				if pb == nil || !pb.committed(e) {
+					return nil
+				}
+				for i, e := range pb.entries {
+					if err := visit(df, e, pb.keydir[i].RecordPos); err != nil {
+						return err
+					}
+				}
+			case batch != nil:
+				batch.add(e, &internal.KeydirEntry{RecordPos: pos})
+			default:
+				return visit(df, e, pos)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if m.last > 0 {
+		if err := m.writeSeq(m.last); err != nil {
+			return nil, err
+		}
+	}
+	return relocs, nil
+}
+
+func writeMergeFin(mergeDir string, ids []uint32) error {
+	f, err := os.Create(filepath.Join(mergeDir, mergeFinName))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, id := range ids {
+		fmt.Fprintln(w, id)
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readMergeFin(mergeDir string) ([]uint32, error) {
+	f, err := os.Open(filepath.Join(mergeDir, mergeFinName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []uint32
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		id, err := strconv.ParseUint(s.Text(), 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, s.Err()
+}
+
+// finishMerge 删除参与合并的文件, 并将合并目录中的文件移入数据目录
+//
+// 该过程是幂等的, 中途崩溃后由 recoverMerge 重新执行
+func finishMerge(dir string, ids []uint32) error {
+	for _, id := range ids {
+		for _, ext := range []string{datafile.DataExt, datafile.HintExt} {
+			if err := os.Remove(datafile.Name(dir, id, ext)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	mergeDir := filepath.Join(dir, mergeDirName)
+	entries, err := os.ReadDir(mergeDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == mergeFinName {
+			continue
+		}
+		if err := os.Rename(filepath.Join(mergeDir, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(mergeDir)
+}
+
+// recoverMerge 在打开时处理上次未完成的合并: 已完成重写的合并继续替换文件, 否则丢弃
+func recoverMerge(dir string) error {
+	mergeDir := filepath.Join(dir, mergeDirName)
+	if _, err := os.Stat(mergeDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	ids, err := readMergeFin(mergeDir)
+	if os.IsNotExist(err) {
+		return os.RemoveAll(mergeDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	return finishMerge(dir, ids)
+}
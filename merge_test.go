@@ -0,0 +1,94 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dirSize(t *testing.T, dir, ext string) int64 {
+	t.Helper()
+
+	ids, err := datafile.List(dir, ext)
+	require.NoError(t, err)
+
+	var size int64
+	for _, id := range ids {
+		fi, err := os.Stat(datafile.Name(dir, id, ext))
+		require.NoError(t, err)
+		size += fi.Size()
+	}
+	return size
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir, WithMaxFileSize(1024))
+	require.NoError(t, err)
+
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("val-%d-%d", i, round))))
+		}
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.Delete([]byte(fmt.Sprintf("key-%02d", i))))
+	}
+
+	before := dirSize(t, dir, datafile.DataExt)
+	require.NoError(t, b.Merge())
+	assert.Less(t, dirSize(t, dir, datafile.DataExt), before, "Merge should reclaim space")
+	assert.NoDirExists(t, filepath.Join(dir, mergeDirName))
+
+	require.NoError(t, b.Put([]byte("key-49"), []byte("after-merge")))
+
+	check := func(b *Bitcask) {
+		for i := 0; i < 10; i++ {
+			_, err := b.Get([]byte(fmt.Sprintf("key-%02d", i)))
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+		}
+		for i := 10; i < 49; i++ {
+			val, err := b.Get([]byte(fmt.Sprintf("key-%02d", i)))
+			require.NoError(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("val-%d-4", i)), val)
+		}
+		val, err := b.Get([]byte("key-49"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("after-merge"), val)
+	}
+
+	check(b)
+	require.NoError(t, b.Close())
+
+	hints, err := datafile.List(dir, datafile.HintExt)
+	require.NoError(t, err)
+	assert.NotEmpty(t, hints, "Merge should produce hint files")
+
+	b = openTestBitcask(t, dir)
+	check(b)
+}
+
+func TestMerge_Recover(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("k"), []byte("v")))
+	require.NoError(t, b.Close())
+
+	// 未写入完成标记的合并目录在打开时被丢弃
+	mergeDir := filepath.Join(dir, mergeDirName)
+	require.NoError(t, os.MkdirAll(mergeDir, 0755))
+	require.NoError(t, os.WriteFile(datafile.Name(mergeDir, 1, datafile.DataExt), []byte("garbage"), 0644))
+
+	b = openTestBitcask(t, dir)
+	assert.NoDirExists(t, mergeDir)
+
+	val, err := b.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+}
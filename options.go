@@ -1,11 +1,51 @@
 package bitcask
 
+import "github.com/chhz0/bitcask/internal/codec"
+
+// Checksum 记录校验和算法
+type Checksum = codec.Checksum
+
+const (
+	ChecksumIEEE       = codec.ChecksumIEEE
+	ChecksumCastagnoli = codec.ChecksumCastagnoli
+	ChecksumXXHash64   = codec.ChecksumXXHash64
+)
+
+// RecordFormat 记录编码格式
+type RecordFormat = codec.Format
+
+const (
+	FormatFixed   = codec.FormatFixed
+	FormatCompact = codec.FormatCompact
+)
+
 // Options for bitcask
 type Options struct {
 	Dir         string
 	MaxFileSize int64
 	SyncOnWrite bool
 	ReadOnly    bool
+
+	// Checksum 和 RecordFormat 仅作用于新创建的数据文件, 已有文件按其文件头读取
+	Checksum     Checksum
+	RecordFormat RecordFormat
+
+	// BlobThreshold 值大小不小于该阈值时写入 blob 文件, 0 表示不分离
+	BlobThreshold int64
+	// BlobGCRatio blob 文件中失效数据占比达到该值时才会被 BlobGC 回收
+	BlobGCRatio float64
+
+	// ChunkChecksum 大于一个分块(64KB)的值按分块存储并为每个分块附带校验和,
+	// 使 GetRange 在只读取部分值时也能校验数据
+	ChunkChecksum bool
+
+	// CompactCounter Incr/Decr 以定长 8 字节的计数器记录写入, 否则写入十进制文本
+	CompactCounter bool
+
+	// RetainChanges 合并和 blob 回收保留 AckChanges 确认位置之后的变更, 供 ChangesSince 读取
+	RetainChanges bool
+
+	replica bool // 由 OpenReplica 设置
 }
 
 type Option func(*Options)
@@ -16,6 +56,9 @@ func WithDir(dir string) Option {
 	}
 }
 
+// WithMaxFileSize 设置数据文件的最大大小, 超出 (0, math.MaxUint32] 时 Open 返回 ErrInvalidFileSize
+//
+// 旧格式的记录以文件编号和 32 位偏移组成序列号, 因此文件大小不能超过 4GB
 func WithMaxFileSize(size int64) Option {
 	return func(o *Options) {
 		o.MaxFileSize = size
@@ -33,3 +76,45 @@ func WithReadOnly(readOnly bool) Option {
 		o.ReadOnly = readOnly
 	}
 }
+
+func WithChecksum(cs Checksum) Option {
+	return func(o *Options) {
+		o.Checksum = cs
+	}
+}
+
+func WithRecordFormat(f RecordFormat) Option {
+	return func(o *Options) {
+		o.RecordFormat = f
+	}
+}
+
+func WithBlobThreshold(threshold int64) Option {
+	return func(o *Options) {
+		o.BlobThreshold = threshold
+	}
+}
+
+func WithBlobGCRatio(ratio float64) Option {
+	return func(o *Options) {
+		o.BlobGCRatio = ratio
+	}
+}
+
+func WithChunkChecksum(enable bool) Option {
+	return func(o *Options) {
+		o.ChunkChecksum = enable
+	}
+}
+
+func WithCompactCounter(enable bool) Option {
+	return func(o *Options) {
+		o.CompactCounter = enable
+	}
+}
+
+func WithRetainChanges(enable bool) Option {
+	return func(o *Options) {
+		o.RetainChanges = enable
+	}
+}
@@ -0,0 +1,107 @@
+package bitcask
+
+import (
+	"errors"
+	"io"
+
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+// GetRange 读取 key 对应值中从 off 开始的 n 个字节, 超出值末尾的部分被截断
+//
+// 根据 keydir 中值的位置只读取需要的数据, 一次 ReadAt 完成. 记录的校验和覆盖整个值,
+// 部分读取无法校验: 以 ChunkChecksum 写入的值会校验涉及的每个分块,
+// 其余的值不做校验, 需要校验时使用 Get 或 GetReader
+func (b *Bitcask) GetRange(key []byte, off, n int64) ([]byte, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	entry, ok := lookup(b.keydir, key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	if entry.Counter {
+		val, err := b.readCounter(entry)
+		if err != nil {
+			return nil, err
+		}
+		if off < 0 || n < 0 || off > int64(len(val)) {
+			return nil, ErrInvalidRange
+		}
+		return val[off : off+min(n, int64(len(val))-off)], nil
+	}
+
+	var (
+		df      *datafile.DataFile
+		valPos  = entry.ValuePos
+		valSz   = int64(entry.ValueSz)
+		chunked = entry.Chunked
+	)
+	if entry.Blob != nil {
+		df, ok = b.blobs.files[entry.Blob.FileID]
+		valPos, valSz, chunked = entry.Blob.Offset, int64(entry.Blob.Size), entry.Blob.Chunked
+	} else {
+		df, ok = b.files[entry.FileID]
+	}
+	if !ok {
+		return nil, ErrDataFileNotFound
+	}
+
+	size := valSz
+	if chunked {
+		size = unchunkedSize(valSz)
+	}
+	if off < 0 || n < 0 || off > size {
+		return nil, ErrInvalidRange
+	}
+	n = min(n, size-off)
+	if n == 0 {
+		return []byte{}, nil
+	}
+
+	if !chunked {
+		return readAt(df, valPos+off, n)
+	}
+
+	// 读取覆盖 [off, off+n) 的所有分块
+	first := off / chunkSize
+	last := (off + n - 1) / chunkSize
+	start := first * (chunkSize + chunkSumSize)
+	end := min((last+1)*(chunkSize+chunkSumSize), valSz)
+
+	buf, err := readAt(df, valPos+start, end-start)
+	if err != nil {
+		return nil, err
+	}
+
+	val := make([]byte, 0, n)
+	for len(buf) > 0 {
+		sz := min(len(buf), chunkSize+chunkSumSize)
+		chunk, err := verifyChunk(buf[:sz])
+		if err != nil {
+			return nil, err
+		}
+		val = append(val, chunk...)
+		buf = buf[sz:]
+	}
+
+	skip := off - first*chunkSize
+	return val[skip : skip+n], nil
+}
+
+func readAt(df *datafile.DataFile, off, n int64) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := df.ReadAt(buf, off); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, codec.ErrIncompleteRead
+		}
+		return nil, err
+	}
+	return buf, nil
+}
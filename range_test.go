@@ -0,0 +1,108 @@
+package bitcask
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rangeValue(n int) []byte {
+	val := make([]byte, n)
+	for i := range val {
+		val[i] = byte(i % 251)
+	}
+	return val
+}
+
+func TestGetRange(t *testing.T) {
+	val := rangeValue(3*chunkSize + 100)
+
+	cases := []struct {
+		name string
+		opts []Option
+	}{
+		{"inline", nil},
+		{"chunked", []Option{WithChunkChecksum(true)}},
+		{"blob", []Option{WithBlobThreshold(1024)}},
+		{"blob-chunked", []Option{WithBlobThreshold(1024), WithChunkChecksum(true)}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			b, err := Open(dir, tc.opts...)
+			require.NoError(t, err)
+			require.NoError(t, b.Put([]byte("k"), val))
+
+			ranges := [][2]int64{
+				{0, 10},
+				{chunkSize - 5, 10},
+				{chunkSize, chunkSize},
+				{100, 2*chunkSize + 50},
+				{int64(len(val)) - 10, 100},
+				{int64(len(val)), 10},
+			}
+			check := func(b *Bitcask) {
+				for _, r := range ranges {
+					got, err := b.GetRange([]byte("k"), r[0], r[1])
+					require.NoError(t, err)
+					end := min(r[0]+r[1], int64(len(val)))
+					assert.Equal(t, val[r[0]:end], got, "Range [%d, +%d) does not match", r[0], r[1])
+				}
+
+				got, err := b.Get([]byte("k"))
+				require.NoError(t, err)
+				assert.Equal(t, val, got, "Get should strip chunk checksums")
+
+				rc, err := b.GetReader([]byte("k"))
+				require.NoError(t, err)
+				got, err = io.ReadAll(rc)
+				require.NoError(t, err)
+				require.NoError(t, rc.Close())
+				assert.Equal(t, val, got, "GetReader should strip chunk checksums")
+			}
+
+			check(b)
+			_, err = b.GetRange([]byte("k"), int64(len(val))+1, 1)
+			assert.ErrorIs(t, err, ErrInvalidRange)
+
+			require.NoError(t, b.Merge())
+			require.NoError(t, b.Close())
+
+			b = openTestBitcask(t, dir, tc.opts...)
+			check(b)
+		})
+	}
+}
+
+func TestGetRange_ChunkChecksum(t *testing.T) {
+	dir := t.TempDir()
+	b := openTestBitcask(t, dir, WithChunkChecksum(true))
+
+	val := rangeValue(2 * chunkSize)
+	require.NoError(t, b.PutStream([]byte("k"), bytes.NewReader(val), int64(len(val))))
+	require.NoError(t, b.Sync())
+
+	got, err := b.GetRange([]byte("k"), chunkSize+1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, val[chunkSize+1:chunkSize+11], got)
+
+	// 篡改第二个分块
+	path := datafile.Name(dir, 1, datafile.DataExt)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-100] ^= 0x01
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	_, err = b.GetRange([]byte("k"), chunkSize+1, 10)
+	assert.ErrorIs(t, err, ErrCRCValidation, "Damaged chunk should be detected")
+
+	got, err = b.GetRange([]byte("k"), 0, 10)
+	require.NoError(t, err, "Intact chunks should still be readable")
+	assert.Equal(t, val[:10], got)
+}
@@ -0,0 +1,713 @@
+package bitcask
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/chhz0/bitcask/internal/fileio"
+)
+
+const (
+	repairDirName    = "repair"
+	repairFinName    = "REPAIR_FIN"
+	lostFoundDirName = "lost+found"
+
+	// repairMaxKeyPeek 从校验失败的记录头中读取键时最多读取的字节数
+	repairMaxKeyPeek = 64 * 1024
+)
+
+// RepairReport Repair 的结果
+type RepairReport struct {
+	Records     int            // 复制到新数据文件的记录数量
+	Rewritten   []string       // 被重写的数据文件
+	Hints       []string       // 重建的 hint 文件
+	Quarantined []string       // 移入 lost+found 的原始文件, 路径相对于数据目录
+	Corrupt     []CorruptRange // 无法恢复的区间
+	Lost        [][]byte       // 修复后不再存在的键
+	RolledBack  [][]byte       // 修复后回退到旧版本(或被删除后重新出现)的键
+}
+
+// Repair 修复 dir 中损坏的数据文件, 调用时目录不能被其他进程打开
+//
+// 包含损坏区间或者指向损坏 blob 值的数据文件被重写: 所有可以通过校验的记录按原顺序复制到新文件,
+// 损坏区间中的批次整体丢弃, 并为新文件重建 hint 文件; 数据文件完好但 hint 文件与其不一致时只重建 hint 文件.
+// 被替换的原始文件移入 lost+found 目录. blob 文件中的值不能移动, 损坏的 blob 文件保留在原处.
+//
+// 修复前后的 keydir 通过可以读取的记录, hint 文件以及损坏记录中可以解析的记录头推算,
+// 最新版本落在损坏区间中的键被报告为丢失或回退
+func Repair(dir string) (RepairReport, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return RepairReport{}, err
+	}
+	lock := fileio.NewLock(dir)
+	if err := lock.TryLock(); err != nil {
+		return RepairReport{}, ErrDirLocked
+	}
+	defer lock.UnLock()
+
+	if err := recoverMerge(dir); err != nil {
+		return RepairReport{}, err
+	}
+	if err := recoverRepair(dir); err != nil {
+		return RepairReport{}, err
+	}
+
+	r := &repairer{
+		dir:    dir,
+		tmp:    filepath.Join(dir, repairDirName),
+		blobs:  make(map[uint32]map[int64]uint32),
+		before: make(map[string]repairVersion),
+		after:  make(map[string]repairVersion),
+	}
+	if err := os.MkdirAll(r.tmp, 0o755); err != nil {
+		return RepairReport{}, err
+	}
+	if err := r.run(); err != nil {
+		_ = os.RemoveAll(r.tmp)
+		return RepairReport{}, err
+	}
+	return r.report, nil
+}
+
+// repairVersion 键的某个版本在原始数据文件中的位置, phantom 表示该版本位于损坏区间中
+type repairVersion struct {
+	id      uint32
+	pos     int64
+	phantom bool
+}
+
+// repairRecord 通过校验的记录及其在原始文件中的位置
+type repairRecord struct {
+	e    *internal.Entry
+	pos  int64
+	size uint32
+}
+
+// phantom 损坏区间中可以确定键的记录, 来自 hint 文件或者记录头
+type phantom struct {
+	pos     int64
+	key     []byte
+	deleted bool
+}
+
+type repairer struct {
+	dir    string
+	tmp    string
+	blobs  map[uint32]map[int64]uint32 // blob 文件中可以通过校验的值: 偏移 -> 大小
+	before map[string]repairVersion    // 损坏前的 keydir
+	after  map[string]repairVersion    // 修复后的 keydir
+	report RepairReport
+
+	quarantine []string
+}
+
+func (r *repairer) run() error {
+	if err := r.scanBlobs(); err != nil {
+		return err
+	}
+
+	ids, err := datafile.List(r.dir, datafile.DataExt)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := r.repairFile(id); err != nil {
+			return err
+		}
+	}
+	r.diff()
+
+	if len(r.quarantine) == 0 {
+		return os.RemoveAll(r.tmp)
+	}
+	stamp := time.Now().UTC().Format("20060102T150405.000000000")
+	for _, name := range r.quarantine {
+		r.report.Quarantined = append(r.report.Quarantined, filepath.Join(lostFoundDirName, stamp, name))
+	}
+	if err := writeRepairFin(r.tmp, stamp, r.quarantine); err != nil {
+		return err
+	}
+	return finishRepair(r.dir)
+}
+
+// scanBlobs 记录所有 blob 文件中可以通过校验的值
+func (r *repairer) scanBlobs() error {
+	ids, err := datafile.List(r.dir, datafile.BlobExt)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		values := make(map[int64]uint32)
+		bad, err := verifyPath(datafile.Name(r.dir, id, datafile.BlobExt), func(e *internal.Entry, pos int64, size uint32) {
+			values[pos+int64(size)-int64(len(e.Val))] = uint32(len(e.Val))
+		})
+		if err != nil {
+			return err
+		}
+		r.corrupt(datafile.Name("", id, datafile.BlobExt), bad)
+		r.blobs[id] = values
+	}
+	return nil
+}
+
+// repairFile 检查 id 对应的数据文件和 hint 文件, 需要时将修复后的文件写入临时目录
+func (r *repairer) repairFile(id uint32) error {
+	name := datafile.Name("", id, datafile.DataExt)
+	f, err := os.Open(filepath.Join(r.dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	valid := make(map[int64]uint32)
+	dangling := false
+	bad, err := datafile.Verify(f, size, func(e *internal.Entry, pos int64, sz uint32) {
+		valid[pos] = sz
+		if e.Type == internal.TypeBlobPointer && !r.blobValid(e) {
+			dangling = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+	r.corrupt(name, bad)
+
+	hints, hintOK, err := r.readHints(id, valid)
+	if err != nil {
+		return err
+	}
+	phantoms := r.phantoms(f, bad, hints)
+
+	rewrite := len(bad) > 0 || dangling
+	if !rewrite && hintOK {
+		// 文件完好, 只更新 keydir
+		return r.replay(f, size, id, phantoms, nil)
+	}
+
+	fw := &repairWriter{dir: r.tmp, id: id, rewrite: rewrite}
+	if rewrite {
+		// 文件头损坏时没有可以复制的记录, 不会创建新文件.
+		// 重写的文件使用当前版本的文件头, 旧版本文件中记录的序列号在重写后保持不变
+		if hdr, err := readFileHeader(f); err == nil {
+			fw.hdr = codec.NewFileHeader(hdr.Checksum, hdr.Format)
+		}
+	}
+	if err := r.replay(f, size, id, phantoms, fw); err != nil {
+		_ = fw.close()
+		return err
+	}
+	if err := fw.close(); err != nil {
+		return err
+	}
+
+	r.report.Records += fw.records
+	if fw.out != nil {
+		r.report.Rewritten = append(r.report.Rewritten, name)
+	}
+	if fw.hint != nil {
+		r.report.Hints = append(r.report.Hints, datafile.Name("", id, datafile.HintExt))
+	}
+	if rewrite {
+		r.quarantine = append(r.quarantine, name)
+	}
+	if _, err := os.Stat(datafile.Name(r.dir, id, datafile.HintExt)); err == nil {
+		r.quarantine = append(r.quarantine, datafile.Name("", id, datafile.HintExt))
+	}
+	return nil
+}
+
+// readHints 读取 id 对应的 hint 文件, 返回其中的记录以及 hint 文件是否与数据文件一致
+func (r *repairer) readHints(id uint32, valid map[int64]uint32) ([]phantom, bool, error) {
+	path := datafile.Name(r.dir, id, datafile.HintExt)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, true, nil
+	}
+
+	var (
+		hints []phantom
+		ok    = true
+	)
+	bad, err := verifyPath(path, func(e *internal.Entry, _ int64, _ uint32) {
+		if e.Type == internal.TypeDeleted || e.Type == internal.TypeCommit {
+			return
+		}
+		entry, err := decodeHint(e, id)
+		if err != nil {
+			ok = false
+			return
+		}
+		if valid[entry.RecordPos] != entry.RecordSz {
+			ok = false
+		}
+		hints = append(hints, phantom{pos: entry.RecordPos, key: e.Key})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return hints, ok && len(bad) == 0, nil
+}
+
+// phantoms 返回损坏区间中可以确定键的记录, 按位置排序
+func (r *repairer) phantoms(f *os.File, bad []datafile.Corruption, hints []phantom) []phantom {
+	in := func(pos int64) bool {
+		for _, c := range bad {
+			if pos >= c.Offset && pos < c.Offset+c.Size {
+				return true
+			}
+		}
+		return false
+	}
+
+	byPos := make(map[int64]phantom)
+	for _, h := range hints {
+		if in(h.pos) {
+			byPos[h.pos] = h
+		}
+	}
+
+	// 校验失败的记录, 记录头和键通常仍然可以读取
+	if hdr, err := readFileHeader(f); err == nil {
+		c := codec.New(hdr)
+		for _, cr := range bad {
+			if _, ok := byPos[cr.Offset]; ok || !errors.Is(cr.Err, codec.ErrCRCValidation) {
+				continue
+			}
+			buf := make([]byte, min(cr.Size, int64(c.HeaderSize())+repairMaxKeyPeek))
+			n, _ := f.ReadAt(buf, cr.Offset)
+			h, err := c.DecodeHeader(buf[:n])
+			if err != nil || h.Size+int(h.KSz) > n {
+				continue
+			}
+			switch h.Type {
+			case internal.TypeBatch, internal.TypeCommit:
+				continue
+			}
+			byPos[cr.Offset] = phantom{
+				pos:     cr.Offset,
+				key:     slices.Clone(buf[h.Size : h.Size+int(h.KSz)]),
+				deleted: h.Type == internal.TypeDeleted,
+			}
+		}
+	}
+
+	out := make([]phantom, 0, len(byPos))
+	for _, p := range byPos {
+		out = append(out, p)
+	}
+	slices.SortFunc(out, func(a, b phantom) int {
+		switch {
+		case a.pos < b.pos:
+			return -1
+		case a.pos > b.pos:
+			return 1
+		}
+		return 0
+	})
+	return out
+}
+
+// replay 按顺序重放数据文件中的记录, 推算修复前后的 keydir, fw 不为空时同时写出修复后的文件
+//
+// 批次中间出现损坏区间时, 批次在修复前视为已提交, 修复后整体丢弃; 之后始终没有读到提交标记时,
+// 损坏区间之后的记录视为独立写入的记录. 没有损坏的未提交批次与加载时相同, 始终丢弃
+func (r *repairer) replay(f *os.File, size int64, id uint32, phantoms []phantom, fw *repairWriter) error {
+	var (
+		batch  []repairRecord
+		marker *internal.Entry
+		inTx   bool
+		gap    = -1 // 批次中损坏区间之后第一条记录的下标
+		next   = int64(codec.FileHeaderSize)
+		werr   error
+		legacy bool // 旧版本文件的记录没有序列号
+	)
+	if hdr, err := readFileHeader(f); err == nil {
+		legacy = !codec.New(hdr).HasSeq()
+	}
+
+	applyPhantoms := func(pos int64) {
+		for len(phantoms) > 0 && phantoms[0].pos < pos {
+			p := phantoms[0]
+			phantoms = phantoms[1:]
+			v := repairVersion{id: id, pos: p.pos, phantom: true}
+			if p.deleted {
+				delete(r.before, string(p.key))
+			} else {
+				r.before[string(p.key)] = v
+			}
+		}
+	}
+	single := func(rec repairRecord) error {
+		r.apply(r.before, id, rec)
+		if !r.blobOK(rec.e) {
+			return nil
+		}
+		r.apply(r.after, id, rec)
+		return fw.write(rec)
+	}
+	// abort 结束没有读到提交标记的批次
+	abort := func() error {
+		if gap >= 0 {
+			for _, rec := range batch[:gap] {
+				r.apply(r.before, id, rec)
+			}
+			for _, rec := range batch[gap:] {
+				if err := single(rec); err != nil {
+					return err
+				}
+			}
+		}
+		batch, marker, inTx, gap = nil, nil, false, -1
+		return nil
+	}
+
+	_, err := datafile.Verify(f, size, func(e *internal.Entry, pos int64, sz uint32) {
+		if werr != nil {
+			return
+		}
+		applyPhantoms(pos)
+		if pos != next && inTx && gap < 0 {
+			gap = len(batch)
+		}
+		next = pos + int64(sz)
+		if legacy {
+			e.Seq = datafile.LegacySeq(id, pos)
+		}
+
+		rec := repairRecord{e: e, pos: pos, size: sz}
+		switch {
+		case e.Type == internal.TypeBatch:
+			if werr = abort(); werr == nil {
+				marker, inTx = e, true
+			}
+		case e.Type == internal.TypeCommit:
+			switch {
+			case !inTx:
+				werr = fw.writeSeq(e)
+			case gap >= 0:
+				for _, rec := range batch {
+					r.apply(r.before, id, rec)
+				}
+			case commitCount(e) == len(batch):
+				werr = r.commit(fw, id, batch, marker, rec)
+			}
+			batch, marker, inTx, gap = nil, nil, false, -1
+		case inTx:
+			batch = append(batch, rec)
+		default:
+			werr = single(rec)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if werr != nil {
+		return werr
+	}
+	applyPhantoms(size + 1)
+	if inTx && next != size && gap < 0 {
+		gap = len(batch)
+	}
+	return abort()
+}
+
+// commit 应用一个完整的批次, 批次中有记录指向损坏的 blob 值时整个批次在修复后被丢弃
+func (r *repairer) commit(fw *repairWriter, id uint32, batch []repairRecord, marker *internal.Entry, commit repairRecord) error {
+	ok := true
+	for _, rec := range batch {
+		r.apply(r.before, id, rec)
+		ok = ok && r.blobOK(rec.e)
+	}
+	if !ok {
+		return nil
+	}
+
+	for _, rec := range batch {
+		r.apply(r.after, id, rec)
+	}
+	if fw == nil {
+		return nil
+	}
+	if _, err := fw.writeRecord(marker); err != nil {
+		return err
+	}
+	for _, rec := range batch {
+		if err := fw.write(rec); err != nil {
+			return err
+		}
+	}
+	_, err := fw.writeRecord(commit.e)
+	return err
+}
+
+func (r *repairer) apply(kd map[string]repairVersion, id uint32, rec repairRecord) {
+	if rec.e.Type == internal.TypeDeleted {
+		delete(kd, string(rec.e.Key))
+		return
+	}
+	kd[string(rec.e.Key)] = repairVersion{id: id, pos: rec.pos}
+}
+
+// blobOK 判断记录是否可以保留, 只有指向损坏 blob 值的指针记录需要丢弃
+func (r *repairer) blobOK(e *internal.Entry) bool {
+	return e.Type != internal.TypeBlobPointer || r.blobValid(e)
+}
+
+func (r *repairer) blobValid(e *internal.Entry) bool {
+	ptr, err := decodeBlobPointer(e.Val)
+	if err != nil {
+		return false
+	}
+	size, ok := r.blobs[ptr.FileID][ptr.Offset]
+	return ok && size == ptr.Size
+}
+
+func (r *repairer) corrupt(name string, bad []datafile.Corruption) {
+	for _, c := range bad {
+		r.report.Corrupt = append(r.report.Corrupt, CorruptRange{File: name, Offset: c.Offset, Size: c.Size, Err: c.Err})
+	}
+}
+
+// diff 比较修复前后的 keydir
+func (r *repairer) diff() {
+	for key, v := range r.before {
+		if w, ok := r.after[key]; !ok {
+			r.report.Lost = append(r.report.Lost, []byte(key))
+		} else if w != v {
+			r.report.RolledBack = append(r.report.RolledBack, []byte(key))
+		}
+	}
+	for key := range r.after {
+		if _, ok := r.before[key]; !ok {
+			r.report.RolledBack = append(r.report.RolledBack, []byte(key))
+		}
+	}
+	slices.SortFunc(r.report.Lost, bytes.Compare)
+	slices.SortFunc(r.report.RolledBack, bytes.Compare)
+}
+
+// repairWriter 写出修复后的数据文件和 hint 文件, 文件在第一次写入时创建
+//
+// rewrite 为 false 时数据文件完好, 只重建 hint 文件, hint 记录指向原始位置
+type repairWriter struct {
+	dir     string
+	id      uint32
+	rewrite bool
+	hdr     codec.FileHeader
+	out     *datafile.DataFile
+	hint    *datafile.DataFile
+	records int
+}
+
+// write 写入一条记录及其 hint 记录, fw 为空时不写出文件
+func (fw *repairWriter) write(rec repairRecord) error {
+	if fw == nil {
+		return nil
+	}
+	pos, err := fw.writeRecord(rec.e)
+	if err != nil {
+		return err
+	}
+	if !fw.rewrite {
+		pos = rec.pos
+	}
+
+	if err := fw.openHint(); err != nil {
+		return err
+	}
+	e := rec.e
+	if e.Type == internal.TypeDeleted {
+		return writeHintTombstone(fw.hint, e.Key, e.Tstamp, e.Seq)
+	}
+
+	entry := newKeydirEntry(fw.id, e, pos, rec.size, uint32(len(e.Val)))
+	if e.Type == internal.TypeBlobPointer {
+		ptr, err := decodeBlobPointer(e.Val)
+		if err != nil {
+			return err
+		}
+		entry.Blob = ptr
+	}
+	return writeHint(fw.hint, e.Key, entry)
+}
+
+// writeSeq 写入合并时保存序列号的提交标记, hint 文件中保留相同的标记
+func (fw *repairWriter) writeSeq(e *internal.Entry) error {
+	if fw == nil {
+		return nil
+	}
+	if _, err := fw.writeRecord(e); err != nil {
+		return err
+	}
+	if err := fw.openHint(); err != nil {
+		return err
+	}
+	_, err := fw.hint.Write(fw.hint.Codec().EncodeEntry(e))
+	return err
+}
+
+func (fw *repairWriter) openHint() error {
+	if fw.hint != nil {
+		return nil
+	}
+	hf, err := openHintFile(datafile.Name(fw.dir, fw.id, datafile.HintExt), fw.id)
+	if err != nil {
+		return err
+	}
+	fw.hint = hf
+	return nil
+}
+
+// writeRecord 将记录写入修复后的数据文件, 不写入 hint 文件, 只重建 hint 文件时不做任何事
+func (fw *repairWriter) writeRecord(e *internal.Entry) (int64, error) {
+	if fw == nil || !fw.rewrite {
+		return 0, nil
+	}
+	if fw.out == nil {
+		df, err := datafile.Open(datafile.Name(fw.dir, fw.id, datafile.DataExt), fw.id, fw.hdr)
+		if err != nil {
+			return 0, err
+		}
+		fw.out = df
+	}
+	pos, err := fw.out.Write(fw.out.Codec().EncodeEntry(e))
+	if err != nil {
+		return 0, err
+	}
+	fw.records++
+	return pos, nil
+}
+
+func (fw *repairWriter) close() error {
+	var err error
+	for _, df := range []*datafile.DataFile{fw.out, fw.hint} {
+		if df == nil {
+			continue
+		}
+		if serr := df.Sync(); err == nil {
+			err = serr
+		}
+		if cerr := df.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// verifyPath 校验 path 中的所有记录
+func verifyPath(path string, fn func(e *internal.Entry, pos int64, size uint32)) ([]datafile.Corruption, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return datafile.Verify(f, fi.Size(), fn)
+}
+
+func readFileHeader(r io.ReaderAt) (codec.FileHeader, error) {
+	buf := make([]byte, codec.FileHeaderSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return codec.FileHeader{}, codec.ErrInvalidFileHeader
+	}
+	return codec.DecodeFileHeader(buf)
+}
+
+func writeRepairFin(repairDir, stamp string, names []string) error {
+	f, err := os.Create(filepath.Join(repairDir, repairFinName))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, stamp)
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// finishRepair 将被替换的原始文件移入 lost+found, 并将修复目录中的文件移入数据目录
+//
+// 该过程是幂等的, 中途崩溃后由 recoverRepair 重新执行
+func finishRepair(dir string) error {
+	repairDir := filepath.Join(dir, repairDirName)
+	f, err := os.Open(filepath.Join(repairDir, repairFinName))
+	if err != nil {
+		return err
+	}
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	_ = f.Close()
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("%s: empty %s", repairDir, repairFinName)
+	}
+
+	lostDir := filepath.Join(dir, lostFoundDirName, lines[0])
+	if err := os.MkdirAll(lostDir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range lines[1:] {
+		err := os.Rename(filepath.Join(dir, name), filepath.Join(lostDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(repairDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == repairFinName {
+			continue
+		}
+		if err := os.Rename(filepath.Join(repairDir, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(repairDir)
+}
+
+// recoverRepair 在打开时处理上次未完成的修复: 已写完 REPAIR_FIN 的修复继续替换文件, 否则丢弃
+func recoverRepair(dir string) error {
+	repairDir := filepath.Join(dir, repairDirName)
+	if _, err := os.Stat(repairDir); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(repairDir, repairFinName)); os.IsNotExist(err) {
+		return os.RemoveAll(repairDir)
+	}
+	return finishRepair(dir)
+}
@@ -0,0 +1,162 @@
+package bitcask
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// corruptRecord 篡改 path 中第一条键为 key 的记录的最后一个字节
+func corruptRecord(t *testing.T, path, key string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	fi, err := f.Stat()
+	require.NoError(t, err)
+
+	end := int64(-1)
+	_, err = datafile.Verify(f, fi.Size(), func(e *internal.Entry, pos int64, size uint32) {
+		if end < 0 && string(e.Key) == key {
+			end = pos + int64(size)
+		}
+	})
+	require.NoError(t, err)
+	require.Positive(t, end, "record %q not found", key)
+
+	b := make([]byte, 1)
+	_, err = f.ReadAt(b, end-1)
+	require.NoError(t, err)
+	b[0] ^= 0xff
+	_, err = f.WriteAt(b, end-1)
+	require.NoError(t, err)
+}
+
+// putAll 打开 dir 写入 kvs 后关闭, 每次打开都会写入新的数据文件
+func putAll(t *testing.T, dir string, kvs ...string) {
+	t.Helper()
+
+	b, err := Open(dir)
+	require.NoError(t, err)
+	for i := 0; i < len(kvs); i += 2 {
+		require.NoError(t, b.Put([]byte(kvs[i]), []byte(kvs[i+1])))
+	}
+	require.NoError(t, b.Close())
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	putAll(t, dir, "a", "1", "b", "1", "c", "1", "d", "1")
+	putAll(t, dir, "a", "2", "b", "2")
+
+	report, err := Repair(dir)
+	require.NoError(t, err)
+	assert.Equal(t, RepairReport{}, report, "Repair should not touch a healthy directory")
+	assert.NoDirExists(t, filepath.Join(dir, lostFoundDirName))
+
+	corruptRecord(t, datafile.Name(dir, 1, datafile.DataExt), "c")
+	corruptRecord(t, datafile.Name(dir, 2, datafile.DataExt), "a")
+	_, err = Open(dir)
+	require.ErrorIs(t, err, ErrCRCValidation)
+
+	report, err = Repair(dir)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("c")}, report.Lost)
+	assert.Equal(t, [][]byte{[]byte("a")}, report.RolledBack)
+	assert.Equal(t, []string{"000000001.data", "000000002.data"}, report.Rewritten)
+	assert.Equal(t, []string{"000000001.hint", "000000002.hint"}, report.Hints)
+	assert.Equal(t, 4, report.Records)
+	assert.Len(t, report.Corrupt, 2)
+	require.Len(t, report.Quarantined, 2)
+	for _, q := range report.Quarantined {
+		assert.FileExists(t, filepath.Join(dir, q))
+	}
+	assert.NoDirExists(t, filepath.Join(dir, repairDirName))
+
+	b, err := Open(dir)
+	require.NoError(t, err)
+	defer b.Close()
+	for key, want := range map[string]string{"a": "1", "b": "2", "d": "1"} {
+		val, err := b.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(val))
+	}
+	_, err = b.Get([]byte("c"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	vr, err := b.Verify(context.Background())
+	require.NoError(t, err)
+	assert.True(t, vr.OK(), "%+v", vr)
+
+	_, err = Repair(dir)
+	assert.ErrorIs(t, err, ErrDirLocked)
+}
+
+func TestRepair_Batch(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("x"), []byte("1")))
+	wb := NewBatch()
+	require.NoError(t, wb.Put([]byte("y"), []byte("1")))
+	require.NoError(t, wb.Put([]byte("z"), []byte("1")))
+	require.NoError(t, b.WriteBatch(wb))
+	require.NoError(t, b.Put([]byte("w"), []byte("1")))
+	require.NoError(t, b.Close())
+
+	// 损坏批次中的一条记录, 整个批次被丢弃
+	corruptRecord(t, datafile.Name(dir, 1, datafile.DataExt), "y")
+
+	report, err := Repair(dir)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("y"), []byte("z")}, report.Lost)
+	assert.Empty(t, report.RolledBack)
+
+	b, err = Open(dir)
+	require.NoError(t, err)
+	defer b.Close()
+	keys, err := b.ScanKeys(nil, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("w"), []byte("x")}, keys)
+}
+
+func TestRepair_Hint(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("a"), []byte("1")))
+	require.NoError(t, b.Put([]byte("b"), []byte("2")))
+	require.NoError(t, b.Merge())
+	require.NoError(t, b.Close())
+
+	ids, err := datafile.List(dir, datafile.HintExt)
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+	corruptRecord(t, datafile.Name(dir, ids[0], datafile.HintExt), "b")
+
+	// 数据文件完好, 只重建 hint 文件
+	report, err := Repair(dir)
+	require.NoError(t, err)
+	assert.Empty(t, report.Rewritten)
+	assert.Empty(t, report.Lost)
+	assert.Empty(t, report.RolledBack)
+	assert.Equal(t, []string{datafile.Name("", ids[0], datafile.HintExt)}, report.Hints)
+	require.Len(t, report.Quarantined, 1)
+
+	b, err = Open(dir)
+	require.NoError(t, err)
+	defer b.Close()
+	val, err := b.Get([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), val)
+	vr, err := b.Verify(context.Background())
+	require.NoError(t, err)
+	assert.True(t, vr.OK(), "%+v", vr)
+}
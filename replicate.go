@@ -0,0 +1,349 @@
+package bitcask
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+// LogKind 复制日志中记录所属的文件类型
+type LogKind uint8
+
+const (
+	LogData LogKind = iota
+	LogBlob
+)
+
+// logSumWindow 计算 LogPosition.DataSum 时使用的文件末尾字节数
+const logSumWindow = 256
+
+// LogRecord 复制日志中的一段原始数据, 为文件头或一条完整的编码记录
+type LogRecord struct {
+	Kind   LogKind
+	FileID uint32
+	Offset int64
+	Data   []byte
+}
+
+// LogPosition 副本已应用的复制日志位置, 零值表示从头开始
+//
+// 合并会复用文件 id 改写数据文件, DataSum 为数据文件末尾一段字节的校验和,
+// 主节点据此判断副本的数据文件是否仍与自己一致
+type LogPosition struct {
+	DataID  uint32
+	DataOff int64
+	DataSum uint32
+	BlobID  uint32
+	BlobOff int64
+}
+
+// OpenReplica 以副本模式打开 Bitcask
+//
+// 副本拒绝用户写入, 只通过 ApplyLog 追加主节点的复制日志, 读取与普通实例相同
+func OpenReplica(dir string, opts ...Option) (*Bitcask, error) {
+	return Open(dir, append(opts, func(o *Options) { o.replica = true })...)
+}
+
+// ReadLog 返回 pos 之后的复制日志, 单次返回的数据量约为 limit 字节
+//
+// 先返回 blob 文件的记录, 保证指针记录到达副本时其引用的值已经存在.
+// 批次中的记录总是一起返回. pos 所在的数据文件已被合并改写时返回 ErrLogTruncated,
+// 副本需要调用 ResetReplica 后从零值位置重新同步
+func (b *Bitcask) ReadLog(pos LogPosition, limit int) ([]LogRecord, LogPosition, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, pos, ErrClosed
+	}
+	if pos.BlobID > b.blobs.maxID {
+		return nil, pos, ErrLogTruncated
+	}
+	if pos.DataID > 0 {
+		df, ok := b.files[pos.DataID]
+		if !ok || df.Size() < pos.DataOff {
+			return nil, pos, ErrLogTruncated
+		}
+		sum, err := logSum(df, pos.DataOff)
+		if err != nil {
+			return nil, pos, err
+		}
+		if sum != pos.DataSum {
+			return nil, pos, ErrLogTruncated
+		}
+	}
+
+	var (
+		recs []LogRecord
+		size int
+	)
+	read := func(kind LogKind, files map[uint32]*datafile.DataFile, id *uint32, off *int64) error {
+		ids := make([]uint32, 0, len(files))
+		for fid := range files {
+			if fid >= *id {
+				ids = append(ids, fid)
+			}
+		}
+		slices.Sort(ids)
+
+		for _, fid := range ids {
+			if size >= limit {
+				return nil
+			}
+			from := int64(0)
+			if fid == *id {
+				from = *off
+			}
+
+			out, end, err := readLogFile(kind, files[fid], from, limit-size)
+			if err != nil {
+				return err
+			}
+			for _, r := range out {
+				size += len(r.Data)
+			}
+			recs = append(recs, out...)
+			*id, *off = fid, end
+		}
+		return nil
+	}
+
+	if err := read(LogBlob, b.blobs.files, &pos.BlobID, &pos.BlobOff); err != nil {
+		return nil, pos, err
+	}
+	if err := read(LogData, b.files, &pos.DataID, &pos.DataOff); err != nil {
+		return nil, pos, err
+	}
+
+	if df, ok := b.files[pos.DataID]; ok {
+		sum, err := logSum(df, pos.DataOff)
+		if err != nil {
+			return nil, pos, err
+		}
+		pos.DataSum = sum
+	}
+	return recs, pos, nil
+}
+
+// readLogFile 从 df 的 off 处读取完整的记录, 返回读取结束的位置
+func readLogFile(kind LogKind, df *datafile.DataFile, off int64, limit int) ([]LogRecord, int64, error) {
+	var recs []LogRecord
+	if off == 0 {
+		hdr := make([]byte, codec.FileHeaderSize)
+		if _, err := df.ReadAt(hdr, 0); err != nil {
+			return nil, off, err
+		}
+		recs = append(recs, LogRecord{Kind: kind, FileID: df.ID(), Data: hdr})
+		off = codec.FileHeaderSize
+	}
+
+	d := df.Codec().NewDecoder(io.NewSectionReader(df, off, df.Size()-off), df.Size()-off)
+	var (
+		bounds  []int64
+		size    int
+		inBatch bool
+	)
+	for size < limit || inBatch {
+		e, err := d.Decode()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, codec.ErrIncompleteRead) {
+				break
+			}
+			if errors.Is(err, codec.ErrCRCValidation) {
+				// 与 Scan 相同, 校验失败的最后一条记录视为未写完
+				if _, nerr := d.Decode(); errors.Is(nerr, io.EOF) {
+					break
+				}
+			}
+			return nil, off, err
+		}
+
+		switch e.Type {
+		case internal.TypeBatch:
+			inBatch = true
+		case internal.TypeCommit:
+			inBatch = false
+		}
+		bounds = append(bounds, off+d.Offset())
+		size = int(d.Offset())
+	}
+	if len(bounds) == 0 {
+		return recs, off, nil
+	}
+
+	end := bounds[len(bounds)-1]
+	buf := make([]byte, end-off)
+	if _, err := df.ReadAt(buf, off); err != nil {
+		return nil, off, err
+	}
+	start := off
+	for _, bound := range bounds {
+		recs = append(recs, LogRecord{Kind: kind, FileID: df.ID(), Offset: start, Data: buf[start-off : bound-off]})
+		start = bound
+	}
+	return recs, end, nil
+}
+
+// logSum 计算 df 中 off 之前 logSumWindow 字节的校验和
+func logSum(df *datafile.DataFile, off int64) (uint32, error) {
+	from := max(off-logSumWindow, 0)
+	buf := make([]byte, off-from)
+	if _, err := df.ReadAt(buf, from); err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+// LogPosition 返回副本已应用的复制日志位置
+func (b *Bitcask) LogPosition() (LogPosition, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return LogPosition{}, ErrClosed
+	}
+
+	var pos LogPosition
+	if df, ok := b.files[b.maxID]; ok {
+		sum, err := logSum(df, df.Size())
+		if err != nil {
+			return pos, err
+		}
+		pos.DataID, pos.DataOff, pos.DataSum = df.ID(), df.Size(), sum
+	}
+	if df, ok := b.blobs.files[b.blobs.maxID]; ok {
+		pos.BlobID, pos.BlobOff = df.ID(), df.Size()
+	}
+	return pos, nil
+}
+
+// ApplyLog 在副本上追加一条复制日志并更新 keydir
+//
+// 记录必须紧接在对应文件的末尾, 否则返回 ErrLogGap
+func (b *Bitcask) ApplyLog(rec LogRecord) error {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if !b.options.replica {
+		return ErrNotReplica
+	}
+
+	files, ext := b.files, datafile.DataExt
+	if rec.Kind == LogBlob {
+		files, ext = b.blobs.files, datafile.BlobExt
+	}
+
+	df, ok := files[rec.FileID]
+	if !ok {
+		if rec.Offset != 0 {
+			return ErrLogGap
+		}
+		hdr, err := codec.DecodeFileHeader(rec.Data)
+		if err != nil {
+			return err
+		}
+		if df, err = datafile.Open(datafile.Name(b.options.Dir, rec.FileID, ext), rec.FileID, hdr); err != nil {
+			return err
+		}
+		files[rec.FileID] = df
+		if rec.Kind == LogBlob {
+			b.blobs.stats[rec.FileID] = &blobStat{}
+			b.blobs.maxID = max(b.blobs.maxID, rec.FileID)
+		} else {
+			b.maxID = max(b.maxID, rec.FileID)
+			// 批次不会跨越数据文件
+			b.replBatch = nil
+		}
+		return nil
+	}
+
+	if rec.Offset != df.Size() {
+		return ErrLogGap
+	}
+	pos, err := df.Write(rec.Data)
+	if err != nil {
+		return err
+	}
+	if b.options.SyncOnWrite {
+		if err := df.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if rec.Kind == LogBlob {
+		b.blobs.stats[rec.FileID].total += int64(len(rec.Data))
+		return nil
+	}
+
+	e, err := df.Read(pos, uint32(len(rec.Data)))
+	if err != nil {
+		_ = df.Truncate(pos)
+		return err
+	}
+	return b.replay(&b.replBatch, df.ID(), e, pos, uint32(len(rec.Data)))
+}
+
+// syncReplica 副本只会追加最新的数据文件和 blob 文件
+func (b *Bitcask) syncReplica() error {
+	if df, ok := b.files[b.maxID]; ok {
+		if err := df.Sync(); err != nil {
+			return err
+		}
+	}
+	if df, ok := b.blobs.files[b.blobs.maxID]; ok {
+		return df.Sync()
+	}
+	return nil
+}
+
+// ResetReplica 清空副本的所有数据, 用于从头重新同步
+func (b *Bitcask) ResetReplica() error {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if !b.options.replica {
+		return ErrNotReplica
+	}
+
+	if err := b.closeFiles(); err != nil {
+		return err
+	}
+	for _, ext := range []string{datafile.DataExt, datafile.HintExt, datafile.BlobExt} {
+		ids, err := datafile.List(b.options.Dir, ext)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := os.Remove(datafile.Name(b.options.Dir, id, ext)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(b.options.Dir, mergeDirName)); err != nil {
+		return err
+	}
+
+	b.keydir = internal.NewKeydir()
+	b.files = make(map[uint32]*datafile.DataFile)
+	b.maxID = 0
+	b.seq, b.seqs = 0, make(map[uint32]uint64)
+	b.replBatch = nil
+	clear(b.snapshots)
+
+	var err error
+	b.blobs, err = openBlobStore(b.options)
+	return err
+}
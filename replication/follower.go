@@ -0,0 +1,85 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"time"
+
+	"github.com/chhz0/bitcask"
+)
+
+// retryInterval 连接断开后重连的间隔
+const retryInterval = 100 * time.Millisecond
+
+// Follower 从主节点接收复制日志并应用到本地副本
+//
+// 副本通过 bitcask.OpenReplica 打开, 在同步的同时提供只读访问.
+// 重连时从已应用的位置继续, 位置已被主节点合并改写时清空副本从头同步
+type Follower struct {
+	db   *bitcask.Bitcask
+	addr string
+}
+
+// NewFollower 创建从 addr 处的主节点同步数据的副本
+func NewFollower(db *bitcask.Bitcask, addr string) *Follower {
+	return &Follower{db: db, addr: addr}
+}
+
+// Run 持续同步直到 ctx 结束, 连接失败或断开后自动重连
+func (f *Follower) Run(ctx context.Context) error {
+	for {
+		_ = f.sync(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (f *Follower) sync(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", f.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	pos, err := f.db.LogPosition()
+	if err != nil {
+		return err
+	}
+	if err := writeHello(conn, pos); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		typ, rec, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+
+		switch typ {
+		case frameReset:
+			err = f.db.ResetReplica()
+		case frameRecord:
+			err = f.db.ApplyLog(rec)
+		}
+		if err != nil {
+			return err
+		}
+
+		// 已收到的数据应用完毕后落盘
+		if r.Buffered() == 0 {
+			if err := f.db.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chhz0/bitcask"
+)
+
+const (
+	// readLimit 单次从数据文件读取的复制日志大小
+	readLimit = 1 << 20
+	// heartbeatInterval 空闲时发送心跳的间隔, 同时作为没有写入通知时的轮询间隔
+	heartbeatInterval = time.Second
+)
+
+// Leader 将主节点数据文件的追加记录发送给副本
+//
+// 每个副本连接独立维护复制位置, 写入通过 Watch 唤醒发送,
+// 不产生变更事件的追加(如 BlobGC 移动的指针)在下一次心跳时发送
+type Leader struct {
+	db *bitcask.Bitcask
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewLeader 创建主节点, db 需要以读写模式打开
+func NewLeader(db *bitcask.Bitcask) *Leader {
+	return &Leader{
+		db:    db,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve 接受副本连接, 直到 ln 被关闭或 Close 被调用
+func (l *Leader) Serve(ln net.Listener) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return net.ErrClosed
+	}
+	l.ln = ln
+	l.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			l.mu.Lock()
+			closed := l.closed
+			l.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+
+		go func() {
+			defer l.wg.Done()
+			_ = l.serveConn(conn)
+
+			l.mu.Lock()
+			delete(l.conns, conn)
+			l.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// Close 停止接受连接并断开所有副本
+func (l *Leader) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	var err error
+	if l.ln != nil {
+		err = l.ln.Close()
+	}
+	for conn := range l.conns {
+		_ = conn.Close()
+	}
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	return err
+}
+
+func (l *Leader) serveConn(conn net.Conn) error {
+	pos, err := readHello(conn)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := l.db.Watch(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	w := bufio.NewWriter(conn)
+	for {
+		recs, next, err := l.db.ReadLog(pos, readLimit)
+		if errors.Is(err, bitcask.ErrLogTruncated) {
+			// 副本落后于合并, 从头发送全部数据
+			if err := writeFrame(w, frameReset); err != nil {
+				return err
+			}
+			pos = bitcask.LogPosition{}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, rec := range recs {
+			if err := writeRecord(w, rec); err != nil {
+				return err
+			}
+		}
+		pos = next
+		if len(recs) > 0 {
+			continue
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		select {
+		case _, ok := <-events:
+			if !ok {
+				// 订阅因落后被断开, 重新订阅
+				if events, err = l.db.Watch(ctx, nil); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := writeFrame(w, frameHeartbeat); err != nil {
+				return err
+			}
+		}
+	}
+}
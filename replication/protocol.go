@@ -0,0 +1,123 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/chhz0/bitcask"
+)
+
+// 连接建立后副本先发送握手, 之后主节点持续发送帧:
+//
+// 握手: | magic | data_id | data_off | data_sum | blob_id | blob_off |
+// 帧:   | type | payload |
+//
+// frameRecord 的 payload 为 | kind | file_id | offset | size | data |,
+// frameReset 通知副本清空数据从头同步, frameHeartbeat 没有 payload
+const (
+	helloMagic = "BKRP"
+	helloSize  = 4 + 4 + 8 + 4 + 4 + 8
+
+	frameRecord    byte = 1
+	frameReset     byte = 2
+	frameHeartbeat byte = 3
+
+	recordHeaderSize = 1 + 4 + 8 + 4
+
+	// frameBufferSize 读取记录数据时初始分配的缓冲区上限
+	frameBufferSize = 64 * 1024
+)
+
+var (
+	ErrBadHandshake = errors.New("bad replication handshake.")
+	ErrBadFrame     = errors.New("bad replication frame.")
+)
+
+func writeHello(w io.Writer, pos bitcask.LogPosition) error {
+	buf := make([]byte, helloSize)
+	copy(buf[0:4], helloMagic)
+	binary.BigEndian.PutUint32(buf[4:8], pos.DataID)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(pos.DataOff))
+	binary.BigEndian.PutUint32(buf[16:20], pos.DataSum)
+	binary.BigEndian.PutUint32(buf[20:24], pos.BlobID)
+	binary.BigEndian.PutUint64(buf[24:32], uint64(pos.BlobOff))
+	_, err := w.Write(buf)
+	return err
+}
+
+func readHello(r io.Reader) (bitcask.LogPosition, error) {
+	buf := make([]byte, helloSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return bitcask.LogPosition{}, err
+	}
+	if string(buf[0:4]) != helloMagic {
+		return bitcask.LogPosition{}, ErrBadHandshake
+	}
+	return bitcask.LogPosition{
+		DataID:  binary.BigEndian.Uint32(buf[4:8]),
+		DataOff: int64(binary.BigEndian.Uint64(buf[8:16])),
+		DataSum: binary.BigEndian.Uint32(buf[16:20]),
+		BlobID:  binary.BigEndian.Uint32(buf[20:24]),
+		BlobOff: int64(binary.BigEndian.Uint64(buf[24:32])),
+	}, nil
+}
+
+func writeRecord(w io.Writer, rec bitcask.LogRecord) error {
+	buf := make([]byte, 1+recordHeaderSize)
+	buf[0] = frameRecord
+	buf[1] = byte(rec.Kind)
+	binary.BigEndian.PutUint32(buf[2:6], rec.FileID)
+	binary.BigEndian.PutUint64(buf[6:14], uint64(rec.Offset))
+	binary.BigEndian.PutUint32(buf[14:18], uint32(len(rec.Data)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(rec.Data)
+	return err
+}
+
+func writeFrame(w io.Writer, typ byte) error {
+	_, err := w.Write([]byte{typ})
+	return err
+}
+
+// readFrame 读取一帧, 仅 frameRecord 返回记录
+func readFrame(r io.Reader) (byte, bitcask.LogRecord, error) {
+	var typ [1]byte
+	if _, err := io.ReadFull(r, typ[:]); err != nil {
+		return 0, bitcask.LogRecord{}, err
+	}
+
+	switch typ[0] {
+	case frameReset, frameHeartbeat:
+		return typ[0], bitcask.LogRecord{}, nil
+	case frameRecord:
+	default:
+		return 0, bitcask.LogRecord{}, ErrBadFrame
+	}
+
+	head := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, bitcask.LogRecord{}, err
+	}
+	// 长度来自网络, 缓冲区随实际收到的数据增长, 不按声明的长度预先分配
+	size := int64(binary.BigEndian.Uint32(head[13:17]))
+	var data bytes.Buffer
+	data.Grow(int(min(size, frameBufferSize)))
+	if _, err := io.CopyN(&data, r, size); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, bitcask.LogRecord{}, err
+	}
+
+	rec := bitcask.LogRecord{
+		Kind:   bitcask.LogKind(head[0]),
+		FileID: binary.BigEndian.Uint32(head[1:5]),
+		Offset: int64(binary.BigEndian.Uint64(head[5:13])),
+		Data:   data.Bytes(),
+	}
+	return frameRecord, rec, nil
+}
@@ -0,0 +1,163 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/chhz0/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startLeader(t *testing.T, db *bitcask.Bitcask) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	l := NewLeader(db)
+	go func() { _ = l.Serve(ln) }()
+	t.Cleanup(func() { _ = l.Close() })
+	return ln.Addr().String()
+}
+
+func startFollower(t *testing.T, db *bitcask.Bitcask, addr string) context.CancelFunc {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = NewFollower(db, addr).Run(ctx)
+	}()
+
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func waitValue(t *testing.T, db *bitcask.Bitcask, key, want string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		val, err := db.Get([]byte(key))
+		return err == nil && string(val) == want
+	}, 5*time.Second, 10*time.Millisecond, "key %s should replicate", key)
+}
+
+func TestReplication(t *testing.T) {
+	leader, err := bitcask.Open(t.TempDir(), bitcask.WithBlobThreshold(64))
+	require.NoError(t, err)
+	defer leader.Close()
+
+	replica, err := bitcask.OpenReplica(t.TempDir())
+	require.NoError(t, err)
+	defer replica.Close()
+
+	require.NoError(t, leader.Put([]byte("before"), []byte("v")))
+	addr := startLeader(t, leader)
+	startFollower(t, replica, addr)
+
+	big := string(make([]byte, 128))
+	require.NoError(t, leader.Put([]byte("big"), []byte(big)))
+	wb := bitcask.NewBatch()
+	require.NoError(t, wb.Put([]byte("b1"), []byte("1")))
+	require.NoError(t, wb.Delete([]byte("before")))
+	require.NoError(t, leader.WriteBatch(wb))
+
+	waitValue(t, replica, "b1", "1")
+	waitValue(t, replica, "big", big)
+	_, err = replica.Get([]byte("before"))
+	assert.ErrorIs(t, err, bitcask.ErrKeyNotFound)
+
+	assert.ErrorIs(t, replica.Put([]byte("k"), []byte("v")), bitcask.ErrReadOnly, "Replica should reject writes")
+}
+
+func TestReplication_Resume(t *testing.T) {
+	leader, err := bitcask.Open(t.TempDir(), bitcask.WithMaxFileSize(512))
+	require.NoError(t, err)
+	defer leader.Close()
+
+	dir := t.TempDir()
+	replica, err := bitcask.OpenReplica(dir)
+	require.NoError(t, err)
+
+	addr := startLeader(t, leader)
+	stop := startFollower(t, replica, addr)
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, leader.Put([]byte(fmt.Sprintf("k%02d", i)), []byte("v1")))
+	}
+	waitValue(t, replica, "k19", "v1")
+
+	// 重启副本后从已应用的位置继续
+	stop()
+	require.NoError(t, replica.Close())
+	for i := 20; i < 40; i++ {
+		require.NoError(t, leader.Put([]byte(fmt.Sprintf("k%02d", i)), []byte("v1")))
+	}
+
+	replica, err = bitcask.OpenReplica(dir)
+	require.NoError(t, err)
+	defer replica.Close()
+	pos, err := replica.LogPosition()
+	require.NoError(t, err)
+	_, _, err = leader.ReadLog(pos, 1)
+	require.NoError(t, err, "Replica position should still be readable")
+
+	stop = startFollower(t, replica, addr)
+	waitValue(t, replica, "k39", "v1")
+
+	// 合并改写了副本所在的数据文件, 需要全量同步
+	stop()
+	for i := 0; i < 40; i += 2 {
+		require.NoError(t, leader.Delete([]byte(fmt.Sprintf("k%02d", i))))
+	}
+	require.NoError(t, leader.Put([]byte("k01"), []byte("v2")))
+	require.NoError(t, leader.Merge())
+
+	pos, err = replica.LogPosition()
+	require.NoError(t, err)
+	_, _, err = leader.ReadLog(pos, 1)
+	require.ErrorIs(t, err, bitcask.ErrLogTruncated)
+
+	require.NoError(t, leader.Put([]byte("last"), []byte("v")))
+	startFollower(t, replica, addr)
+	waitValue(t, replica, "last", "v")
+	waitValue(t, replica, "k01", "v2")
+
+	keys, err := replica.ListKeys()
+	require.NoError(t, err)
+	assert.Len(t, keys, 21, "Deleted keys should not survive the full sync")
+}
+
+func TestReadFrame_Oversized(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeRecord(&buf, bitcask.LogRecord{Kind: bitcask.LogData, FileID: 1, Data: []byte("abc")}))
+	frame := buf.Bytes()
+
+	typ, rec, err := readFrame(bytes.NewReader(frame))
+	require.NoError(t, err)
+	assert.Equal(t, frameRecord, typ)
+	assert.Equal(t, []byte("abc"), rec.Data)
+
+	// 声明 4GiB 的数据但只发送了 3 字节
+	binary.BigEndian.PutUint32(frame[14:18], math.MaxUint32)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, _, err = readFrame(bytes.NewReader(frame))
+	runtime.ReadMemStats(&after)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20), "Frame length should not drive the allocation")
+}
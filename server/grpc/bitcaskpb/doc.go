@@ -0,0 +1,4 @@
+// Package bitcaskpb 为 bitcask.proto 生成的 gRPC 服务定义
+package bitcaskpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative bitcask.proto
@@ -0,0 +1,221 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+
+	"github.com/chhz0/bitcask"
+	"github.com/chhz0/bitcask/server/grpc/bitcaskpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watchBufferSize 客户端 Watch 通道的缓冲大小, 消费过慢时阻塞接收,
+// 由服务端以 ErrWatchLagged 断开
+const watchBufferSize = 1024
+
+// Client 通过 gRPC 访问远程 bitcask, 实现 bitcask.Store
+//
+// Store 的方法没有 ctx 参数, 使用 context.Background(), 超时可以通过连接的拦截器控制
+type Client struct {
+	conn *grpc.ClientConn
+	rpc  bitcaskpb.BitcaskClient
+}
+
+var _ bitcask.Store = (*Client)(nil)
+
+// Dial 连接 target 上的服务, opts 需要包含传输凭证等选项
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, rpc: bitcaskpb.NewBitcaskClient(conn)}, nil
+}
+
+func (c *Client) Get(key []byte) ([]byte, error) {
+	resp, err := c.rpc.Get(context.Background(), &bitcaskpb.GetRequest{Key: key})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return resp.GetValue(), nil
+}
+
+func (c *Client) Has(key []byte) (bool, error) {
+	resp, err := c.rpc.Has(context.Background(), &bitcaskpb.HasRequest{Key: key})
+	if err != nil {
+		return false, fromStatus(err)
+	}
+	return resp.GetOk(), nil
+}
+
+func (c *Client) Put(key, value []byte) error {
+	_, err := c.rpc.Put(context.Background(), &bitcaskpb.PutRequest{Key: key, Value: value})
+	return fromStatus(err)
+}
+
+func (c *Client) Delete(key []byte) error {
+	_, err := c.rpc.Delete(context.Background(), &bitcaskpb.DeleteRequest{Key: key})
+	return fromStatus(err)
+}
+
+func (c *Client) ScanKeys(prefix, after []byte, limit int) ([][]byte, error) {
+	var keys [][]byte
+	err := c.Scan(context.Background(), prefix, after, limit, true, func(key, _ []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// Scan 按键的字节序遍历以 prefix 为前缀且大于 after 的键值对, fn 返回 false 时停止
+//
+// keysOnly 时不读取值, fn 收到的值为空
+func (c *Client) Scan(ctx context.Context, prefix, after []byte, limit int, keysOnly bool, fn func(key, value []byte) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.rpc.Scan(ctx, &bitcaskpb.ScanRequest{
+		Prefix:   prefix,
+		After:    after,
+		Limit:    int32(limit),
+		KeysOnly: keysOnly,
+	})
+	if err != nil {
+		return fromStatus(err)
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fromStatus(err)
+		}
+		if !fn(resp.GetKey(), resp.GetValue()) {
+			return nil
+		}
+	}
+}
+
+// BulkPut 流式写入 pairs 中的键值对, 返回写入的数量
+//
+// 服务端分批写入, 整体不保证原子性
+func (c *Client) BulkPut(ctx context.Context, pairs iter.Seq2[[]byte, []byte]) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.rpc.BulkPut(ctx)
+	if err != nil {
+		return 0, fromStatus(err)
+	}
+	for key, value := range pairs {
+		if err := stream.Send(&bitcaskpb.BulkPutRequest{Key: key, Value: value}); err != nil {
+			// 服务端提前结束时, 真正的错误由 CloseAndRecv 返回
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, fromStatus(err)
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, fromStatus(err)
+	}
+	return resp.GetCount(), nil
+}
+
+func (c *Client) WriteBatch(wb *bitcask.Batch) error {
+	req := &bitcaskpb.WriteBatchRequest{Ops: make([]*bitcaskpb.Op, 0, wb.Len())}
+	wb.ForEach(func(key, value []byte, deleted bool) bool {
+		req.Ops = append(req.Ops, &bitcaskpb.Op{Key: key, Value: value, Delete: deleted})
+		return true
+	})
+
+	_, err := c.rpc.WriteBatch(context.Background(), req)
+	return fromStatus(err)
+}
+
+// Watch 与 (*bitcask.Bitcask).Watch 语义相同, 连接断开时收到 Err 不为空的事件后通道被关闭
+func (c *Client) Watch(ctx context.Context, prefix []byte) (<-chan bitcask.Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.rpc.Watch(ctx, &bitcaskpb.WatchRequest{Prefix: prefix})
+	if err != nil {
+		cancel()
+		return nil, fromStatus(err)
+	}
+
+	ch := make(chan bitcask.Event, watchBufferSize)
+	go func() {
+		defer close(ch)
+		defer cancel()
+
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				// ctx 结束时直接关闭通道, 与嵌入式的行为一致
+				if ctx.Err() != nil || status.Code(err) == codes.Canceled {
+					return
+				}
+				select {
+				case ch <- bitcask.Event{Err: fromStatus(err)}:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			op := bitcask.OpPut
+			if resp.GetOp().GetDelete() {
+				op = bitcask.OpDelete
+			}
+			ev := bitcask.Event{Seq: resp.GetSeq(), Op: op, Key: resp.GetOp().GetKey(), Value: resp.GetOp().GetValue()}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (c *Client) Sync() error {
+	_, err := c.rpc.Sync(context.Background(), &bitcaskpb.SyncRequest{})
+	return fromStatus(err)
+}
+
+func (c *Client) Merge() error {
+	_, err := c.rpc.Merge(context.Background(), &bitcaskpb.MergeRequest{})
+	return fromStatus(err)
+}
+
+func (c *Client) Stats() (bitcask.Stats, error) {
+	resp, err := c.rpc.Stats(context.Background(), &bitcaskpb.StatsRequest{})
+	if err != nil {
+		return bitcask.Stats{}, fromStatus(err)
+	}
+	return bitcask.Stats{
+		Keys:      int(resp.GetKeys()),
+		DataFiles: int(resp.GetDataFiles()),
+		DataSize:  resp.GetDataSize(),
+		BlobFiles: int(resp.GetBlobFiles()),
+		BlobSize:  resp.GetBlobSize(),
+		BlobDead:  resp.GetBlobDead(),
+		Snapshots: int(resp.GetSnapshots()),
+	}, nil
+}
+
+// Backup 将服务端的数据目录备份到服务端备份目录下名为 name 的子目录
+func (c *Client) Backup(ctx context.Context, name string) error {
+	_, err := c.rpc.Backup(ctx, &bitcaskpb.BackupRequest{Dir: name})
+	return fromStatus(err)
+}
+
+// Close 关闭连接, 不影响服务端
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,62 @@
+package grpc
+
+import (
+	"errors"
+
+	"github.com/chhz0/bitcask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrBackupDisabled    = errors.New("backup is not enabled on the server.")
+	ErrInvalidBackupName = errors.New("invalid backup name.")
+)
+
+// knownErrors 通过 gRPC 状态传递的存储引擎错误, 状态消息为错误文本
+var knownErrors = []struct {
+	err  error
+	code codes.Code
+}{
+	{bitcask.ErrKeyNotFound, codes.NotFound},
+	{bitcask.ErrKeyEmpty, codes.InvalidArgument},
+	{bitcask.ErrKeyTooLarge, codes.InvalidArgument},
+	{bitcask.ErrValueTooLarge, codes.InvalidArgument},
+	{bitcask.ErrReadOnly, codes.FailedPrecondition},
+	{bitcask.ErrMergeInProgress, codes.Aborted},
+	{bitcask.ErrClosed, codes.Unavailable},
+	{bitcask.ErrWatchLagged, codes.ResourceExhausted},
+	{bitcask.ErrDirNotEmpty, codes.AlreadyExists},
+	{ErrBackupDisabled, codes.PermissionDenied},
+	{ErrInvalidBackupName, codes.InvalidArgument},
+}
+
+// toStatus 将存储引擎的错误转换为 gRPC 状态
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, e := range knownErrors {
+		if errors.Is(err, e.err) {
+			return status.Error(e.code, e.err.Error())
+		}
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// fromStatus 将 gRPC 状态还原为存储引擎的错误
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	for _, e := range knownErrors {
+		if st.Code() == e.code && st.Message() == e.err.Error() {
+			return e.err
+		}
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chhz0/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, opts ...ServerOption) (*Client, *bitcask.Bitcask) {
+	t.Helper()
+
+	db, err := bitcask.Open(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	ln := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	NewServer(db, opts...).Register(gs)
+	go func() { _ = gs.Serve(ln) }()
+	t.Cleanup(gs.Stop)
+
+	c, err := Dial("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c, db
+}
+
+// testStore 嵌入式和远程实现共用的测试
+func testStore(t *testing.T, s bitcask.Store) {
+	require.NoError(t, s.Put([]byte("a"), []byte("1")))
+	val, err := s.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(val))
+
+	_, err = s.Get([]byte("missing"))
+	assert.ErrorIs(t, err, bitcask.ErrKeyNotFound)
+	assert.ErrorIs(t, s.Put(nil, []byte("v")), bitcask.ErrKeyEmpty)
+
+	wb := bitcask.NewBatch()
+	require.NoError(t, wb.Put([]byte("b"), []byte("2")))
+	require.NoError(t, wb.Put([]byte("c"), []byte("3")))
+	require.NoError(t, wb.Delete([]byte("a")))
+	require.NoError(t, s.WriteBatch(wb))
+
+	ok, err := s.Has([]byte("a"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	keys, err := s.ScanKeys(nil, []byte("b"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("c")}, keys)
+
+	require.NoError(t, s.Delete([]byte("c")))
+	require.NoError(t, s.Sync())
+	require.NoError(t, s.Merge())
+
+	st, err := s.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, st.Keys)
+}
+
+func TestStore_Embedded(t *testing.T) {
+	db, err := bitcask.Open(t.TempDir())
+	require.NoError(t, err)
+	defer db.Close()
+	testStore(t, db)
+}
+
+func TestStore_Remote(t *testing.T) {
+	c, _ := newTestClient(t)
+	testStore(t, c)
+}
+
+func TestClient_ScanBulkPut(t *testing.T) {
+	c, db := newTestClient(t)
+	ctx := context.Background()
+
+	pairs := make(map[string]string)
+	for i := range 3000 {
+		pairs[fmt.Sprintf("k%04d", i)] = fmt.Sprintf("v%d", i)
+	}
+	n, err := c.BulkPut(ctx, func(yield func([]byte, []byte) bool) {
+		for k, v := range pairs {
+			if !yield([]byte(k), []byte(v)) {
+				return
+			}
+		}
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3000, n)
+
+	val, err := db.Get([]byte("k2999"))
+	require.NoError(t, err)
+	assert.Equal(t, "v2999", string(val))
+
+	// 跨越多个分页
+	var got []string
+	err = c.Scan(ctx, []byte("k1"), []byte("k1000"), 300, false, func(key, value []byte) bool {
+		got = append(got, string(key)+"="+string(value))
+		return true
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 300)
+	assert.Equal(t, "k1001=v1001", got[0])
+	assert.Equal(t, "k1300=v1300", got[299])
+
+	err = c.Scan(ctx, nil, nil, 0, true, func(key, value []byte) bool {
+		got = append(got[:0], string(key))
+		return false
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k0000"}, got)
+}
+
+// nextEvent 返回下一个不是探测写入的事件
+func nextEvent(t *testing.T, events <-chan bitcask.Event) bitcask.Event {
+	t.Helper()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			require.True(t, ok, "watch channel should be open")
+			if string(ev.Key) != "w/probe" {
+				return ev
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestClient_Watch(t *testing.T) {
+	c, db := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := c.Watch(ctx, []byte("w/"))
+	require.NoError(t, err)
+
+	// 订阅在服务端建立之后才能收到事件
+	require.Eventually(t, func() bool {
+		require.NoError(t, db.Put([]byte("w/probe"), []byte("x")))
+		select {
+		case ev := <-events:
+			return ev.Key != nil
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, db.Put([]byte("other"), []byte("x")))
+	require.NoError(t, db.Put([]byte("w/a"), []byte("1")))
+	require.NoError(t, db.Delete([]byte("w/a")))
+
+	for _, want := range []bitcask.Event{
+		{Op: bitcask.OpPut, Key: []byte("w/a"), Value: []byte("1")},
+		{Op: bitcask.OpDelete, Key: []byte("w/a")},
+	} {
+		ev := nextEvent(t, events)
+		require.NoError(t, ev.Err)
+		assert.Equal(t, want.Op, ev.Op)
+		assert.Equal(t, want.Key, ev.Key)
+		assert.Equal(t, string(want.Value), string(ev.Value))
+		assert.NotZero(t, ev.Seq)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestClient_Backup(t *testing.T) {
+	root := t.TempDir()
+	c, db := newTestClient(t, WithBackupDir(root))
+	require.NoError(t, db.Put([]byte("a"), []byte("1")))
+
+	require.NoError(t, c.Backup(context.Background(), "b1"))
+	assert.ErrorIs(t, c.Backup(context.Background(), "b1"), bitcask.ErrDirNotEmpty)
+	for _, name := range []string{"", ".", "..", "../b2", "b/c", t.TempDir()} {
+		assert.ErrorIs(t, c.Backup(context.Background(), name), ErrInvalidBackupName, "name %q", name)
+	}
+
+	c2, _ := newTestClient(t)
+	assert.ErrorIs(t, c2.Backup(context.Background(), "b1"), ErrBackupDisabled)
+
+	bk, err := bitcask.Open(filepath.Join(root, "b1"))
+	require.NoError(t, err)
+	defer bk.Close()
+	val, err := bk.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), val)
+}
@@ -0,0 +1,250 @@
+// Package grpc 通过 gRPC 提供 bitcask 的远程访问, 包括服务端和实现 bitcask.Store 的客户端
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/chhz0/bitcask"
+	"github.com/chhz0/bitcask/server/grpc/bitcaskpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// scanPageSize Scan 每次从 keydir 读取的键数量
+	scanPageSize = 256
+	// bulkBatchSize BulkPut 每个批次写入的键值对数量
+	bulkBatchSize = 1024
+)
+
+// Server 实现 bitcaskpb.BitcaskServer, 停止 gRPC 服务不会关闭 db
+type Server struct {
+	bitcaskpb.UnimplementedBitcaskServer
+	db        *bitcask.Bitcask
+	backupDir string
+}
+
+// ServerOption 配置 Server
+type ServerOption func(*Server)
+
+// WithBackupDir 允许 Backup 将数据备份到 dir 下, 未配置时 Backup 返回 ErrBackupDisabled
+func WithBackupDir(dir string) ServerOption {
+	return func(s *Server) {
+		s.backupDir = dir
+	}
+}
+
+func NewServer(db *bitcask.Bitcask, opts ...ServerOption) *Server {
+	s := &Server{db: db}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register 将服务注册到 gs
+func (s *Server) Register(gs *grpc.Server) {
+	bitcaskpb.RegisterBitcaskServer(gs, s)
+}
+
+func (s *Server) Get(_ context.Context, req *bitcaskpb.GetRequest) (*bitcaskpb.GetResponse, error) {
+	val, version, err := s.db.GetVersion(req.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.GetResponse{Value: val, Version: version}, nil
+}
+
+func (s *Server) Has(_ context.Context, req *bitcaskpb.HasRequest) (*bitcaskpb.HasResponse, error) {
+	ok, err := s.db.Has(req.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.HasResponse{Ok: ok}, nil
+}
+
+func (s *Server) Put(_ context.Context, req *bitcaskpb.PutRequest) (*bitcaskpb.PutResponse, error) {
+	if err := s.db.Put(req.GetKey(), req.GetValue()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.PutResponse{}, nil
+}
+
+func (s *Server) Delete(_ context.Context, req *bitcaskpb.DeleteRequest) (*bitcaskpb.DeleteResponse, error) {
+	if err := s.db.Delete(req.GetKey()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.DeleteResponse{}, nil
+}
+
+// Scan 分页读取 keydir, 读取值之前被删除的键跳过
+func (s *Server) Scan(req *bitcaskpb.ScanRequest, stream grpc.ServerStreamingServer[bitcaskpb.ScanResponse]) error {
+	after, left := req.GetAfter(), int(req.GetLimit())
+	for {
+		n := scanPageSize
+		if left > 0 {
+			n = min(n, left)
+		}
+		keys, err := s.db.ScanKeys(req.GetPrefix(), after, n)
+		if err != nil {
+			return toStatus(err)
+		}
+
+		for _, key := range keys {
+			resp := &bitcaskpb.ScanResponse{Key: key}
+			if !req.GetKeysOnly() {
+				if resp.Value, err = s.db.Get(key); errors.Is(err, bitcask.ErrKeyNotFound) {
+					continue
+				} else if err != nil {
+					return toStatus(err)
+				}
+			}
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < n {
+			return nil
+		}
+		after = keys[len(keys)-1]
+		if left > 0 {
+			if left -= len(keys); left == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (s *Server) BulkPut(stream grpc.ClientStreamingServer[bitcaskpb.BulkPutRequest, bitcaskpb.BulkPutResponse]) error {
+	var count int64
+	wb := bitcask.NewBatch()
+	flush := func() error {
+		if err := s.db.WriteBatch(wb); err != nil {
+			return toStatus(err)
+		}
+		count += int64(wb.Len())
+		wb.Reset()
+		return nil
+	}
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := wb.Put(req.GetKey(), req.GetValue()); err != nil {
+			return toStatus(err)
+		}
+		if wb.Len() >= bulkBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&bitcaskpb.BulkPutResponse{Count: count})
+}
+
+func (s *Server) WriteBatch(_ context.Context, req *bitcaskpb.WriteBatchRequest) (*bitcaskpb.WriteBatchResponse, error) {
+	wb := bitcask.NewBatch()
+	for _, op := range req.GetOps() {
+		var err error
+		if op.GetDelete() {
+			err = wb.Delete(op.GetKey())
+		} else {
+			err = wb.Put(op.GetKey(), op.GetValue())
+		}
+		if err != nil {
+			return nil, toStatus(err)
+		}
+	}
+
+	if err := s.db.WriteBatch(wb); err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.WriteBatchResponse{}, nil
+}
+
+func (s *Server) Watch(req *bitcaskpb.WatchRequest, stream grpc.ServerStreamingServer[bitcaskpb.WatchResponse]) error {
+	events, err := s.db.Watch(stream.Context(), req.GetPrefix())
+	if err != nil {
+		return toStatus(err)
+	}
+
+	for ev := range events {
+		if ev.Err != nil {
+			return toStatus(ev.Err)
+		}
+		// 协议中没有过期事件, 已过期被清除的键按删除发送, 修改过期时间按写入发送
+		del := ev.Op == bitcask.OpDelete ||
+			ev.Op == bitcask.OpExpire && !ev.Expiry.IsZero() && !ev.Expiry.After(time.Now())
+		op := &bitcaskpb.Op{Key: ev.Key, Value: ev.Value, Delete: del}
+		if err := stream.Send(&bitcaskpb.WatchResponse{Seq: ev.Seq, Op: op}); err != nil {
+			return err
+		}
+	}
+	// 通道在 ctx 结束或 db 关闭时被关闭
+	if err := stream.Context().Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return toStatus(bitcask.ErrClosed)
+}
+
+func (s *Server) Sync(context.Context, *bitcaskpb.SyncRequest) (*bitcaskpb.SyncResponse, error) {
+	if err := s.db.Sync(); err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.SyncResponse{}, nil
+}
+
+func (s *Server) Merge(context.Context, *bitcaskpb.MergeRequest) (*bitcaskpb.MergeResponse, error) {
+	if err := s.db.Merge(); err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.MergeResponse{}, nil
+}
+
+func (s *Server) Stats(context.Context, *bitcaskpb.StatsRequest) (*bitcaskpb.StatsResponse, error) {
+	st, err := s.db.Stats()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.StatsResponse{
+		Keys:      int64(st.Keys),
+		DataFiles: int64(st.DataFiles),
+		DataSize:  st.DataSize,
+		BlobFiles: int64(st.BlobFiles),
+		BlobSize:  st.BlobSize,
+		BlobDead:  st.BlobDead,
+		Snapshots: int64(st.Snapshots),
+	}, nil
+}
+
+// Backup 将数据目录在线备份到服务端备份目录下名为 dir 的子目录
+//
+// dir 只能是单个路径元素, 客户端不能指定备份目录以外的路径
+func (s *Server) Backup(_ context.Context, req *bitcaskpb.BackupRequest) (*bitcaskpb.BackupResponse, error) {
+	if s.backupDir == "" {
+		return nil, toStatus(ErrBackupDisabled)
+	}
+	name := req.GetDir()
+	if name == "." || !filepath.IsLocal(name) || filepath.Base(name) != name {
+		return nil, toStatus(ErrInvalidBackupName)
+	}
+
+	if err := s.db.Backup(filepath.Join(s.backupDir, name)); err != nil {
+		return nil, toStatus(err)
+	}
+	return &bitcaskpb.BackupResponse{}, nil
+}
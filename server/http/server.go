@@ -0,0 +1,353 @@
+// Package http 通过 HTTP/JSON 提供 bitcask 的访问
+//
+//	GET    /kv/{key}                      读取原始值
+//	PUT    /kv/{key}                      以请求体作为值写入, 请求体最大 64MB
+//	DELETE /kv/{key}                      删除
+//	GET    /kv?prefix=&limit=&cursor=     分页扫描
+//	POST   /batch                         原子写入多个键
+//	POST   /admin/merge                   合并数据文件
+//	GET    /admin/stats                   统计信息
+//
+// 单个键的读写使用记录版本号作为 ETag, 支持 If-Match 和 If-None-Match 条件请求
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chhz0/bitcask"
+)
+
+const (
+	// defaultScanLimit 扫描未指定 limit 时每页的数量
+	defaultScanLimit = 100
+	// maxScanLimit 每页的最大数量
+	maxScanLimit = 1000
+	// maxBodySize 请求体的最大大小, 请求体整个读入内存后写入
+	maxBodySize = 64 << 20
+)
+
+// Server 实现 http.Handler, 关闭 Server 所在的 http.Server 不会关闭 db
+type Server struct {
+	db  *bitcask.Bitcask
+	mux *nethttp.ServeMux
+}
+
+func NewServer(db *bitcask.Bitcask) *Server {
+	s := &Server{db: db, mux: nethttp.NewServeMux()}
+	s.mux.HandleFunc("GET /kv/{key...}", s.get)
+	s.mux.HandleFunc("PUT /kv/{key...}", s.put)
+	s.mux.HandleFunc("DELETE /kv/{key...}", s.delete)
+	s.mux.HandleFunc("GET /kv", s.scan)
+	s.mux.HandleFunc("POST /batch", s.batch)
+	s.mux.HandleFunc("POST /admin/merge", s.merge)
+	s.mux.HandleFunc("GET /admin/stats", s.stats)
+	return s
+}
+
+func (s *Server) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) get(w nethttp.ResponseWriter, r *nethttp.Request) {
+	val, version, err := s.db.GetVersion([]byte(r.PathValue("key")))
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		version = 0
+	} else if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if status := checkRead(r, version); status != 0 {
+		if status == nethttp.StatusNotModified {
+			w.Header().Set("ETag", etag(version))
+		}
+		w.WriteHeader(status)
+		return
+	}
+	if version == 0 {
+		writeError(w, bitcask.ErrKeyNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", etag(version))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(val)))
+	_, _ = w.Write(val)
+}
+
+func (s *Server) put(w nethttp.ResponseWriter, r *nethttp.Request) {
+	key := []byte(r.PathValue("key"))
+	if r.ContentLength > maxBodySize {
+		writeError(w, bitcask.ErrValueTooLarge)
+		return
+	}
+	val, err := io.ReadAll(nethttp.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		status := nethttp.StatusBadRequest
+		if tooLarge := new(nethttp.MaxBytesError); errors.As(err, &tooLarge) {
+			status = nethttp.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, errorBody{Error: err.Error()})
+		return
+	}
+
+	cond, status, err := s.condition(r, key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	version, err := s.db.PutIfVersion(key, val, cond)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+	w.WriteHeader(nethttp.StatusNoContent)
+}
+
+func (s *Server) delete(w nethttp.ResponseWriter, r *nethttp.Request) {
+	key := []byte(r.PathValue("key"))
+	cond, status, err := s.condition(r, key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	if err := s.db.DeleteIfVersion(key, cond); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(nethttp.StatusNoContent)
+}
+
+// condition 根据 If-Match 和 If-None-Match 计算写入时要求的版本号
+//
+// 条件依赖的版本号在写锁内再次检查, 期间被其他请求修改时写入返回 ErrVersionMismatch
+func (s *Server) condition(r *nethttp.Request, key []byte) (uint64, int, error) {
+	match, noneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if match == "" && noneMatch == "" {
+		return bitcask.AnyVersion, 0, nil
+	}
+
+	cur, err := s.db.Version(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	if match != "" && !etagMatch(match, cur) {
+		return 0, nethttp.StatusPreconditionFailed, nil
+	}
+	if noneMatch != "" && etagMatch(noneMatch, cur) {
+		return 0, nethttp.StatusPreconditionFailed, nil
+	}
+	return cur, 0, nil
+}
+
+// checkRead 处理读取的条件请求, 返回 0 表示需要返回值
+func checkRead(r *nethttp.Request, version uint64) int {
+	if match := r.Header.Get("If-Match"); match != "" && !etagMatch(match, version) {
+		return nethttp.StatusPreconditionFailed
+	}
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && etagMatch(noneMatch, version) {
+		return nethttp.StatusNotModified
+	}
+	return 0
+}
+
+// etag 将版本号编码为强 ETag
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 16) + `"`
+}
+
+// etagMatch 判断 header 中的 ETag 列表是否包含 version, * 匹配任意存在的键
+func etagMatch(header string, version uint64) bool {
+	if version == 0 {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	want := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// scanItem 扫描结果中的一项, 值在 JSON 中编码为 base64
+type scanItem struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	ETag  string `json:"etag"`
+}
+
+type scanPage struct {
+	Items      []scanItem `json:"items"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// scan 游标为上一页最后一个键的 base64url 编码, 最后一页不返回游标
+func (s *Server) scan(w nethttp.ResponseWriter, r *nethttp.Request) {
+	q := r.URL.Query()
+
+	limit := defaultScanLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSON(w, nethttp.StatusBadRequest, errorBody{Error: "invalid limit."})
+			return
+		}
+		limit = min(n, maxScanLimit)
+	}
+
+	var after []byte
+	if v := q.Get("cursor"); v != "" {
+		var err error
+		if after, err = base64.RawURLEncoding.DecodeString(v); err != nil {
+			writeJSON(w, nethttp.StatusBadRequest, errorBody{Error: "invalid cursor."})
+			return
+		}
+	}
+
+	keys, err := s.db.ScanKeys([]byte(q.Get("prefix")), after, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	page := scanPage{Items: make([]scanItem, 0, len(keys))}
+	for _, key := range keys {
+		val, version, err := s.db.GetVersion(key)
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			// 扫描后被删除
+			continue
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		page.Items = append(page.Items, scanItem{Key: string(key), Value: val, ETag: etag(version)})
+	}
+	if len(keys) == limit {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(keys[len(keys)-1])
+	}
+	writeJSON(w, nethttp.StatusOK, page)
+}
+
+// batchOp 批量写入中的一个操作, op 为 put 或 delete
+type batchOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+type batchRequest struct {
+	Ops []batchOp `json:"ops"`
+}
+
+func (s *Server) batch(w nethttp.ResponseWriter, r *nethttp.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(nethttp.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeJSON(w, nethttp.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+
+	wb := bitcask.NewBatch()
+	for _, op := range req.Ops {
+		var err error
+		switch op.Op {
+		case "put":
+			err = wb.Put([]byte(op.Key), op.Value)
+		case "delete":
+			err = wb.Delete([]byte(op.Key))
+		default:
+			err = fmt.Errorf("unknown op %q.", op.Op)
+		}
+		if err != nil {
+			writeJSON(w, nethttp.StatusBadRequest, errorBody{Error: err.Error()})
+			return
+		}
+	}
+
+	if err := s.db.WriteBatch(wb); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(nethttp.StatusNoContent)
+}
+
+func (s *Server) merge(w nethttp.ResponseWriter, _ *nethttp.Request) {
+	if err := s.db.Merge(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(nethttp.StatusNoContent)
+}
+
+type statsBody struct {
+	Keys      int   `json:"keys"`
+	DataFiles int   `json:"data_files"`
+	DataSize  int64 `json:"data_size"`
+	BlobFiles int   `json:"blob_files"`
+	BlobSize  int64 `json:"blob_size"`
+	BlobDead  int64 `json:"blob_dead"`
+	Snapshots int   `json:"snapshots"`
+}
+
+func (s *Server) stats(w nethttp.ResponseWriter, _ *nethttp.Request) {
+	st, err := s.db.Stats()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, nethttp.StatusOK, statsBody(st))
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// writeError 将存储引擎的错误转换为对应的状态码
+func writeError(w nethttp.ResponseWriter, err error) {
+	status := nethttp.StatusInternalServerError
+	switch {
+	case errors.Is(err, bitcask.ErrKeyNotFound):
+		status = nethttp.StatusNotFound
+	case errors.Is(err, bitcask.ErrVersionMismatch):
+		status = nethttp.StatusPreconditionFailed
+	case errors.Is(err, bitcask.ErrKeyEmpty), errors.Is(err, bitcask.ErrKeyTooLarge):
+		status = nethttp.StatusBadRequest
+	case errors.Is(err, bitcask.ErrValueTooLarge):
+		status = nethttp.StatusRequestEntityTooLarge
+	case errors.Is(err, bitcask.ErrReadOnly):
+		status = nethttp.StatusForbidden
+	case errors.Is(err, bitcask.ErrMergeInProgress):
+		status = nethttp.StatusConflict
+	}
+	writeJSON(w, status, errorBody{Error: err.Error()})
+}
+
+func writeJSON(w nethttp.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
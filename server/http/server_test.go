@@ -0,0 +1,178 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chhz0/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	db, err := bitcask.Open(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	ts := httptest.NewServer(NewServer(db))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func do(t *testing.T, method, url, body string, header ...string) (*nethttp.Response, string) {
+	t.Helper()
+
+	req, err := nethttp.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for i := 0; i < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := nethttp.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b)
+}
+
+func TestServer_KV(t *testing.T) {
+	ts := newTestServer(t)
+	url := ts.URL + "/kv/users/1"
+
+	resp, _ := do(t, "GET", url, "")
+	assert.Equal(t, nethttp.StatusNotFound, resp.StatusCode)
+
+	resp, _ = do(t, "PUT", url, "alice")
+	require.Equal(t, nethttp.StatusNoContent, resp.StatusCode)
+	tag := resp.Header.Get("ETag")
+	require.NotEmpty(t, tag)
+
+	resp, body := do(t, "GET", url, "")
+	assert.Equal(t, nethttp.StatusOK, resp.StatusCode)
+	assert.Equal(t, "alice", body)
+	assert.Equal(t, tag, resp.Header.Get("ETag"))
+
+	resp, _ = do(t, "GET", url, "", "If-None-Match", tag)
+	assert.Equal(t, nethttp.StatusNotModified, resp.StatusCode)
+
+	resp, _ = do(t, "DELETE", url, "")
+	assert.Equal(t, nethttp.StatusNoContent, resp.StatusCode)
+	resp, _ = do(t, "DELETE", url, "")
+	assert.Equal(t, nethttp.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_BodyTooLarge(t *testing.T) {
+	ts := newTestServer(t)
+	url := ts.URL + "/kv/big"
+
+	req, err := nethttp.NewRequest("PUT", url, io.LimitReader(zeroReader{}, maxBodySize+1))
+	require.NoError(t, err)
+	req.ContentLength = maxBodySize + 1
+	resp, err := nethttp.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, nethttp.StatusRequestEntityTooLarge, resp.StatusCode, "Declared size over the limit")
+
+	// 未声明长度的请求体在读取时检查
+	req, err = nethttp.NewRequest("PUT", url, io.LimitReader(zeroReader{}, maxBodySize+1))
+	require.NoError(t, err)
+	req.ContentLength = -1
+	resp, err = nethttp.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, nethttp.StatusRequestEntityTooLarge, resp.StatusCode, "Chunked body over the limit")
+
+	resp, _ = do(t, "GET", url, "")
+	assert.Equal(t, nethttp.StatusNotFound, resp.StatusCode)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestServer_Conditional(t *testing.T) {
+	ts := newTestServer(t)
+	url := ts.URL + "/kv/doc"
+
+	// If-None-Match: * 仅在键不存在时创建
+	resp, _ := do(t, "PUT", url, "v1", "If-None-Match", "*")
+	require.Equal(t, nethttp.StatusNoContent, resp.StatusCode)
+	v1 := resp.Header.Get("ETag")
+	resp, _ = do(t, "PUT", url, "v1", "If-None-Match", "*")
+	assert.Equal(t, nethttp.StatusPreconditionFailed, resp.StatusCode)
+
+	// 两个客户端基于同一版本修改, 后提交的失败
+	resp, _ = do(t, "PUT", url, "v2", "If-Match", v1)
+	require.Equal(t, nethttp.StatusNoContent, resp.StatusCode)
+	v2 := resp.Header.Get("ETag")
+	resp, _ = do(t, "PUT", url, "v2'", "If-Match", v1)
+	assert.Equal(t, nethttp.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = do(t, "DELETE", url, "", "If-Match", v1)
+	assert.Equal(t, nethttp.StatusPreconditionFailed, resp.StatusCode)
+	resp, _ = do(t, "DELETE", url, "", "If-Match", `"x", `+v2)
+	assert.Equal(t, nethttp.StatusNoContent, resp.StatusCode)
+
+	resp, _ = do(t, "PUT", url, "v3", "If-Match", "*")
+	assert.Equal(t, nethttp.StatusPreconditionFailed, resp.StatusCode)
+}
+
+func TestServer_BatchScan(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, _ := do(t, "POST", ts.URL+"/batch", `{"ops":[
+		{"op":"put","key":"a/1","value":"MQ=="},
+		{"op":"put","key":"a/2","value":"Mg=="},
+		{"op":"put","key":"a/3","value":"Mw=="},
+		{"op":"put","key":"b/1","value":"NA=="},
+		{"op":"delete","key":"a/3"}
+	]}`)
+	require.Equal(t, nethttp.StatusNoContent, resp.StatusCode)
+
+	resp, _ = do(t, "POST", ts.URL+"/batch", `{"ops":[{"op":"put","key":"a/4"},{"op":"nope","key":"a/5"}]}`)
+	assert.Equal(t, nethttp.StatusBadRequest, resp.StatusCode)
+	resp, _ = do(t, "GET", ts.URL+"/kv/a/4", "")
+	assert.Equal(t, nethttp.StatusNotFound, resp.StatusCode, "rejected batch should not apply")
+
+	var page scanPage
+	resp, body := do(t, "GET", ts.URL+"/kv?prefix=a/&limit=1", "")
+	require.Equal(t, nethttp.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "a/1", page.Items[0].Key)
+	assert.Equal(t, "1", string(page.Items[0].Value))
+	require.NotEmpty(t, page.NextCursor)
+
+	_, body = do(t, "GET", ts.URL+"/kv?prefix=a/&limit=10&cursor="+page.NextCursor, "")
+	page = scanPage{}
+	require.NoError(t, json.Unmarshal([]byte(body), &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "a/2", page.Items[0].Key)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestServer_Admin(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, "PUT", ts.URL+"/kv/k", "v")
+	do(t, "PUT", ts.URL+"/kv/k", "v")
+
+	resp, _ := do(t, "POST", ts.URL+"/admin/merge", "")
+	assert.Equal(t, nethttp.StatusNoContent, resp.StatusCode)
+
+	var st statsBody
+	resp, body := do(t, "GET", ts.URL+"/admin/stats", "")
+	require.Equal(t, nethttp.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &st))
+	assert.Equal(t, 1, st.Keys)
+	assert.Positive(t, st.DataSize)
+}
@@ -0,0 +1,288 @@
+package memcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	magicRequest  = 0x80
+	magicResponse = 0x81
+
+	// headerSize 二进制协议请求和响应的头部大小
+	headerSize = 24
+)
+
+// 二进制协议的操作码
+const (
+	opGet       = 0x00
+	opSet       = 0x01
+	opAdd       = 0x02
+	opReplace   = 0x03
+	opDelete    = 0x04
+	opIncrement = 0x05
+	opDecrement = 0x06
+	opQuit      = 0x07
+	opGetQ      = 0x09
+	opNoop      = 0x0a
+	opVersion   = 0x0b
+	opGetK      = 0x0c
+	opGetKQ     = 0x0d
+	opSetQ      = 0x11
+	opAddQ      = 0x12
+	opReplaceQ  = 0x13
+	opDeleteQ   = 0x14
+	opIncrQ     = 0x15
+	opDecrQ     = 0x16
+	opQuitQ     = 0x17
+	opTouch     = 0x1c
+)
+
+// 二进制协议的响应状态
+const (
+	statusOK           = 0x0000
+	statusNotFound     = 0x0001
+	statusExists       = 0x0002
+	statusTooLarge     = 0x0003
+	statusInvalidArgs  = 0x0004
+	statusNotStored    = 0x0005
+	statusNonNumeric   = 0x0006
+	statusUnknown      = 0x0081
+	statusNotSupported = 0x0083
+	statusInternal     = 0x0084
+)
+
+var errBadMagic = errors.New("bad request magic")
+
+// header 二进制协议的头部, 请求中 status 位置为 vbucket
+type header struct {
+	magic    byte
+	opcode   byte
+	keyLen   uint16
+	extraLen byte
+	status   uint16
+	bodyLen  uint32
+	opaque   uint32
+	cas      uint64
+}
+
+func readHeader(r io.Reader) (header, error) {
+	var buf [headerSize]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return header{}, err
+	}
+	h := header{
+		magic:    buf[0],
+		opcode:   buf[1],
+		keyLen:   binary.BigEndian.Uint16(buf[2:]),
+		extraLen: buf[4],
+		status:   binary.BigEndian.Uint16(buf[6:]),
+		bodyLen:  binary.BigEndian.Uint32(buf[8:]),
+		opaque:   binary.BigEndian.Uint32(buf[12:]),
+		cas:      binary.BigEndian.Uint64(buf[16:]),
+	}
+	if h.magic != magicRequest {
+		return h, errBadMagic
+	}
+	return h, nil
+}
+
+// response 写入一条响应
+func response(w io.Writer, req header, status uint16, cas uint64, extras, key, value []byte) error {
+	var buf [headerSize]byte
+	buf[0] = magicResponse
+	buf[1] = req.opcode
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(key)))
+	buf[4] = byte(len(extras))
+	binary.BigEndian.PutUint16(buf[6:], status)
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(buf[12:], req.opaque)
+	binary.BigEndian.PutUint64(buf[16:], cas)
+
+	for _, b := range [][]byte{buf[:], extras, key, value} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveBinary(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		req, err := readHeader(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if req.bodyLen > maxItemSize+maxKeyLen+64 || int(req.keyLen)+int(req.extraLen) > int(req.bodyLen) {
+			_ = response(w, req, statusTooLarge, 0, nil, nil, nil)
+			_ = w.Flush()
+			return errors.New("request body too large")
+		}
+
+		body := make([]byte, req.bodyLen)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return err
+		}
+		extras := body[:req.extraLen]
+		key := body[req.extraLen : int(req.extraLen)+int(req.keyLen)]
+		value := body[int(req.extraLen)+int(req.keyLen):]
+
+		quit, err := s.execBinary(w, req, extras, key, value)
+		if err != nil {
+			return err
+		}
+		if quit {
+			return w.Flush()
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// execBinary 执行一条二进制命令, 静默命令成功时不返回响应
+func (s *Server) execBinary(w io.Writer, req header, extras, key, value []byte) (bool, error) {
+	errorResponse := func(status uint16, msg string) error {
+		return response(w, req, status, 0, nil, nil, []byte(msg))
+	}
+	fail := func(err error) error {
+		return errorResponse(statusInternal, err.Error())
+	}
+
+	switch req.opcode {
+	case opGet, opGetQ, opGetK, opGetKQ:
+		it, ok, err := s.get(key)
+		if err != nil {
+			return false, fail(err)
+		}
+		quiet := req.opcode == opGetQ || req.opcode == opGetKQ
+		withKey := req.opcode == opGetK || req.opcode == opGetKQ
+		if !ok {
+			if quiet {
+				return false, nil
+			}
+			if withKey {
+				return false, response(w, req, statusNotFound, 0, nil, key, nil)
+			}
+			return false, errorResponse(statusNotFound, "Not found")
+		}
+		var flags [4]byte
+		binary.BigEndian.PutUint32(flags[:], it.flags)
+		if !withKey {
+			key = nil
+		}
+		return false, response(w, req, statusOK, it.cas, flags[:], key, it.value)
+
+	case opSet, opSetQ, opAdd, opAddQ, opReplace, opReplaceQ:
+		if len(extras) != 8 {
+			return false, errorResponse(statusInvalidArgs, "Invalid arguments")
+		}
+		flags := binary.BigEndian.Uint32(extras)
+		exptime := int64(binary.BigEndian.Uint32(extras[4:]))
+
+		mode := modeSet
+		switch req.opcode {
+		case opAdd, opAddQ:
+			mode = modeAdd
+		case opReplace, opReplaceQ:
+			mode = modeReplace
+		}
+		if req.cas != 0 {
+			if mode == modeAdd {
+				return false, errorResponse(statusInvalidArgs, "Invalid arguments")
+			}
+			mode = modeCAS
+		}
+
+		res, cas, err := s.store(mode, key, flags, exptime, value, req.cas)
+		if err != nil {
+			return false, fail(err)
+		}
+		if res == resStored && (req.opcode == opSetQ || req.opcode == opAddQ || req.opcode == opReplaceQ) {
+			return false, nil
+		}
+		return false, binaryResult(w, req, res, cas, nil)
+
+	case opDelete, opDeleteQ:
+		res, err := s.delete(key, req.cas)
+		if err != nil {
+			return false, fail(err)
+		}
+		if res == resStored && req.opcode == opDeleteQ {
+			return false, nil
+		}
+		return false, binaryResult(w, req, res, 0, nil)
+
+	case opIncrement, opIncrQ, opDecrement, opDecrQ:
+		if len(extras) != 20 {
+			return false, errorResponse(statusInvalidArgs, "Invalid arguments")
+		}
+		delta := binary.BigEndian.Uint64(extras)
+		initial := binary.BigEndian.Uint64(extras[8:])
+		exptime := binary.BigEndian.Uint32(extras[16:])
+
+		// exptime 为 0xffffffff 时键不存在不创建
+		var init *uint64
+		if exptime != 0xffffffff {
+			init = &initial
+		} else {
+			exptime = 0
+		}
+		decr := req.opcode == opDecrement || req.opcode == opDecrQ
+		res, n, cas, err := s.incr(key, delta, decr, init, int64(exptime))
+		if err != nil {
+			return false, fail(err)
+		}
+		if res == resStored && (req.opcode == opIncrQ || req.opcode == opDecrQ) {
+			return false, nil
+		}
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], n)
+		return false, binaryResult(w, req, res, cas, buf[:])
+
+	case opTouch:
+		if len(extras) != 4 {
+			return false, errorResponse(statusInvalidArgs, "Invalid arguments")
+		}
+		res, err := s.touch(key, int64(binary.BigEndian.Uint32(extras)))
+		if err != nil {
+			return false, fail(err)
+		}
+		return false, binaryResult(w, req, res, 0, nil)
+
+	case opNoop:
+		return false, response(w, req, statusOK, 0, nil, nil, nil)
+
+	case opVersion:
+		return false, response(w, req, statusOK, 0, nil, nil, []byte(version))
+
+	case opQuit:
+		return true, response(w, req, statusOK, 0, nil, nil, nil)
+
+	case opQuitQ:
+		return true, nil
+	}
+	return false, errorResponse(statusUnknown, "Unknown command")
+}
+
+// binaryResult value 为成功时响应的值
+func binaryResult(w io.Writer, req header, res result, cas uint64, value []byte) error {
+	switch res {
+	case resNotStored:
+		return response(w, req, statusNotStored, 0, nil, nil, []byte("Not stored"))
+	case resExists:
+		return response(w, req, statusExists, 0, nil, nil, []byte("Data exists for key"))
+	case resNotFound:
+		return response(w, req, statusNotFound, 0, nil, nil, []byte("Not found"))
+	case resNonNumeric:
+		return response(w, req, statusNonNumeric, 0, nil, nil, []byte("Non-numeric server-side value for incr or decr"))
+	}
+	return response(w, req, statusOK, cas, nil, nil, value)
+}
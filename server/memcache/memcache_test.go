@@ -0,0 +1,273 @@
+package memcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chhz0/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	_, conn, r := start(t)
+	return conn, r
+}
+
+// start 启动服务并返回底层的 db, 用于检查其他接口写入的数据
+func start(t *testing.T) (*bitcask.Bitcask, net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	db, err := bitcask.Open(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := NewServer(db)
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return db, conn, bufio.NewReader(conn)
+}
+
+// text 发送文本命令并读取 lines 行回复
+func text(t *testing.T, conn net.Conn, r *bufio.Reader, cmd string, lines int) string {
+	t.Helper()
+
+	_, err := conn.Write([]byte(cmd))
+	require.NoError(t, err)
+	var out []string
+	for range lines {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		out = append(out, strings.TrimSuffix(line, "\r\n"))
+	}
+	return strings.Join(out, "|")
+}
+
+func TestText(t *testing.T) {
+	conn, r := dial(t)
+
+	assert.Equal(t, "STORED", text(t, conn, r, "set a 42 0 5\r\nhello\r\n", 1))
+	assert.Equal(t, "VALUE a 42 5|hello|END", text(t, conn, r, "get a missing\r\n", 3))
+	assert.Equal(t, "NOT_STORED", text(t, conn, r, "add a 0 0 1\r\nx\r\n", 1))
+	assert.Equal(t, "NOT_STORED", text(t, conn, r, "replace b 0 0 1\r\nx\r\n", 1))
+
+	// cas 使用 gets 返回的版本号
+	gets := text(t, conn, r, "gets a\r\n", 3)
+	var flags, size int
+	var cas uint64
+	_, err := fmt.Sscanf(gets, "VALUE a %d %d %d", &flags, &size, &cas)
+	require.NoError(t, err)
+	assert.Equal(t, "STORED", text(t, conn, r, fmt.Sprintf("cas a 7 0 5 %d\r\nworld\r\n", cas), 1))
+	assert.Equal(t, "EXISTS", text(t, conn, r, fmt.Sprintf("cas a 7 0 5 %d\r\nstale\r\n", cas), 1))
+	assert.Equal(t, "NOT_FOUND", text(t, conn, r, "cas b 0 0 1 1\r\nx\r\n", 1))
+	assert.Equal(t, "NOT_FOUND", text(t, conn, r, "cas b 0 0 1 0\r\nx\r\n", 1), "cas 0 should not create the key")
+	assert.Equal(t, "EXISTS", text(t, conn, r, "cas a 0 0 1 0\r\nx\r\n", 1))
+	assert.Equal(t, "END", text(t, conn, r, "get b\r\n", 1))
+	assert.Equal(t, "VALUE a 7 5|world|END", text(t, conn, r, "get a\r\n", 3))
+
+	assert.Equal(t, "STORED", text(t, conn, r, "set n 3 0 2\r\n10\r\n", 1))
+	assert.Equal(t, "15", text(t, conn, r, "incr n 5\r\n", 1))
+	assert.Equal(t, "0", text(t, conn, r, "decr n 100\r\n", 1))
+	assert.Equal(t, "VALUE n 3 1|0|END", text(t, conn, r, "get n\r\n", 3), "flags should be kept")
+	assert.Equal(t, "NOT_FOUND", text(t, conn, r, "incr missing 1\r\n", 1))
+	assert.Equal(t, "CLIENT_ERROR cannot increment or decrement non-numeric value", text(t, conn, r, "incr a 1\r\n", 1))
+
+	assert.Equal(t, "TOUCHED", text(t, conn, r, "touch a 0\r\n", 1))
+	assert.Equal(t, "NOT_FOUND", text(t, conn, r, "touch missing 0\r\n", 1))
+	assert.Equal(t, "DELETED", text(t, conn, r, "delete a\r\n", 1))
+	assert.Equal(t, "NOT_FOUND", text(t, conn, r, "delete a\r\n", 1))
+
+	// noreply 与流水线
+	assert.Equal(t, "VALUE c 0 1|z|END", text(t, conn, r, "set c 0 0 1 noreply\r\nz\r\nget c\r\n", 3))
+	assert.Equal(t, "ERROR", text(t, conn, r, "bogus\r\n", 1))
+}
+
+func TestExptime(t *testing.T) {
+	db, conn, r := start(t)
+
+	assert.Equal(t, "STORED", text(t, conn, r, "set a 1 100 1\r\nx\r\n", 1))
+	exp, err := db.Expiry([]byte("a"))
+	require.NoError(t, err)
+	assert.InDelta(t, 100, time.Until(exp).Seconds(), 1, "Relative exptime")
+
+	at := time.Now().Add(40 * 24 * time.Hour).Unix()
+	assert.Equal(t, "STORED", text(t, conn, r, fmt.Sprintf("set b 0 %d 1\r\nx\r\n", at), 1))
+	exp, err = db.Expiry([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, at, exp.Unix(), "Exptime over 30 days is a Unix timestamp")
+
+	assert.Equal(t, "STORED", text(t, conn, r, "set n 0 100 1\r\n1\r\n", 1))
+	assert.Equal(t, "2", text(t, conn, r, "incr n 1\r\n", 1))
+	exp, err = db.Expiry([]byte("n"))
+	require.NoError(t, err)
+	assert.False(t, exp.IsZero(), "incr should keep the expiry")
+
+	assert.Equal(t, "TOUCHED", text(t, conn, r, "touch a 0\r\n", 1))
+	exp, err = db.Expiry([]byte("a"))
+	require.NoError(t, err)
+	assert.True(t, exp.IsZero(), "touch with 0 should remove the expiry")
+	assert.Equal(t, "TOUCHED", text(t, conn, r, "touch a -1\r\n", 1))
+	assert.Equal(t, "END", text(t, conn, r, "get a\r\n", 1), "Negative exptime expires immediately")
+	assert.Equal(t, "NOT_FOUND", text(t, conn, r, "touch a 10\r\n", 1))
+
+	assert.Equal(t, "STORED", text(t, conn, r, "set c 0 -1 1\r\nx\r\n", 1))
+	assert.Equal(t, "END", text(t, conn, r, "get c\r\n", 1))
+	assert.Equal(t, "CLIENT_ERROR bad command line format", text(t, conn, r, "set c 0 99999999999 1\r\n", 1))
+}
+
+func TestForeignValues(t *testing.T) {
+	db, conn, r := start(t)
+
+	// 其他接口 (如 RESP 的 SET) 写入的值没有前缀, 不能将其开头误当作 flags
+	require.NoError(t, db.Put([]byte("resp"), []byte("\x05hello")))
+	assert.Equal(t, "VALUE resp 0 6|\x05hello|END", text(t, conn, r, "get resp\r\n", 3))
+	require.NoError(t, db.Put([]byte("prefix"), []byte("\x00mc")))
+	assert.Equal(t, "VALUE prefix 0 3|\x00mc|END", text(t, conn, r, "get prefix\r\n", 3))
+
+	assert.Equal(t, "STORED", text(t, conn, r, "set mc 7 0 2\r\nhi\r\n", 1))
+	raw, err := db.Get([]byte("mc"))
+	require.NoError(t, err)
+	assert.Equal(t, encodeItem(7, []byte("hi")), raw)
+	assert.Equal(t, item{flags: 7, value: []byte("hi"), cas: 1}, decodeItem(raw, 1))
+
+	// flags 为 0 的值不加前缀, 其他接口可以直接读取和修改
+	assert.Equal(t, "STORED", text(t, conn, r, "set n 0 0 2\r\n10\r\n", 1))
+	assert.Equal(t, "11", text(t, conn, r, "incr n 1\r\n", 1))
+	raw, err = db.Get([]byte("n"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("11"), raw)
+
+	assert.Equal(t, "STORED", text(t, conn, r, "set magic 0 0 5\r\n\x00mc\x01x\r\n", 1))
+	assert.Equal(t, "VALUE magic 0 5|\x00mc\x01x|END", text(t, conn, r, "get magic\r\n", 3), "Raw values with the prefix should round-trip")
+}
+
+// binReq 编码二进制协议请求
+func binReq(opcode byte, cas uint64, extras, key, value []byte) []byte {
+	buf := make([]byte, headerSize, headerSize+len(extras)+len(key)+len(value))
+	buf[0] = magicRequest
+	buf[1] = opcode
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(key)))
+	buf[4] = byte(len(extras))
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(buf[12:], uint32(opcode))
+	binary.BigEndian.PutUint64(buf[16:], cas)
+	buf = append(buf, extras...)
+	buf = append(buf, key...)
+	return append(buf, value...)
+}
+
+type binResp struct {
+	header
+	extras, key, value []byte
+}
+
+func readResp(t *testing.T, r *bufio.Reader) binResp {
+	t.Helper()
+
+	var buf [headerSize]byte
+	_, err := io.ReadFull(r, buf[:])
+	require.NoError(t, err)
+	require.Equal(t, byte(magicResponse), buf[0])
+
+	h := header{
+		opcode:   buf[1],
+		keyLen:   binary.BigEndian.Uint16(buf[2:]),
+		extraLen: buf[4],
+		status:   binary.BigEndian.Uint16(buf[6:]),
+		bodyLen:  binary.BigEndian.Uint32(buf[8:]),
+		opaque:   binary.BigEndian.Uint32(buf[12:]),
+		cas:      binary.BigEndian.Uint64(buf[16:]),
+	}
+	body := make([]byte, h.bodyLen)
+	_, err = io.ReadFull(r, body)
+	require.NoError(t, err)
+	return binResp{
+		header: h,
+		extras: body[:h.extraLen],
+		key:    body[h.extraLen : int(h.extraLen)+int(h.keyLen)],
+		value:  body[int(h.extraLen)+int(h.keyLen):],
+	}
+}
+
+func TestBinary(t *testing.T) {
+	conn, r := dial(t)
+	send := func(req []byte) {
+		_, err := conn.Write(req)
+		require.NoError(t, err)
+	}
+	setExtras := func(flags, exptime uint32) []byte {
+		b := binary.BigEndian.AppendUint32(nil, flags)
+		return binary.BigEndian.AppendUint32(b, exptime)
+	}
+
+	send(binReq(opSet, 0, setExtras(9, 0), []byte("k"), []byte("v1")))
+	set := readResp(t, r)
+	assert.EqualValues(t, statusOK, set.status)
+	assert.EqualValues(t, opSet, set.opaque)
+	require.NotZero(t, set.cas)
+
+	send(binReq(opGetK, 0, nil, []byte("k"), nil))
+	get := readResp(t, r)
+	assert.EqualValues(t, statusOK, get.status)
+	assert.Equal(t, uint32(9), binary.BigEndian.Uint32(get.extras))
+	assert.Equal(t, "k", string(get.key))
+	assert.Equal(t, "v1", string(get.value))
+	assert.Equal(t, set.cas, get.cas)
+
+	send(binReq(opSet, set.cas+1, setExtras(0, 0), []byte("k"), []byte("v2")))
+	assert.EqualValues(t, statusExists, readResp(t, r).status)
+	send(binReq(opAdd, 0, setExtras(0, 0), []byte("k"), []byte("v2")))
+	assert.EqualValues(t, statusNotStored, readResp(t, r).status)
+
+	// 静默命令: 未命中的 GetQ 和成功的 SetQ 没有响应, 由 Noop 结束
+	send(append(append(
+		binReq(opGetQ, 0, nil, []byte("missing"), nil),
+		binReq(opSetQ, 0, setExtras(0, 0), []byte("q"), []byte("x"))...),
+		binReq(opNoop, 0, nil, nil, nil)...))
+	assert.EqualValues(t, opNoop, readResp(t, r).opcode)
+
+	incrExtras := func(delta, initial uint64, exptime uint32) []byte {
+		b := binary.BigEndian.AppendUint64(nil, delta)
+		b = binary.BigEndian.AppendUint64(b, initial)
+		return binary.BigEndian.AppendUint32(b, exptime)
+	}
+	send(binReq(opIncrement, 0, incrExtras(5, 100, 0), []byte("n"), nil))
+	incr := readResp(t, r)
+	assert.EqualValues(t, statusOK, incr.status)
+	assert.Equal(t, uint64(100), binary.BigEndian.Uint64(incr.value), "missing key should be set to initial")
+	send(binReq(opDecrement, 0, incrExtras(30, 0, 0xffffffff), []byte("n"), nil))
+	assert.Equal(t, uint64(70), binary.BigEndian.Uint64(readResp(t, r).value))
+	send(binReq(opIncrement, 0, incrExtras(1, 0, 0xffffffff), []byte("none"), nil))
+	assert.EqualValues(t, statusNotFound, readResp(t, r).status)
+
+	send(binReq(opDelete, 0, nil, []byte("k"), nil))
+	assert.EqualValues(t, statusOK, readResp(t, r).status)
+	send(binReq(opGet, 0, nil, []byte("k"), nil))
+	assert.EqualValues(t, statusNotFound, readResp(t, r).status)
+
+	send(binReq(opSet, 0, setExtras(0, 30), []byte("t"), []byte("v")))
+	assert.EqualValues(t, statusOK, readResp(t, r).status)
+	send(binReq(opTouch, 0, binary.BigEndian.AppendUint32(nil, uint32(time.Now().Add(-time.Hour).Unix())), []byte("t"), nil))
+	assert.EqualValues(t, statusOK, readResp(t, r).status)
+	send(binReq(opGet, 0, nil, []byte("t"), nil))
+	assert.EqualValues(t, statusNotFound, readResp(t, r).status, "Touch with a past timestamp should expire the key")
+
+	send(binReq(opVersion, 0, nil, nil, nil))
+	assert.Equal(t, version, string(readResp(t, r).value))
+	send(binReq(0x42, 0, nil, nil, nil))
+	assert.EqualValues(t, statusUnknown, readResp(t, r).status)
+}
@@ -0,0 +1,111 @@
+// Package memcache 通过 memcached 文本协议和二进制协议提供 bitcask 的访问
+//
+// flags 不为 0 时值的前面保存前缀和 flags, 这样的键不适合再通过其他接口读取;
+// flags 为 0 的值原样存储, 与其他接口互通, 其他接口写入的值读取时 flags 为 0.
+// cas 唯一值为记录的版本号, 不受合并影响. exptime 使用存储引擎的过期时间
+package memcache
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	"github.com/chhz0/bitcask"
+)
+
+// version version 命令返回的版本号
+const version = "1.6.0-bitcask"
+
+// Server 首个字节为 0x80 的连接使用二进制协议, 其余使用文本协议
+type Server struct {
+	db *bitcask.Bitcask
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewServer 创建服务, 关闭服务不会关闭 db
+func NewServer(db *bitcask.Bitcask) *Server {
+	return &Server{
+		db:    db,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve 接受客户端连接, 直到 ln 被关闭或 Close 被调用
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	s.ln = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			_ = s.serveConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// Close 停止接受连接并断开所有客户端
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	magic, err := r.Peek(1)
+	if err != nil {
+		return err
+	}
+	if magic[0] == magicRequest {
+		return s.serveBinary(r, w)
+	}
+	return s.serveText(r, w)
+}
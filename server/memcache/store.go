@@ -0,0 +1,249 @@
+package memcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/chhz0/bitcask"
+)
+
+// result 存储命令的结果, 由文本协议和二进制协议分别编码
+type result int
+
+const (
+	resStored result = iota
+	resNotStored
+	resExists
+	resNotFound
+	resNonNumeric
+)
+
+// storeMode 存储命令的条件
+type storeMode int
+
+const (
+	modeSet     storeMode = iota
+	modeAdd               // 键不存在时写入
+	modeReplace           // 键存在时写入
+	modeCAS               // 版本号等于 cas 时写入
+)
+
+// itemMagic 本服务写入的值的前缀, 之后是版本号和以 uvarint 编码的 flags
+const (
+	itemMagic   = "\x00mc"
+	itemVersion = 1
+)
+
+// maxRelativeExptime exptime 不超过 30 天时为相对时间, 否则为 Unix 时间戳
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+// item 键对应的值, flags 不为 0 时编码在值的前面
+type item struct {
+	flags uint32
+	value []byte
+	cas   uint64
+}
+
+// encodeItem flags 为 0 时直接存储原始值, 其他接口读取和写入的值与 memcache 一致.
+// 原始值恰好以本服务前缀开头时仍然加上前缀, 避免读取时被误解析
+func encodeItem(flags uint32, value []byte) []byte {
+	if flags == 0 && !bytes.HasPrefix(value, []byte(itemMagic)) {
+		return value
+	}
+
+	buf := make([]byte, 0, len(itemMagic)+1+binary.MaxVarintLen32+len(value))
+	buf = append(buf, itemMagic...)
+	buf = append(buf, itemVersion)
+	buf = binary.AppendUvarint(buf, uint64(flags))
+	return append(buf, value...)
+}
+
+// decodeItem 没有本服务前缀的值视为 flags 为 0 的原始值
+func decodeItem(raw []byte, cas uint64) item {
+	head, ok := bytes.CutPrefix(raw, []byte(itemMagic))
+	if !ok || len(head) == 0 || head[0] != itemVersion {
+		return item{value: raw, cas: cas}
+	}
+	flags, n := binary.Uvarint(head[1:])
+	if n <= 0 || flags > math.MaxUint32 {
+		return item{value: raw, cas: cas}
+	}
+	return item{flags: uint32(flags), value: head[1+n:], cas: cas}
+}
+
+// expiryTime 按 memcached 的规则转换 exptime: 0 表示不过期, 负数表示立即过期
+func expiryTime(exptime int64) time.Time {
+	switch {
+	case exptime == 0:
+		return time.Time{}
+	case exptime < 0:
+		return time.UnixMilli(1)
+	case exptime <= maxRelativeExptime:
+		return time.Now().Add(time.Duration(exptime) * time.Second)
+	default:
+		return time.Unix(exptime, 0)
+	}
+}
+
+func (s *Server) get(key []byte) (item, bool, error) {
+	raw, version, err := s.db.GetVersion(key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return item{}, false, nil
+	}
+	if err != nil {
+		return item{}, false, err
+	}
+	return decodeItem(raw, version), true, nil
+}
+
+// store 按 mode 写入, 返回新的版本号
+//
+// 条件由 PutIfVersion 在写锁内检查, replace 期间被并发修改时重试
+func (s *Server) store(mode storeMode, key []byte, flags uint32, exptime int64, value []byte, cas uint64) (result, uint64, error) {
+	raw, expiry := encodeItem(flags, value), expiryTime(exptime)
+
+	for {
+		cond := bitcask.AnyVersion
+		switch mode {
+		case modeAdd:
+			cond = 0
+		case modeCAS:
+			// cas 为 0 不会匹配任何版本, 不能作为键不存在的条件传给 PutIfVersion
+			if cas == 0 {
+				return s.casMismatch(key)
+			}
+			cond = cas
+		case modeReplace:
+			cur, err := s.db.Version(key)
+			if err != nil {
+				return 0, 0, err
+			}
+			if cur == 0 {
+				return resNotStored, 0, nil
+			}
+			cond = cur
+		}
+
+		version, err := s.db.PutIfVersionWithExpiry(key, raw, cond, expiry)
+		if err == nil {
+			return resStored, version, nil
+		}
+		if !errors.Is(err, bitcask.ErrVersionMismatch) {
+			return 0, 0, err
+		}
+
+		switch mode {
+		case modeAdd:
+			return resNotStored, 0, nil
+		case modeCAS:
+			return s.casMismatch(key)
+		}
+	}
+}
+
+// casMismatch cas 条件不满足时, 按键是否存在返回 resExists 或 resNotFound
+func (s *Server) casMismatch(key []byte) (result, uint64, error) {
+	cur, err := s.db.Version(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	if cur == 0 {
+		return resNotFound, 0, nil
+	}
+	return resExists, 0, nil
+}
+
+// delete cas 为 0 时无条件删除
+func (s *Server) delete(key []byte, cas uint64) (result, error) {
+	if cas == 0 {
+		cas = bitcask.AnyVersion
+	}
+
+	err := s.db.DeleteIfVersion(key, cas)
+	switch {
+	case err == nil:
+		return resStored, nil
+	case errors.Is(err, bitcask.ErrKeyNotFound):
+		return resNotFound, nil
+	case errors.Is(err, bitcask.ErrVersionMismatch):
+		ok, err := s.db.Has(key)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return resNotFound, nil
+		}
+		return resExists, nil
+	}
+	return 0, err
+}
+
+// incr 按 memcached 的规则修改十进制数值: incr 按 64 位无符号数回绕, decr 最小为 0
+//
+// 键不存在时, initial 不为空则以 exptime 写入初始值, 否则返回 resNotFound.
+// 修改已有的值时保留其过期时间
+func (s *Server) incr(key []byte, delta uint64, decr bool, initial *uint64, exptime int64) (result, uint64, uint64, error) {
+	for {
+		it, ok, err := s.get(key)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		var (
+			n, cond uint64
+			expiry  time.Time
+		)
+		if !ok {
+			if initial == nil {
+				return resNotFound, 0, 0, nil
+			}
+			n, expiry = *initial, expiryTime(exptime)
+		} else {
+			cur, err := strconv.ParseUint(string(it.value), 10, 64)
+			if err != nil {
+				return resNonNumeric, 0, 0, nil
+			}
+			switch {
+			case !decr:
+				n = cur + delta
+			case delta > cur:
+				n = 0
+			default:
+				n = cur - delta
+			}
+			cond = it.cas
+			// 读取过期时间后键被修改时, 下面的写入因版本号不符而重试
+			if expiry, err = s.db.Expiry(key); err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+				return 0, 0, 0, err
+			}
+		}
+
+		raw := encodeItem(it.flags, strconv.AppendUint(nil, n, 10))
+		version, err := s.db.PutIfVersionWithExpiry(key, raw, cond, expiry)
+		if errors.Is(err, bitcask.ErrVersionMismatch) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return resStored, n, version, nil
+	}
+}
+
+// touch 修改键的过期时间, 键存在时返回 resStored
+//
+// 修改过期时间会重写记录, cas 唯一值随之改变
+func (s *Server) touch(key []byte, exptime int64) (result, error) {
+	ok, err := s.db.Expire(key, expiryTime(exptime))
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return resNotFound, nil
+	}
+	return resStored, nil
+}
@@ -0,0 +1,237 @@
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// maxKeyLen memcached 协议的最大键长度
+	maxKeyLen = 250
+	// maxLineLen 命令行的最大长度, get 可以带多个键
+	maxLineLen = 64 << 10
+	// maxItemSize 单个值的最大大小
+	maxItemSize = 1 << 20
+)
+
+var errBadFormat = errors.New("bad command line format")
+
+func (s *Server) serveText(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if errors.Is(err, errBadFormat) {
+				fmt.Fprintf(w, "CLIENT_ERROR %s\r\n", err)
+				_ = w.Flush()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		quit, err := s.execText(r, w, bytes.Fields(line))
+		if err != nil {
+			return err
+		}
+		if quit {
+			return w.Flush()
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		line = append(line, frag...)
+		if len(line) > maxLineLen {
+			return nil, errBadFormat
+		}
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+	}
+	return bytes.TrimSuffix(line[:len(line)-1], []byte("\r")), nil
+}
+
+// execText 执行一条文本命令, 只有连接出错时返回错误
+func (s *Server) execText(r *bufio.Reader, w *bufio.Writer, args [][]byte) (bool, error) {
+	if len(args) == 0 {
+		w.WriteString("ERROR\r\n")
+		return false, nil
+	}
+
+	reply := func(s string, noreply bool) {
+		if !noreply {
+			w.WriteString(s)
+			w.WriteString("\r\n")
+		}
+	}
+	serverError := func(err error, noreply bool) {
+		reply("SERVER_ERROR "+err.Error(), noreply)
+	}
+
+	switch cmd := string(args[0]); cmd {
+	case "get", "gets":
+		if len(args) < 2 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		for _, key := range args[1:] {
+			it, ok, err := s.get(key)
+			if err != nil {
+				serverError(err, false)
+				return false, nil
+			}
+			if !ok {
+				continue
+			}
+			if cmd == "gets" {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, it.flags, len(it.value), it.cas)
+			} else {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, it.flags, len(it.value))
+			}
+			w.Write(it.value)
+			w.WriteString("\r\n")
+		}
+		w.WriteString("END\r\n")
+
+	case "set", "add", "replace", "cas":
+		// <cmd> <key> <flags> <exptime> <bytes> [cas unique] [noreply]
+		n := 5
+		if cmd == "cas" {
+			n = 6
+		}
+		if len(args) < n || len(args) > n+1 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		noreply := len(args) == n+1 && string(args[n]) == "noreply"
+		key := args[1]
+		flags, ferr := strconv.ParseUint(string(args[2]), 10, 32)
+		exptime, eerr := strconv.ParseInt(string(args[3]), 10, 32)
+		size, serr := strconv.Atoi(string(args[4]))
+		var (
+			cas  uint64
+			cerr error
+		)
+		if cmd == "cas" {
+			cas, cerr = strconv.ParseUint(string(args[5]), 10, 64)
+		}
+		if ferr != nil || eerr != nil || serr != nil || cerr != nil || size < 0 || len(key) > maxKeyLen {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return false, nil
+		}
+		if size > maxItemSize {
+			w.WriteString("SERVER_ERROR object too large for cache\r\n")
+			// 丢弃数据块, 保持与后续命令的同步
+			_, err := r.Discard(size + 2)
+			return false, err
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return false, err
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+			return false, nil
+		}
+
+		mode := map[string]storeMode{"set": modeSet, "add": modeAdd, "replace": modeReplace, "cas": modeCAS}[cmd]
+		res, _, err := s.store(mode, key, uint32(flags), exptime, data[:size], cas)
+		if err != nil {
+			serverError(err, noreply)
+			return false, nil
+		}
+		reply(textResult(res, "STORED"), noreply)
+
+	case "delete":
+		// delete <key> [0] [noreply], 旧版本客户端会带上值为 0 的时间参数
+		if len(args) < 2 || len(args) > 4 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		noreply := string(args[len(args)-1]) == "noreply"
+		res, err := s.delete(args[1], 0)
+		if err != nil {
+			serverError(err, noreply)
+			return false, nil
+		}
+		reply(textResult(res, "DELETED"), noreply)
+
+	case "incr", "decr":
+		if len(args) < 3 || len(args) > 4 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		noreply := len(args) == 4 && string(args[3]) == "noreply"
+		delta, err := strconv.ParseUint(string(args[2]), 10, 64)
+		if err != nil {
+			reply("CLIENT_ERROR invalid numeric delta argument", noreply)
+			return false, nil
+		}
+		res, n, _, err := s.incr(args[1], delta, cmd == "decr", nil, 0)
+		if err != nil {
+			serverError(err, noreply)
+			return false, nil
+		}
+		reply(textResult(res, strconv.FormatUint(n, 10)), noreply)
+
+	case "touch":
+		if len(args) < 3 || len(args) > 4 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		noreply := len(args) == 4 && string(args[3]) == "noreply"
+		exptime, err := strconv.ParseInt(string(args[2]), 10, 32)
+		if err != nil {
+			reply("CLIENT_ERROR invalid exptime argument", noreply)
+			return false, nil
+		}
+		res, err := s.touch(args[1], exptime)
+		if err != nil {
+			serverError(err, noreply)
+			return false, nil
+		}
+		reply(textResult(res, "TOUCHED"), noreply)
+
+	case "version":
+		w.WriteString("VERSION " + version + "\r\n")
+
+	case "quit":
+		return true, nil
+
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return false, nil
+}
+
+// textResult ok 为成功时的回复
+func textResult(res result, ok string) string {
+	switch res {
+	case resNotStored:
+		return "NOT_STORED"
+	case resExists:
+		return "EXISTS"
+	case resNotFound:
+		return "NOT_FOUND"
+	case resNonNumeric:
+		return "CLIENT_ERROR cannot increment or decrement non-numeric value"
+	}
+	return ok
+}
@@ -0,0 +1,696 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chhz0/bitcask"
+)
+
+// defaultScanCount SCAN 未指定 COUNT 时每次返回的键数量
+const defaultScanCount = 10
+
+// command 命令表中的一项, arity 包含命令名, 为负数时表示参数数量至少为 -arity
+type command struct {
+	arity int
+	fn    func(c *client, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":    {-1, cmdPing},
+		"echo":    {2, cmdEcho},
+		"hello":   {-1, cmdHello},
+		"quit":    {-1, cmdQuit},
+		"select":  {2, cmdSelect},
+		"client":  {-2, cmdClient},
+		"command": {-1, cmdCommand},
+		"config":  {-2, cmdConfig},
+		"info":    {-1, cmdInfo},
+		"dbsize":  {1, cmdDBSize},
+		"get":     {2, cmdGet},
+		"set":     {-3, cmdSet},
+		"del":     {-2, cmdDel},
+		"exists":  {-2, cmdExists},
+		"keys":    {2, cmdKeys},
+		"scan":    {-2, cmdScan},
+		"mget":    {-2, cmdMGet},
+		"mset":    {-3, cmdMSet},
+		"incr":    {2, cmdIncr},
+		"decr":    {2, cmdDecr},
+		"incrby":  {3, cmdIncrBy},
+		"decrby":  {3, cmdDecrBy},
+		"expire":  {3, cmdExpire},
+		"pexpire": {3, cmdPExpire},
+		"persist": {2, cmdPersist},
+		"ttl":     {2, cmdTTL},
+		"pttl":    {2, cmdPTTL},
+	}
+}
+
+func (c *client) exec(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+	cmd.fn(c, args)
+}
+
+// replyError 将存储引擎的错误转换为 Redis 风格的错误回复
+func (c *client) replyError(err error) {
+	switch {
+	case errors.Is(err, bitcask.ErrNotCounter):
+		c.w.error("ERR value is not an integer or out of range")
+	case errors.Is(err, bitcask.ErrCounterOverflow):
+		c.w.error("ERR increment or decrement would overflow")
+	case errors.Is(err, bitcask.ErrReadOnly):
+		c.w.error("READONLY " + err.Error())
+	default:
+		c.w.error("ERR " + err.Error())
+	}
+}
+
+func cmdPing(c *client, args [][]byte) {
+	switch len(args) {
+	case 1:
+		c.w.simple("PONG")
+	case 2:
+		c.w.bulk(args[1])
+	default:
+		c.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func cmdEcho(c *client, args [][]byte) {
+	c.w.bulk(args[1])
+}
+
+// cmdHello HELLO [protover [AUTH username password] [SETNAME clientname]]
+//
+// 服务没有认证, AUTH 参数被忽略
+func cmdHello(c *client, args [][]byte) {
+	proto := c.w.proto
+	if len(args) > 1 {
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			c.w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if n != 2 && n != 3 {
+			c.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = n
+	}
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); {
+		case opt == "auth" && i+2 < len(args):
+			i += 2
+		case opt == "setname" && i+1 < len(args):
+			c.name = string(args[i+1])
+			i++
+		default:
+			c.w.error(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[i]))
+			return
+		}
+	}
+
+	c.w.proto = proto
+	c.w.mapHeader(7)
+	c.w.bulkString("server")
+	c.w.bulkString("bitcask")
+	c.w.bulkString("version")
+	c.w.bulkString("1.0.0")
+	c.w.bulkString("proto")
+	c.w.int(int64(proto))
+	c.w.bulkString("id")
+	c.w.int(c.id)
+	c.w.bulkString("mode")
+	c.w.bulkString("standalone")
+	c.w.bulkString("role")
+	c.w.bulkString("master")
+	c.w.bulkString("modules")
+	c.w.array(0)
+}
+
+func cmdQuit(c *client, _ [][]byte) {
+	c.w.simple("OK")
+	c.quit = true
+}
+
+// cmdSelect 只有一个数据库
+func cmdSelect(c *client, args [][]byte) {
+	if string(args[1]) != "0" {
+		c.w.error("ERR DB index is out of range")
+		return
+	}
+	c.w.simple("OK")
+}
+
+func cmdClient(c *client, args [][]byte) {
+	switch strings.ToLower(string(args[1])) {
+	case "setname":
+		if len(args) != 3 {
+			c.w.error("ERR wrong number of arguments for 'client|setname' command")
+			return
+		}
+		c.name = string(args[2])
+		c.w.simple("OK")
+	case "getname":
+		if c.name == "" {
+			c.w.null()
+			return
+		}
+		c.w.bulkString(c.name)
+	case "id":
+		c.w.int(c.id)
+	case "setinfo":
+		c.w.simple("OK")
+	default:
+		c.w.error(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+	}
+}
+
+// cmdCommand 客户端启动时会查询命令文档, 返回空结果即可
+func cmdCommand(c *client, args [][]byte) {
+	if len(args) > 1 && strings.EqualFold(string(args[1]), "count") {
+		c.w.int(int64(len(commands)))
+		return
+	}
+	if len(args) > 1 && strings.EqualFold(string(args[1]), "docs") {
+		c.w.mapHeader(0)
+		return
+	}
+	c.w.array(0)
+}
+
+// cmdConfig 没有可配置的参数, CONFIG GET 返回空结果以兼容 redis-benchmark
+func cmdConfig(c *client, args [][]byte) {
+	if strings.EqualFold(string(args[1]), "get") {
+		c.w.mapHeader(0)
+		return
+	}
+	c.w.error("ERR CONFIG " + strings.ToUpper(string(args[1])) + " is not supported")
+}
+
+// cmdInfo INFO [section ...], 包含 server clients stats bitcask keyspace 几个部分
+func cmdInfo(c *client, args [][]byte) {
+	st, err := c.srv.db.Stats()
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+
+	want := func(section string) bool {
+		if len(args) == 1 {
+			return true
+		}
+		for _, arg := range args[1:] {
+			s := strings.ToLower(string(arg))
+			if s == section || s == "all" || s == "everything" || s == "default" {
+				return true
+			}
+		}
+		return false
+	}
+
+	var sb strings.Builder
+	section := func(name string, fields ...any) {
+		if !want(name) {
+			return
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\r\n")
+		}
+		fmt.Fprintf(&sb, "# %s\r\n", strings.ToUpper(name[:1])+name[1:])
+		for i := 0; i < len(fields); i += 2 {
+			fmt.Fprintf(&sb, "%s:%v\r\n", fields[i], fields[i+1])
+		}
+	}
+
+	section("server",
+		"bitcask_mode", "standalone",
+		"process_id", os.Getpid(),
+		"uptime_in_seconds", int64(time.Since(c.srv.start).Seconds()),
+	)
+	section("clients",
+		"connected_clients", c.srv.clients(),
+	)
+	section("stats",
+		"total_connections_received", c.srv.connections.Load(),
+		"total_commands_processed", c.srv.commands.Load(),
+	)
+	section("bitcask",
+		"keys", st.Keys,
+		"data_files", st.DataFiles,
+		"data_size", st.DataSize,
+		"blob_files", st.BlobFiles,
+		"blob_size", st.BlobSize,
+		"blob_dead", st.BlobDead,
+		"snapshots", st.Snapshots,
+	)
+	// 不统计设置了过期时间的键, 省略 expires 和 avg_ttl
+	if st.Keys > 0 {
+		section("keyspace",
+			"db0", fmt.Sprintf("keys=%d", st.Keys),
+		)
+	} else {
+		section("keyspace")
+	}
+	c.w.verbatim(sb.String())
+}
+
+func cmdDBSize(c *client, _ [][]byte) {
+	st, err := c.srv.db.Stats()
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.w.int(int64(st.Keys))
+}
+
+func cmdGet(c *client, args [][]byte) {
+	val, err := c.srv.db.Get(args[1])
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		c.w.null()
+		return
+	}
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.w.bulk(val)
+}
+
+// cmdSet SET key value [NX] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func cmdSet(c *client, args [][]byte) {
+	var (
+		nx, keep, timed bool
+		expiry          time.Time
+	)
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		switch opt {
+		case "nx":
+			nx = true
+		case "keepttl":
+			if timed {
+				c.w.error("ERR syntax error")
+				return
+			}
+			keep = true
+		case "ex", "px", "exat", "pxat":
+			if keep || timed || i+1 >= len(args) {
+				c.w.error("ERR syntax error")
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				c.w.error("ERR value is not an integer or out of range")
+				return
+			}
+			if expiry, timed = expireAt(opt, n); n <= 0 || !timed {
+				c.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	var err error
+	switch {
+	case nx:
+		// 不存在的键没有过期时间, KEEPTTL 不起作用
+		_, err = c.srv.db.PutIfVersionWithExpiry(args[1], args[2], 0, expiry)
+		if errors.Is(err, bitcask.ErrVersionMismatch) {
+			c.w.null()
+			return
+		}
+	case keep:
+		err = c.setKeepTTL(args[1], args[2])
+	default:
+		err = c.srv.db.PutWithExpiry(args[1], args[2], expiry)
+	}
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.w.simple("OK")
+}
+
+// expireAt 将 SET 和 EXPIRE 的过期参数转换为绝对时间, 超出范围时返回 false
+func expireAt(opt string, n int64) (time.Time, bool) {
+	switch opt {
+	case "ex":
+		if n > math.MaxInt64/int64(time.Second) {
+			return time.Time{}, false
+		}
+		return time.Now().Add(time.Duration(n) * time.Second), true
+	case "px":
+		if n > math.MaxInt64/int64(time.Millisecond) {
+			return time.Time{}, false
+		}
+		return time.Now().Add(time.Duration(n) * time.Millisecond), true
+	case "exat":
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, false
+		}
+		return time.Unix(n, 0), true
+	default:
+		return time.UnixMilli(n), true
+	}
+}
+
+// setKeepTTL 写入时保留键原有的过期时间, 期间键被并发修改时重试
+func (c *client) setKeepTTL(key, val []byte) error {
+	for {
+		version, err := c.srv.db.Version(key)
+		if err != nil {
+			return err
+		}
+		expiry, err := c.srv.db.Expiry(key)
+		if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return err
+		}
+		_, err = c.srv.db.PutIfVersionWithExpiry(key, val, version, expiry)
+		if !errors.Is(err, bitcask.ErrVersionMismatch) {
+			return err
+		}
+	}
+}
+
+// cmdDel 存在性检查和删除不是原子的, 并发删除同一个键时计数可能偏大
+func cmdDel(c *client, args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		ok, err := c.srv.db.Has(key)
+		if err != nil {
+			c.replyError(err)
+			return
+		}
+		if !ok {
+			continue
+		}
+		if err := c.srv.db.Delete(key); err != nil {
+			c.replyError(err)
+			return
+		}
+		n++
+	}
+	c.w.int(n)
+}
+
+func cmdExists(c *client, args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		ok, err := c.srv.db.Has(key)
+		if err != nil {
+			c.replyError(err)
+			return
+		}
+		if ok {
+			n++
+		}
+	}
+	c.w.int(n)
+}
+
+func cmdKeys(c *client, args [][]byte) {
+	pattern := args[1]
+	keys, err := c.srv.db.ScanKeys(globPrefix(pattern), nil, 0)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+
+	matched := keys[:0]
+	for _, key := range keys {
+		if globMatch(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+	c.w.array(len(matched))
+	for _, key := range matched {
+		c.w.bulk(key)
+	}
+}
+
+// cmdScan SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+//
+// 游标对应服务端记录的上一次扫描到的键, 按字节序继续遍历,
+// 扫描期间一直存在的键都会被返回. 未知或已被淘汰的游标返回错误, 客户端需要从 0 重新扫描
+func cmdScan(c *client, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.w.error("ERR invalid cursor")
+		return
+	}
+
+	var (
+		pattern []byte
+		count   = defaultScanCount
+		other   bool // TYPE 不是 string 时没有匹配的键
+	)
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.w.error("ERR syntax error")
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				c.w.error("ERR value is not an integer or out of range")
+				return
+			}
+		case "type":
+			other = !strings.EqualFold(string(args[i+1]), "string")
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	var keys [][]byte
+	next := uint64(0)
+	if !other {
+		after, ok := c.srv.cursors.get(cursor)
+		if !ok {
+			c.w.error("ERR invalid cursor")
+			return
+		}
+		if keys, err = c.srv.db.ScanKeys(globPrefix(pattern), after, count); err != nil {
+			c.replyError(err)
+			return
+		}
+		if len(keys) == count {
+			next = c.srv.cursors.add(keys[len(keys)-1])
+		}
+	}
+
+	matched := keys[:0]
+	for _, key := range keys {
+		if pattern == nil || globMatch(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+	c.w.array(2)
+	c.w.bulkString(strconv.FormatUint(next, 10))
+	c.w.array(len(matched))
+	for _, key := range matched {
+		c.w.bulk(key)
+	}
+}
+
+// cmdMGet 不存在的键回复 nil, 其他读取错误使整个命令回复错误
+func cmdMGet(c *client, args [][]byte) {
+	vals := make([][]byte, len(args)-1)
+	for i, key := range args[1:] {
+		val, err := c.srv.db.Get(key)
+		switch {
+		case errors.Is(err, bitcask.ErrKeyNotFound):
+			continue
+		case err != nil:
+			c.replyError(err)
+			return
+		case val == nil:
+			// 空值与不存在的键区分开
+			val = []byte{}
+		}
+		vals[i] = val
+	}
+
+	c.w.array(len(vals))
+	for _, val := range vals {
+		if val == nil {
+			c.w.null()
+			continue
+		}
+		c.w.bulk(val)
+	}
+}
+
+// cmdMSet 所有键值通过一个批次原子写入
+func cmdMSet(c *client, args [][]byte) {
+	if len(args)%2 != 1 {
+		c.w.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	wb := bitcask.NewBatch()
+	for i := 1; i < len(args); i += 2 {
+		if err := wb.Put(args[i], args[i+1]); err != nil {
+			c.replyError(err)
+			return
+		}
+	}
+	if err := c.srv.db.WriteBatch(wb); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.w.simple("OK")
+}
+
+func cmdIncr(c *client, args [][]byte) {
+	c.incr(args[1], 1)
+}
+
+func cmdDecr(c *client, args [][]byte) {
+	c.incr(args[1], -1)
+}
+
+func cmdIncrBy(c *client, args [][]byte) {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.error("ERR value is not an integer or out of range")
+		return
+	}
+	c.incr(args[1], delta)
+}
+
+func cmdDecrBy(c *client, args [][]byte) {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.error("ERR value is not an integer or out of range")
+		return
+	}
+	c.decr(args[1], delta)
+}
+
+func (c *client) incr(key []byte, delta int64) {
+	n, err := c.srv.db.Incr(key, delta)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.w.int(n)
+}
+
+func (c *client) decr(key []byte, delta int64) {
+	n, err := c.srv.db.Decr(key, delta)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.w.int(n)
+}
+
+func cmdExpire(c *client, args [][]byte) {
+	c.expire(args[1], args[2], "expire", "ex")
+}
+
+func cmdPExpire(c *client, args [][]byte) {
+	c.expire(args[1], args[2], "pexpire", "px")
+}
+
+// expire opt 为过期参数的单位, 与 SET 的选项相同. 过期时间不大于 0 时键立即过期
+func (c *client) expire(key, arg []byte, name, opt string) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		c.w.error("ERR value is not an integer or out of range")
+		return
+	}
+
+	expiry, ok := expireAt(opt, n)
+	if !ok {
+		c.w.error("ERR invalid expire time in '" + name + "' command")
+		return
+	}
+	if n <= 0 {
+		expiry = time.UnixMilli(1)
+	}
+	ok, err = c.srv.db.Expire(key, expiry)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.w.int(boolInt(ok))
+}
+
+// cmdPersist 检查和清除过期时间不是原子的, 与 cmdDel 相同
+func cmdPersist(c *client, args [][]byte) {
+	expiry, err := c.srv.db.Expiry(args[1])
+	if errors.Is(err, bitcask.ErrKeyNotFound) || (err == nil && expiry.IsZero()) {
+		c.w.int(0)
+		return
+	}
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+
+	ok, err := c.srv.db.Expire(args[1], time.Time{})
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.w.int(boolInt(ok))
+}
+
+func cmdTTL(c *client, args [][]byte) {
+	c.ttl(args[1], time.Second)
+}
+
+func cmdPTTL(c *client, args [][]byte) {
+	c.ttl(args[1], time.Millisecond)
+}
+
+// ttl 以 unit 为单位回复剩余时间, 键不存在时回复 -2, 没有过期时间时回复 -1
+func (c *client) ttl(key []byte, unit time.Duration) {
+	expiry, err := c.srv.db.Expiry(key)
+	switch {
+	case errors.Is(err, bitcask.ErrKeyNotFound):
+		c.w.int(-2)
+	case err != nil:
+		c.replyError(err)
+	case expiry.IsZero():
+		c.w.int(-1)
+	default:
+		// 与 Redis 相同, 按四舍五入换算
+		c.w.int(int64((time.Until(expiry) + unit/2) / unit))
+	}
+}
+
+func boolInt(ok bool) int64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
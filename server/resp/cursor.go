@@ -0,0 +1,47 @@
+package resp
+
+import "sync"
+
+// maxCursors 服务端保留的 SCAN 游标数量, 超过后淘汰最早的游标
+const maxCursors = 4096
+
+// cursorTable 记录 SCAN 游标对应的上一次扫描到的键
+//
+// Redis 客户端要求游标为整数, 无法直接携带键, 因此由服务端保存
+type cursorTable struct {
+	mu    sync.Mutex
+	next  uint64
+	keys  map[uint64][]byte
+	order []uint64 // 按创建顺序排列的游标
+}
+
+func newCursorTable() *cursorTable {
+	return &cursorTable{keys: make(map[uint64][]byte)}
+}
+
+// add 保存 key 并返回新游标, 游标从 1 开始, 0 表示扫描结束
+func (t *cursorTable) add(key []byte) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.order) >= maxCursors {
+		delete(t.keys, t.order[0])
+		t.order = t.order[1:]
+	}
+	t.next++
+	t.keys[t.next] = key
+	t.order = append(t.order, t.next)
+	return t.next
+}
+
+// get 返回游标对应的键, 游标为 0 时返回 nil, 游标未知或已被淘汰时 ok 为 false
+func (t *cursorTable) get(cursor uint64) (key []byte, ok bool) {
+	if cursor == 0 {
+		return nil, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key, ok = t.keys[cursor]
+	return key, ok
+}
@@ -0,0 +1,179 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+const (
+	// maxBulkLen 单个参数的最大长度, 与 Redis 的 proto-max-bulk-len 默认值相同
+	maxBulkLen = 512 << 20
+	// maxArgs 单条命令的最大参数数量
+	maxArgs = 1 << 20
+	// maxInlineLen 内联命令的最大长度
+	maxInlineLen = 64 << 10
+
+	// 参数数量和长度由客户端声明, 预先分配的空间不超过以下大小, 之后随实际读到的数据增长
+	argsPrealloc = 64
+	bulkPrealloc = 64 << 10
+)
+
+var ErrProtocol = errors.New("protocol error.")
+
+// readCommand 读取一条命令, 支持批量字符串数组和 redis-cli 使用的内联命令
+//
+// 空行返回长度为 0 的命令, 调用方直接忽略
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r, maxInlineLen)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, ErrProtocol
+	}
+	args := make([][]byte, 0, min(max(n, 0), argsPrealloc))
+	for range n {
+		line, err := readLine(r, maxInlineLen)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, ErrProtocol
+		}
+		sz, err := strconv.Atoi(string(line[1:]))
+		if err != nil || sz < 0 || sz > maxBulkLen {
+			return nil, ErrProtocol
+		}
+
+		arg, err := readBulk(r, sz+2)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(arg, []byte("\r\n")) {
+			return nil, ErrProtocol
+		}
+		args = append(args, arg[:sz])
+	}
+	return args, nil
+}
+
+// readBulk 读取 n 字节, 较大的参数不按声明的长度预先分配
+func readBulk(r io.Reader, n int) ([]byte, error) {
+	if n <= bulkPrealloc {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(r, buf)
+		return buf, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(bulkPrealloc)
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readLine 读取以 \r\n 或 \n 结尾的一行, 不包含行尾
+func readLine(r *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		line = append(line, frag...)
+		if len(line) > limit {
+			return nil, ErrProtocol
+		}
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+	}
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+	return line, nil
+}
+
+// writer 按连接协商的协议版本编码回复
+type writer struct {
+	*bufio.Writer
+	proto int // 2 或 3
+}
+
+func (w *writer) simple(s string) {
+	w.WriteByte('+')
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) error(s string) {
+	w.WriteByte('-')
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) int(n int64) {
+	w.header(':', int(n))
+}
+
+func (w *writer) bulk(b []byte) {
+	w.header('$', len(b))
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) bulkString(s string) {
+	w.header('$', len(s))
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// null RESP2 使用空的批量字符串, RESP3 使用独立的空类型
+func (w *writer) null() {
+	if w.proto == 3 {
+		w.WriteString("_\r\n")
+		return
+	}
+	w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	w.header('*', n)
+}
+
+// mapHeader RESP2 中映射编码为键值交替的数组
+func (w *writer) mapHeader(n int) {
+	if w.proto == 3 {
+		w.header('%', n)
+		return
+	}
+	w.header('*', 2*n)
+}
+
+// verbatim RESP3 的逐字字符串, 用于 INFO 等面向人阅读的文本
+func (w *writer) verbatim(s string) {
+	if w.proto != 3 {
+		w.bulkString(s)
+		return
+	}
+	w.header('=', len(s)+4)
+	w.WriteString("txt:")
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) header(prefix byte, n int) {
+	w.WriteByte(prefix)
+	w.WriteString(strconv.Itoa(n))
+	w.WriteString("\r\n")
+}
@@ -0,0 +1,309 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chhz0/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T) string {
+	t.Helper()
+
+	db, err := bitcask.Open(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return serve(t, db)
+}
+
+func serve(t *testing.T, db *bitcask.Bitcask) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := NewServer(db)
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return ln.Addr().String()
+}
+
+// testConn 发送命令并以文本形式读取回复, 数组展开为多行
+type testConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *testConn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *testConn) send(args ...string) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write([]byte(sb.String()))
+	require.NoError(c.t, err)
+}
+
+func (c *testConn) do(args ...string) string {
+	c.send(args...)
+	return c.reply()
+}
+
+func (c *testConn) reply() string {
+	line, err := readLine(c.r, maxInlineLen)
+	require.NoError(c.t, err)
+
+	switch line[0] {
+	case '$', '=':
+		if string(line) == "$-1" {
+			return "(nil)"
+		}
+		n, err := strconv.Atoi(string(line[1:]))
+		require.NoError(c.t, err)
+		buf := make([]byte, n+2)
+		_, err = io.ReadFull(c.r, buf)
+		require.NoError(c.t, err)
+		if line[0] == '=' {
+			return "verbatim " + string(buf[4:n])
+		}
+		return string(buf[:n])
+	case '*', '%':
+		n, err := strconv.Atoi(string(line[1:]))
+		require.NoError(c.t, err)
+		if line[0] == '%' {
+			n *= 2
+		}
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.reply()
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case '_':
+		return "(nil)"
+	default:
+		return string(line)
+	}
+}
+
+func TestServer_Commands(t *testing.T) {
+	c := dial(t, startServer(t))
+
+	assert.Equal(t, "+PONG", c.do("PING"))
+	assert.Equal(t, "+OK", c.do("SET", "a", "1"))
+	assert.Equal(t, "1", c.do("GET", "a"))
+	assert.Equal(t, "(nil)", c.do("GET", "missing"))
+	assert.Equal(t, "(nil)", c.do("SET", "a", "2", "NX"))
+
+	assert.Equal(t, "+OK", c.do("MSET", "b", "2", "c", "3"))
+	assert.Equal(t, "[1 (nil) 3]", c.do("MGET", "a", "x", "c"))
+	assert.Equal(t, ":2", c.do("EXISTS", "a", "b", "x"))
+	assert.Equal(t, ":2", c.do("DEL", "b", "c", "x"))
+	assert.Equal(t, ":0", c.do("EXISTS", "b"))
+
+	assert.Equal(t, ":2", c.do("INCR", "a"))
+	assert.Equal(t, ":-8", c.do("DECRBY", "a", "10"))
+	assert.Equal(t, "-ERR value is not an integer or out of range", c.do("INCRBY", "a", "x"))
+
+	assert.Equal(t, "-ERR unknown command 'NOPE'", c.do("NOPE"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'get' command", c.do("GET"))
+	assert.Contains(t, c.do("INFO"), "# Keyspace\r\ndb0:keys=1\r\n")
+
+	// 内联命令
+	_, err := c.conn.Write([]byte("GET a\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "-8", c.reply())
+}
+
+func TestServer_MGetError(t *testing.T) {
+	db, err := bitcask.Open(t.TempDir())
+	require.NoError(t, err)
+	c := dial(t, serve(t, db))
+
+	assert.Equal(t, "+OK", c.do("SET", "a", "1"))
+	require.NoError(t, db.Close())
+	assert.Equal(t, "-ERR "+bitcask.ErrClosed.Error(), c.do("MGET", "a", "x"),
+		"Read errors other than a missing key should fail the command")
+	assert.Equal(t, "+PONG", c.do("PING"), "Connection should stay in sync")
+}
+
+func TestServer_TTL(t *testing.T) {
+	c := dial(t, startServer(t))
+
+	assert.Equal(t, "+OK", c.do("SET", "a", "1", "EX", "100"))
+	assert.Equal(t, ":100", c.do("TTL", "a"))
+	assert.Equal(t, "+OK", c.do("SET", "a", "2", "KEEPTTL"))
+	assert.Equal(t, ":100", c.do("TTL", "a"), "KEEPTTL should keep the expiry")
+	assert.Equal(t, "2", c.do("GET", "a"))
+	assert.Equal(t, "+OK", c.do("SET", "a", "3"))
+	assert.Equal(t, ":-1", c.do("TTL", "a"), "SET should clear the expiry")
+	assert.Equal(t, ":-2", c.do("TTL", "missing"))
+
+	assert.Equal(t, "+OK", c.do("SET", "b", "1", "PX", "100000"))
+	assert.Equal(t, ":100", c.do("TTL", "b"))
+	assert.Equal(t, ":1", c.do("PERSIST", "b"))
+	assert.Equal(t, ":0", c.do("PERSIST", "b"))
+	assert.Equal(t, ":-1", c.do("PTTL", "b"))
+
+	at := time.Now().Add(time.Hour).Unix()
+	assert.Equal(t, "+OK", c.do("SET", "c", "1", "EXAT", strconv.FormatInt(at, 10)))
+	assert.Contains(t, []string{":3599", ":3600"}, c.do("TTL", "c"), "EXAT has second precision")
+	assert.Equal(t, "+OK", c.do("SET", "c", "1", "PXAT", strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)))
+	assert.Equal(t, "(nil)", c.do("GET", "c"), "Key should expire at PXAT")
+	assert.Equal(t, "+OK", c.do("SET", "c", "1", "NX", "EX", "10"), "NX should treat expired keys as absent")
+	assert.Equal(t, "(nil)", c.do("SET", "c", "2", "NX", "EX", "10"))
+
+	assert.Equal(t, ":1", c.do("EXPIRE", "a", "50"))
+	assert.Equal(t, ":50", c.do("TTL", "a"))
+	assert.Equal(t, ":0", c.do("EXPIRE", "missing", "50"))
+	assert.Equal(t, ":1", c.do("PEXPIRE", "a", "0"))
+	assert.Equal(t, ":0", c.do("EXISTS", "a"), "Non-positive expire should delete the key")
+
+	assert.Equal(t, "-ERR invalid expire time in 'set' command", c.do("SET", "a", "1", "EX", "0"))
+	assert.Equal(t, "-ERR syntax error", c.do("SET", "a", "1", "EX", "10", "KEEPTTL"))
+	assert.Equal(t, "-ERR syntax error", c.do("SET", "a", "1", "EX"))
+	assert.Equal(t, "-ERR value is not an integer or out of range", c.do("EXPIRE", "a", "x"))
+}
+
+func TestServer_RESP3(t *testing.T) {
+	c := dial(t, startServer(t))
+
+	assert.Contains(t, c.do("HELLO", "3"), "proto :3")
+	assert.Equal(t, "(nil)", c.do("GET", "missing"))
+	assert.Equal(t, "verbatim # Keyspace\r\n", c.do("INFO", "keyspace"))
+	assert.Equal(t, "[]", c.do("CONFIG", "GET", "save"))
+	assert.Equal(t, "-NOPROTO unsupported protocol version", c.do("HELLO", "4"))
+}
+
+func TestServer_Scan(t *testing.T) {
+	c := dial(t, startServer(t))
+	for i := range 25 {
+		require.Equal(t, "+OK", c.do("SET", fmt.Sprintf("user:%02d", i), "v"))
+	}
+	require.Equal(t, "+OK", c.do("SET", "other", "v"))
+
+	assert.Equal(t, "[user:01 user:11 user:21]", c.do("KEYS", "user:?1"))
+
+	var keys []string
+	cursor := "0"
+	for {
+		reply := strings.Trim(c.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "7"), "[]")
+		cursor, reply, _ = strings.Cut(reply, " ")
+		if page := strings.Trim(reply, "[]"); page != "" {
+			keys = append(keys, strings.Split(page, " ")...)
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Len(t, keys, 25)
+	assert.Equal(t, "user:00", keys[0])
+	assert.Equal(t, "user:24", keys[24])
+
+	assert.Equal(t, "-ERR invalid cursor", c.do("SCAN", "12345"), "Unknown cursors should not restart the scan")
+}
+
+func TestCursorTable_Evict(t *testing.T) {
+	ct := newCursorTable()
+	first := ct.add([]byte("a"))
+	for range maxCursors {
+		ct.add([]byte("b"))
+	}
+
+	_, ok := ct.get(first)
+	assert.False(t, ok, "Evicted cursor should be reported")
+	key, ok := ct.get(first + maxCursors)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("b"), key)
+	key, ok = ct.get(0)
+	assert.True(t, ok)
+	assert.Nil(t, key)
+}
+
+func TestServer_PipelineConcurrent(t *testing.T) {
+	addr := startServer(t)
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		c := dial(t, addr)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// 一次写入多条命令, 按顺序读取回复
+			var sb strings.Builder
+			for i := range 100 {
+				key := fmt.Sprintf("k%d-%d", w, i)
+				fmt.Fprintf(&sb, "*3\r\n$3\r\nSET\r\n$%d\r\n%s\r\n$1\r\nv\r\n", len(key), key)
+				sb.WriteString("*2\r\n$4\r\nINCR\r\n$7\r\ncounter\r\n")
+			}
+			_, err := c.conn.Write([]byte(sb.String()))
+			assert.NoError(t, err)
+			for range 100 {
+				assert.Equal(t, "+OK", c.reply())
+				assert.True(t, strings.HasPrefix(c.reply(), ":"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	c := dial(t, addr)
+	assert.Equal(t, "400", c.do("GET", "counter"))
+	assert.Equal(t, ":401", c.do("DBSIZE"))
+}
+
+func TestReadCommand_Oversized(t *testing.T) {
+	big := strings.Repeat("x", bulkPrealloc+10)
+	args, err := readCommand(bufio.NewReader(strings.NewReader("*2\r\n$3\r\nSET\r\n$" + strconv.Itoa(len(big)) + "\r\n" + big + "\r\n")))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("SET"), []byte(big)}, args)
+
+	// 声明的长度和参数数量不能直接决定分配的内存
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = readCommand(bufio.NewReader(strings.NewReader("*1048576\r\n$536870911\r\nabc")))
+	runtime.ReadMemStats(&after)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbb", false},
+		{"h?llo", "hallo", true},
+		{"h[ae]llo", "hello", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{"user:*", "user:1/2", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, globMatch([]byte(tt.pattern), []byte(tt.s)), "%s %s", tt.pattern, tt.s)
+	}
+	assert.Equal(t, "user:", string(globPrefix([]byte("user:*"))))
+}
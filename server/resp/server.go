@@ -0,0 +1,156 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chhz0/bitcask"
+)
+
+// Server 通过 Redis 协议(RESP2/RESP3)提供 bitcask 的访问
+//
+// 每个连接独立处理, 同一连接上的流水线命令按顺序执行,
+// 读缓冲中没有待处理的命令时才刷新回复
+type Server struct {
+	db      *bitcask.Bitcask
+	cursors *cursorTable
+	start   time.Time
+
+	// 统计信息, 用于 INFO
+	clientID    atomic.Int64
+	connections atomic.Int64
+	commands    atomic.Int64
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewServer 创建服务, 关闭服务不会关闭 db
+func NewServer(db *bitcask.Bitcask) *Server {
+	return &Server{
+		db:      db,
+		cursors: newCursorTable(),
+		start:   time.Now(),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve 接受客户端连接, 直到 ln 被关闭或 Close 被调用
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	s.ln = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		s.connections.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			_ = s.serveConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// Close 停止接受连接并断开所有客户端
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// client 连接的状态
+type client struct {
+	srv  *Server
+	id   int64
+	name string
+	w    *writer
+	quit bool
+}
+
+func (s *Server) serveConn(conn net.Conn) error {
+	c := &client{
+		srv: s,
+		id:  s.clientID.Add(1),
+		w:   &writer{Writer: bufio.NewWriter(conn), proto: 2},
+	}
+	r := bufio.NewReader(conn)
+
+	for !c.quit {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, ErrProtocol) {
+				c.w.error("ERR Protocol error")
+				_ = c.w.Flush()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		s.commands.Add(1)
+		c.exec(args)
+		if r.Buffered() == 0 || c.quit {
+			if err := c.w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
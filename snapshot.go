@@ -0,0 +1,115 @@
+package bitcask
+
+import (
+	"github.com/chhz0/bitcask/internal"
+)
+
+// Snapshot 某一时刻的只读视图, 不受之后的写入和合并影响
+//
+// 快照未释放期间, 合并会保留其引用的旧版本记录, blob 回收会跳过其引用的 blob 文件,
+// 使用完毕后需要调用 Release
+type Snapshot struct {
+	db       *Bitcask
+	keydir   *internal.Keydir
+	released bool
+}
+
+// Snapshot 创建当前时刻的快照
+func (b *Bitcask) Snapshot() (*Snapshot, error) {
+	// Clone 需要独占 keydir
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	s := &Snapshot{db: b, keydir: b.keydir.Clone()}
+	b.snapshots[s] = struct{}{}
+	return s, nil
+}
+
+// Get 读取快照时刻 key 对应的值
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	s.db.rw.RLock()
+	defer s.db.rw.RUnlock()
+
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	entry, ok := lookup(s.keydir, key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return s.db.readValue(key, entry)
+}
+
+// ListKeys 返回快照中所有的键
+func (s *Snapshot) ListKeys() ([][]byte, error) {
+	s.db.rw.RLock()
+	defer s.db.rw.RUnlock()
+
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return listKeys(s.keydir), nil
+}
+
+// Fold 按键的顺序遍历快照中的键值对, fn 执行期间持有读锁, 不能在 fn 中写入
+func (s *Snapshot) Fold(fn func([]byte, []byte, any) any, acc any) (any, error) {
+	s.db.rw.RLock()
+	defer s.db.rw.RUnlock()
+
+	if err := s.check(); err != nil {
+		return acc, err
+	}
+	return s.db.fold(s.keydir, fn, acc)
+}
+
+// Release 释放快照, 之后合并不再为其保留旧版本记录
+func (s *Snapshot) Release() error {
+	s.db.rw.Lock()
+	defer s.db.rw.Unlock()
+
+	if s.released {
+		return nil
+	}
+	s.released = true
+	delete(s.db.snapshots, s)
+	return nil
+}
+
+func (s *Snapshot) check() error {
+	if s.released {
+		return ErrSnapshotReleased
+	}
+	if s.db.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// retained 返回 key 在任一快照中引用 (id, pos) 处记录的元信息
+func (b *Bitcask) retained(key []byte, id uint32, pos int64) (*internal.KeydirEntry, bool) {
+	for s := range b.snapshots {
+		if entry, ok := s.keydir.Get(key); ok && entry.FileID == id && entry.RecordPos == pos {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// snapshotBlobs 返回被快照引用的 blob 文件
+func (b *Bitcask) snapshotBlobs() map[uint32]bool {
+	ids := make(map[uint32]bool)
+	for s := range b.snapshots {
+		s.keydir.Ascend(func(_ []byte, entry *internal.KeydirEntry) bool {
+			if entry.Blob != nil {
+				ids[entry.Blob.FileID] = true
+			}
+			return true
+		})
+	}
+	return ids
+}
@@ -0,0 +1,85 @@
+package bitcask
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot_Isolation(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+	require.NoError(t, b.Put([]byte("a"), []byte("1")))
+	require.NoError(t, b.Put([]byte("b"), []byte("1")))
+
+	s, err := b.Snapshot()
+	require.NoError(t, err)
+
+	require.NoError(t, b.Put([]byte("a"), []byte("2")))
+	require.NoError(t, b.Delete([]byte("b")))
+	require.NoError(t, b.Put([]byte("c"), []byte("2")))
+
+	val, err := s.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), val, "Snapshot should not see later writes")
+
+	acc, err := s.Fold(func(k, v []byte, acc any) any {
+		return acc.(string) + string(k) + "=" + string(v) + ";"
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "a=1;b=1;", acc)
+
+	require.NoError(t, s.Release())
+	_, err = s.Get([]byte("a"))
+	assert.ErrorIs(t, err, ErrSnapshotReleased)
+}
+
+func TestSnapshot_Merge(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir, WithMaxFileSize(512))
+	require.NoError(t, err)
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%02d", i)) }
+	for i := 0; i < 20; i++ {
+		require.NoError(t, b.Put(key(i), []byte("old")))
+	}
+
+	s, err := b.Snapshot()
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			require.NoError(t, b.Delete(key(i)))
+		} else {
+			require.NoError(t, b.Put(key(i), []byte("new")))
+		}
+	}
+
+	require.NoError(t, b.Merge())
+	require.NoError(t, b.Merge())
+
+	for i := 0; i < 20; i++ {
+		val, err := s.Get(key(i))
+		require.NoError(t, err, "Merge should keep versions held by snapshot")
+		assert.Equal(t, []byte("old"), val)
+	}
+
+	check := func(b *Bitcask) {
+		for i := 0; i < 20; i++ {
+			val, err := b.Get(key(i))
+			if i%2 == 0 {
+				assert.ErrorIs(t, err, ErrKeyNotFound, "Retained versions should not resurrect deleted keys")
+				continue
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []byte("new"), val)
+		}
+	}
+
+	check(b)
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir)
+	check(b)
+}
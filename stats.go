@@ -0,0 +1,39 @@
+package bitcask
+
+// Stats 存储引擎的统计信息, 文件大小包含文件头
+type Stats struct {
+	Keys      int   // 键的数量, 可能包括已过期但尚未被读取或合并清除的键
+	DataFiles int   // 数据文件数量, 包括活跃文件
+	DataSize  int64 // 数据文件总大小
+	BlobFiles int   // blob 文件数量
+	BlobSize  int64 // blob 文件总大小
+	BlobDead  int64 // blob 文件中可以被 BlobGC 回收的字节数
+	Snapshots int   // 未释放的快照数量
+}
+
+// Stats 返回存储引擎当前的统计信息
+func (b *Bitcask) Stats() (Stats, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return Stats{}, ErrClosed
+	}
+
+	st := Stats{
+		Keys:      b.keydir.Len(),
+		DataFiles: len(b.files),
+		BlobFiles: len(b.blobs.files),
+		Snapshots: len(b.snapshots),
+	}
+	for _, df := range b.files {
+		st.DataSize += df.Size()
+	}
+	for id, df := range b.blobs.files {
+		st.BlobSize += df.Size()
+		if stat, ok := b.blobs.stats[id]; ok {
+			st.BlobDead += stat.dead
+		}
+	}
+	return st, nil
+}
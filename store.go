@@ -0,0 +1,20 @@
+package bitcask
+
+import "context"
+
+// Store *Bitcask 和远程客户端共同实现的接口, 调用方可以据此在嵌入式和远程存储之间切换
+type Store interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	ScanKeys(prefix, after []byte, limit int) ([][]byte, error)
+	WriteBatch(wb *Batch) error
+	Watch(ctx context.Context, prefix []byte) (<-chan Event, error)
+	Sync() error
+	Merge() error
+	Stats() (Stats, error)
+	Close() error
+}
+
+var _ Store = (*Bitcask)(nil)
@@ -0,0 +1,287 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/codec"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+// streamTmpPattern 流式写入时暂存值的临时文件
+const streamTmpPattern = "stream-*.tmp"
+
+// PutStream 流式写入 key 对应的值, 值从 r 中读取 size 字节
+//
+// 值先写入数据目录中的临时文件, 读取 r 期间不持有写锁, 不需要将整个值读入内存;
+// 读完后在写锁内从临时文件追加到活跃数据文件, 达到 BlobThreshold 时追加到活跃 blob 文件,
+// 同时增量计算校验和. r 提前结束或返回错误时不会留下任何记录. 事件的 Value 为 nil
+func (b *Bitcask) PutStream(key []byte, r io.Reader, size int64) error {
+	if err := checkKeyValue(key, nil); err != nil {
+		return err
+	}
+	if size < 0 || size > math.MaxUint32 {
+		return ErrValueTooLarge
+	}
+
+	b.rw.RLock()
+	err := b.checkWritable()
+	b.rw.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	typ := internal.TypeNormal
+	if b.options.ChunkChecksum && size > chunkSize {
+		typ = internal.TypeChunked
+		r, size = newChunkEncoder(r), chunkedSize(size)
+		if size > math.MaxUint32 {
+			return ErrValueTooLarge
+		}
+	}
+
+	spool, err := spoolStream(b.options.Dir, r, size)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+
+	var entry *internal.KeydirEntry
+	if b.options.BlobThreshold > 0 && size >= b.options.BlobThreshold {
+		ptr, err := b.blobs.writeStream(typ, key, spool, uint32(size))
+		if err != nil {
+			return err
+		}
+		if entry, err = b.writeRecord(internal.TypeBlobPointer, key, encodeBlobPointer(ptr)); err != nil {
+			return err
+		}
+		entry.Blob = ptr
+	} else if entry, err = b.writeStream(typ, key, spool, uint32(size)); err != nil {
+		return err
+	}
+
+	if old, ok := b.keydir.Put(bytes.Clone(key), entry); ok {
+		b.blobs.release(key, old)
+	}
+	b.watch.publish(OpPut, key, nil, entry)
+	return nil
+}
+
+// spoolStream 将 r 中的 size 字节写入 dir 中的临时文件, 返回定位在文件开头的临时文件
+func spoolStream(dir string, r io.Reader, size int64) (*os.File, error) {
+	f, err := os.CreateTemp(dir, streamTmpPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := io.CopyN(f, r, size)
+	if n < size && errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// removeStreamTmp 删除崩溃时遗留的临时文件
+func removeStreamTmp(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, streamTmpPattern))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bitcask) writeStream(typ internal.RecordType, key []byte, r io.Reader, size uint32) (*internal.KeydirEntry, error) {
+	active, err := b.activeFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if !active.Empty() && active.Size()+streamRecordSize(active, key, size) > b.options.MaxFileSize {
+		if active, err = b.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	tstamp, seq := time.Now().Unix(), b.nextSeq()
+	pos, recSz, err := active.WriteStream(typ, tstamp, seq, key, r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.options.SyncOnWrite {
+		if err := active.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	b.observeSeq(active.ID(), seq)
+	return newKeydirEntry(active.ID(), &internal.Entry{Type: typ, Tstamp: tstamp, Seq: seq}, pos, recSz, size), nil
+}
+
+func (bs *blobStore) writeStream(typ internal.RecordType, key []byte, r io.Reader, size uint32) (*internal.BlobPointer, error) {
+	active, err := bs.activeFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if !active.Empty() && active.Size()+streamRecordSize(active, key, size) > bs.opts.MaxFileSize {
+		if active, err = bs.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	pos, recSz, err := active.WriteStream(typ, time.Now().Unix(), 0, key, r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if bs.opts.SyncOnWrite {
+		if err := active.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	bs.stats[active.ID()].total += int64(recSz)
+
+	return &internal.BlobPointer{
+		FileID:  active.ID(),
+		Offset:  pos + int64(recSz-size),
+		Size:    size,
+		Chunked: typ == internal.TypeChunked,
+	}, nil
+}
+
+// streamRecordSize 估算记录大小, 紧凑格式取记录头的上限
+func streamRecordSize(df *datafile.DataFile, key []byte, size uint32) int64 {
+	return int64(df.Codec().HeaderSize()+len(key)) + int64(size)
+}
+
+// GetReader 返回读取 key 对应值的 io.ReadCloser
+//
+// reader 持有独立的文件句柄, 不受之后的写入和合并影响, 使用完毕后需要 Close.
+// 读到末尾时校验整条记录的校验和, 不一致时返回 ErrCRCValidation
+func (b *Bitcask) GetReader(key []byte) (io.ReadCloser, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	entry, ok := lookup(b.keydir, key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	if entry.Blob != nil {
+		df, ok := b.blobs.files[entry.Blob.FileID]
+		if !ok {
+			return nil, ErrDataFileNotFound
+		}
+		recPos := entry.Blob.Offset - int64(df.Codec().HeaderSize()+len(key))
+		return newValueReader(df, recPos, entry.Blob.Offset, entry.Blob.Size, entry.Blob.Chunked)
+	}
+
+	if entry.Counter {
+		val, err := b.readCounter(entry)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(val)), nil
+	}
+
+	df, ok := b.files[entry.FileID]
+	if !ok {
+		return nil, ErrDataFileNotFound
+	}
+	return newValueReader(df, entry.RecordPos, entry.ValuePos, entry.ValueSz, entry.Chunked)
+}
+
+// valueReader 读取记录中的值, 同时增量计算校验和
+type valueReader struct {
+	f      *os.File
+	r      *io.SectionReader
+	digest codec.Digest
+	sum    uint64
+}
+
+// newValueReader 创建读取记录中值的 reader, chunked 为 true 时去除值中的分块校验和
+func newValueReader(df *datafile.DataFile, recPos, valPos int64, valSz uint32, chunked bool) (io.ReadCloser, error) {
+	if recPos < codec.FileHeaderSize || valPos < recPos {
+		return nil, ErrInvalidBlobPtr
+	}
+
+	f, err := os.Open(df.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, valPos-recPos)
+	if _, err := f.ReadAt(head, recPos); err != nil {
+		_ = f.Close()
+		if errors.Is(err, io.EOF) {
+			return nil, codec.ErrIncompleteRead
+		}
+		return nil, err
+	}
+
+	c := df.Codec()
+	digest := c.Checksum().New()
+	_, _ = digest.Write(head[c.Checksum().Size():])
+
+	vr := &valueReader{
+		f:      f,
+		r:      io.NewSectionReader(f, valPos, int64(valSz)),
+		digest: digest,
+		sum:    c.ReadChecksum(head),
+	}
+	if chunked {
+		return struct {
+			io.Reader
+			io.Closer
+		}{newChunkDecoder(vr), vr}, nil
+	}
+	return vr, nil
+}
+
+func (vr *valueReader) Read(p []byte) (int, error) {
+	n, err := vr.r.Read(p)
+	_, _ = vr.digest.Write(p[:n])
+	if errors.Is(err, io.EOF) && vr.digest.Sum64() != vr.sum {
+		return n, ErrCRCValidation
+	}
+	return n, err
+}
+
+func (vr *valueReader) Close() error {
+	return vr.f.Close()
+}
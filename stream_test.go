@@ -0,0 +1,163 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream_PutGetReader(t *testing.T) {
+	for _, threshold := range []int64{0, 1024} {
+		dir := t.TempDir()
+		b, err := Open(dir, WithBlobThreshold(threshold), WithRecordFormat(FormatCompact))
+		require.NoError(t, err)
+
+		large := bytes.Repeat([]byte("0123456789"), 100*1024)
+		require.NoError(t, b.PutStream([]byte("large"), bytes.NewReader(large), int64(len(large))))
+		require.NoError(t, b.Put([]byte("small"), []byte("v")))
+
+		val, err := b.Get([]byte("large"))
+		require.NoError(t, err)
+		assert.Equal(t, large, val, "Streamed value should be readable with Get")
+
+		r, err := b.GetReader([]byte("large"))
+		require.NoError(t, err)
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, large, got)
+
+		require.NoError(t, b.Close())
+
+		b = openTestBitcask(t, dir, WithBlobThreshold(threshold))
+		r, err = b.GetReader([]byte("small"))
+		require.NoError(t, err)
+		got, err = io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, []byte("v"), got)
+	}
+}
+
+func TestStream_ShortReader(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Put([]byte("k1"), []byte("v1")))
+	err = b.PutStream([]byte("k2"), bytes.NewReader([]byte("short")), 1024)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "Short reader should fail the write")
+
+	readErr := errors.New("read failed")
+	err = b.PutStream([]byte("k2"), io.MultiReader(bytes.NewReader([]byte("abc")), iotest.ErrReader(readErr)), 1024)
+	assert.ErrorIs(t, err, readErr)
+
+	require.NoError(t, b.Put([]byte("k3"), []byte("v3")))
+	_, err = b.Get([]byte("k2"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	require.NoError(t, b.Close())
+
+	b = openTestBitcask(t, dir)
+	for _, k := range []string{"k1", "k3"} {
+		_, err := b.Get([]byte(k))
+		require.NoError(t, err, "Failed streams should not leave garbage in the data file")
+	}
+}
+
+func TestStream_NotBlockingWrites(t *testing.T) {
+	dir := t.TempDir()
+	b := openTestBitcask(t, dir)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- b.PutStream([]byte("k"), pr, 6) }()
+
+	_, err := pw.Write([]byte("abc"))
+	require.NoError(t, err)
+
+	// 流式写入等待数据期间, 其他读写不被阻塞
+	require.NoError(t, b.Put([]byte("other"), []byte("v")))
+	val, err := b.Get([]byte("other"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), val)
+	_, err = b.Get([]byte("k"))
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Unfinished stream should not be visible")
+
+	_, err = pw.Write([]byte("def"))
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+	val, err = b.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abcdef"), val)
+
+	pr, pw = io.Pipe()
+	go func() { done <- b.PutStream([]byte("k"), pr, 6) }()
+	_, err = pw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, pw.CloseWithError(errors.New("aborted")))
+	assert.Error(t, <-done)
+
+	tmps, err := filepath.Glob(filepath.Join(dir, streamTmpPattern))
+	require.NoError(t, err)
+	assert.Empty(t, tmps, "Failed streams should remove the temporary file")
+	val, err = b.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abcdef"), val)
+}
+
+func TestStream_SharedFiles(t *testing.T) {
+	for _, threshold := range []int64{0, 1024} {
+		b := openTestBitcask(t, t.TempDir(), WithBlobThreshold(threshold))
+
+		val := bytes.Repeat([]byte("v"), 2048)
+		for i := range 20 {
+			require.NoError(t, b.PutStream([]byte(fmt.Sprintf("k%02d", i)), bytes.NewReader(val), int64(len(val))))
+		}
+
+		// 流式写入追加到活跃文件, 不会为每个值创建新文件
+		st, err := b.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, 1, st.DataFiles)
+		if threshold == 0 {
+			assert.Zero(t, st.BlobFiles, "Zero threshold should not separate values")
+		} else {
+			assert.Equal(t, 1, st.BlobFiles)
+		}
+
+		got, err := b.Get([]byte("k07"))
+		require.NoError(t, err)
+		assert.Equal(t, val, got)
+	}
+}
+
+func TestStream_ReaderChecksum(t *testing.T) {
+	dir := t.TempDir()
+	b := openTestBitcask(t, dir)
+
+	val := bytes.Repeat([]byte("v"), 4096)
+	require.NoError(t, b.Put([]byte("k"), val))
+	require.NoError(t, b.Sync())
+
+	// 篡改值的最后一个字节
+	path := datafile.Name(dir, 1, datafile.DataExt)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0x01
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	r, err := b.GetReader([]byte("k"))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, ErrCRCValidation, "Reader should verify the checksum at EOF")
+}
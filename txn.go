@@ -0,0 +1,130 @@
+package bitcask
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+)
+
+// Txn 乐观事务, 读取来自 Begin 时的快照, 写入在提交时作为一个批次原子生效
+//
+// 提交时若事务读取过的键在 Begin 之后被修改, 返回 ErrTxnConflict.
+// 合并或 blob 回收移动了被读取的记录时同样视为冲突. Txn 不是并发安全的
+type Txn struct {
+	db     *Bitcask
+	snap   *internal.Keydir
+	writes *Batch
+	reads  map[string]*internal.KeydirEntry
+	done   bool
+}
+
+// Begin 开始一个事务
+func (b *Bitcask) Begin() (*Txn, error) {
+	// Clone 需要独占 keydir
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	return &Txn{
+		db:     b,
+		snap:   b.keydir.Clone(),
+		writes: NewBatch(),
+		reads:  make(map[string]*internal.KeydirEntry),
+	}, nil
+}
+
+// Get 读取 key, 优先返回事务内未提交的写入
+//
+// 快照中的记录已被修改时事务必然无法提交, 直接返回 ErrTxnConflict
+func (tx *Txn) Get(key []byte) ([]byte, error) {
+	if tx.done {
+		return nil, ErrTxnClosed
+	}
+
+	if op, ok := tx.writes.get(key); ok {
+		if op.deleted {
+			return nil, ErrKeyNotFound
+		}
+		return bytes.Clone(op.value), nil
+	}
+
+	seen, ok := tx.snap.Get(key)
+	tx.reads[string(key)] = seen
+
+	tx.db.rw.RLock()
+	defer tx.db.rw.RUnlock()
+
+	if tx.db.closed {
+		return nil, ErrClosed
+	}
+	if cur, _ := tx.db.keydir.Get(key); cur != seen {
+		return nil, ErrTxnConflict
+	}
+	if !ok || seen.Expired(time.Now().UnixMilli()) {
+		return nil, ErrKeyNotFound
+	}
+
+	return tx.db.readValue(key, seen)
+}
+
+// Put 在事务中写入 key/value, 提交前对其他读者不可见
+func (tx *Txn) Put(key, value []byte) error {
+	if tx.done {
+		return ErrTxnClosed
+	}
+	return tx.writes.Put(key, value)
+}
+
+// Delete 在事务中删除 key
+func (tx *Txn) Delete(key []byte) error {
+	if tx.done {
+		return ErrTxnClosed
+	}
+	return tx.writes.Delete(key)
+}
+
+// Commit 校验读取过的键未被修改, 并原子地写入事务中的所有修改
+//
+// 无论成功与否, 事务都将结束
+func (tx *Txn) Commit() error {
+	if tx.done {
+		return ErrTxnClosed
+	}
+	tx.done = true
+
+	db := tx.db
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	for key, seen := range tx.reads {
+		if cur, _ := db.keydir.Get([]byte(key)); cur != seen {
+			return ErrTxnConflict
+		}
+	}
+
+	if tx.writes.Len() == 0 {
+		return nil
+	}
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+	return db.writeBatch(tx.writes)
+}
+
+// Rollback 放弃事务中的所有修改
+func (tx *Txn) Rollback() error {
+	if tx.done {
+		return ErrTxnClosed
+	}
+	tx.done = true
+	tx.writes.Reset()
+	return nil
+}
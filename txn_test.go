@@ -0,0 +1,77 @@
+package bitcask
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxn_Commit(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+	require.NoError(t, b.Put([]byte("x"), []byte("1")))
+
+	tx, err := b.Begin()
+	require.NoError(t, err)
+
+	val, err := tx.Get([]byte("x"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), val)
+
+	require.NoError(t, tx.Put([]byte("x"), []byte("2")))
+	require.NoError(t, tx.Delete([]byte("y")))
+
+	val, err = tx.Get([]byte("x"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), val, "Txn should read its own writes")
+
+	val, err = b.Get([]byte("x"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), val, "Uncommitted writes should not be visible")
+
+	require.NoError(t, tx.Commit())
+	val, err = b.Get([]byte("x"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), val)
+
+	assert.ErrorIs(t, tx.Commit(), ErrTxnClosed)
+	assert.ErrorIs(t, tx.Put([]byte("x"), nil), ErrTxnClosed)
+}
+
+func TestTxn_Conflict(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+	require.NoError(t, b.Put([]byte("x"), []byte("1")))
+
+	tx, err := b.Begin()
+	require.NoError(t, err)
+	_, err = tx.Get([]byte("x"))
+	require.NoError(t, err)
+	_, err = tx.Get([]byte("absent"))
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	require.NoError(t, tx.Put([]byte("z"), []byte("1")))
+
+	require.NoError(t, b.Put([]byte("absent"), []byte("now")))
+	assert.ErrorIs(t, tx.Commit(), ErrTxnConflict, "Key read as absent was created")
+
+	_, err = b.Get([]byte("z"))
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Conflicting txn should not write")
+
+	// 快照之后被修改的键直接返回冲突
+	tx, err = b.Begin()
+	require.NoError(t, err)
+	require.NoError(t, b.Put([]byte("x"), []byte("2")))
+	_, err = tx.Get([]byte("x"))
+	assert.ErrorIs(t, err, ErrTxnConflict)
+	require.NoError(t, tx.Rollback())
+
+	// 只写不读的事务不会冲突
+	tx, err = b.Begin()
+	require.NoError(t, err)
+	require.NoError(t, tx.Put([]byte("x"), []byte("3")))
+	require.NoError(t, b.Put([]byte("x"), []byte("4")))
+	require.NoError(t, tx.Commit())
+
+	val, err := b.Get([]byte("x"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("3"), val)
+}
@@ -0,0 +1,500 @@
+package bitcask
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/datafile"
+)
+
+// defaultScrubInterval ScrubOptions.Interval 的默认值
+const defaultScrubInterval = 24 * time.Hour
+
+// VerifyReport Verify 的检查结果
+type VerifyReport struct {
+	Files   int   // 检查的文件数量, 包括数据文件, hint 文件和 blob 文件
+	Records int   // 通过校验的记录数量
+	Bytes   int64 // 读取的字节数
+
+	Corrupt     []CorruptRange  // 无法通过校验的区间
+	OrphanHints []OrphanHint    // 在数据文件中找不到对应记录的 hint 记录
+	Unreadable  []UnreadableKey // 最新版本无法读取的键
+}
+
+// OK 判断是否没有发现任何问题
+func (r *VerifyReport) OK() bool {
+	return len(r.Corrupt) == 0 && len(r.OrphanHints) == 0 && len(r.Unreadable) == 0
+}
+
+// CorruptRange 文件中无法通过校验的区间, 文件末尾未写完的记录同样会被报告
+type CorruptRange struct {
+	File   string // 文件名, 如 000000001.data
+	Offset int64
+	Size   int64
+	Err    error
+}
+
+// OrphanHint 指向的位置在数据文件中没有对应记录的 hint 记录
+type OrphanHint struct {
+	FileID    uint32
+	Key       []byte
+	RecordPos int64
+	RecordSz  uint32
+}
+
+// UnreadableKey 最新版本无法读取的键
+//
+// Blob 为 true 时 FileID 为 blob 文件, Pos 为值在 blob 文件中的偏移,
+// 否则 FileID 为数据文件, Pos 为记录的偏移
+type UnreadableKey struct {
+	Key    []byte
+	FileID uint32
+	Pos    int64
+	Blob   bool
+	Err    error
+}
+
+// ScrubOptions Scrub 的参数
+type ScrubOptions struct {
+	// Interval 一次校验结束到下一次校验开始的间隔, 默认 24 小时
+	Interval time.Duration
+	// RateLimit 每秒读取的字节数上限, 0 表示不限制
+	RateLimit int64
+	// OnReport 每次校验结束后调用
+	OnReport func(VerifyReport, error)
+}
+
+// Verify 读取所有数据文件, hint 文件和 blob 文件中的每一条记录并检查:
+//
+//   - 记录的校验和, 损坏的区间被跳过并报告, 之后的记录继续检查
+//   - keydir 中的每个键都指向一条键和长度都匹配的有效记录, 分块存储的值逐块校验
+//   - hint 记录指向的位置在数据文件中有对应的记录
+//
+// 检查开始时获取 keydir 的快照并打开文件的独立句柄, 之后不持有锁, 不影响读写和合并
+func (b *Bitcask) Verify(ctx context.Context) (VerifyReport, error) {
+	return b.verify(ctx, 0)
+}
+
+// Scrub 周期性地执行 Verify, 按 RateLimit 限制读取速率, 通常在单独的 goroutine 中运行
+//
+// 直到 ctx 取消或 Bitcask 关闭时返回 ctx.Err() 或 ErrClosed
+func (b *Bitcask) Scrub(ctx context.Context, opts ScrubOptions) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultScrubInterval
+	}
+
+	for {
+		report, err := b.verify(ctx, opts.RateLimit)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrClosed) {
+			return err
+		}
+		if opts.OnReport != nil {
+			opts.OnReport(report, err)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (b *Bitcask) verify(ctx context.Context, rate int64) (VerifyReport, error) {
+	v, err := b.openVerifier(ctx, rate)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	defer v.close()
+
+	if err := v.run(); err != nil {
+		return VerifyReport{}, err
+	}
+	v.report.Bytes = v.th.n
+	return v.report, nil
+}
+
+// verifier 一次 Verify 的状态
+type verifier struct {
+	dir    string
+	keydir *internal.Keydir
+	th     *throttle
+	data   map[uint32]*verifyFile
+	hints  map[uint32]*verifyFile
+	blobs  map[uint32]*verifyFile
+	report VerifyReport
+}
+
+// verifyFile 检查开始时打开的文件句柄, 只检查前 size 字节
+type verifyFile struct {
+	name string
+	f    *os.File
+	size int64
+}
+
+type verifyKey struct {
+	key   []byte
+	entry *internal.KeydirEntry
+}
+
+type verifyHint struct {
+	key  []byte
+	size uint32
+}
+
+// openVerifier 获取 keydir 的快照并打开所有文件, 合并删除或改写文件不影响已打开的句柄
+func (b *Bitcask) openVerifier(ctx context.Context, rate int64) (*verifier, error) {
+	// Clone 需要独占 keydir
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	v := &verifier{
+		dir:    b.options.Dir,
+		keydir: b.keydir.Clone(),
+		th:     &throttle{ctx: ctx, rate: rate, start: time.Now()},
+		data:   make(map[uint32]*verifyFile, len(b.files)),
+		hints:  make(map[uint32]*verifyFile),
+		blobs:  make(map[uint32]*verifyFile, len(b.blobs.files)),
+	}
+	for id, df := range b.files {
+		if err := v.open(v.data, id, df.Path(), df.Size()); err != nil {
+			v.close()
+			return nil, err
+		}
+	}
+	for id, df := range b.blobs.files {
+		if err := v.open(v.blobs, id, df.Path(), df.Size()); err != nil {
+			v.close()
+			return nil, err
+		}
+	}
+
+	ids, err := datafile.List(v.dir, datafile.HintExt)
+	if err != nil {
+		v.close()
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := v.open(v.hints, id, datafile.Name(v.dir, id, datafile.HintExt), -1); err != nil {
+			v.close()
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// open 打开 path, size 为负数时检查整个文件
+func (v *verifier) open(files map[uint32]*verifyFile, id uint32, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		size = fi.Size()
+	}
+	files[id] = &verifyFile{name: filepath.Base(path), f: f, size: size}
+	return nil
+}
+
+func (v *verifier) close() {
+	for _, files := range []map[uint32]*verifyFile{v.data, v.hints, v.blobs} {
+		for _, vf := range files {
+			_ = vf.f.Close()
+		}
+	}
+}
+
+func (v *verifier) run() error {
+	keys := make(map[uint32][]verifyKey)
+	blobKeys := make(map[uint32][]verifyKey)
+	v.keydir.Ascend(func(key []byte, entry *internal.KeydirEntry) bool {
+		keys[entry.FileID] = append(keys[entry.FileID], verifyKey{key: key, entry: entry})
+		if entry.Blob != nil {
+			blobKeys[entry.Blob.FileID] = append(blobKeys[entry.Blob.FileID], verifyKey{key: key, entry: entry})
+		}
+		return true
+	})
+
+	for _, id := range sortedIDs(v.data, v.hints, keys) {
+		if err := v.verifyData(id, keys[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range sortedIDs(v.blobs, nil, blobKeys) {
+		if err := v.verifyBlob(id, blobKeys[id]); err != nil {
+			return err
+		}
+	}
+
+	slices.SortFunc(v.report.Unreadable, func(a, b UnreadableKey) int {
+		return bytes.Compare(a.Key, b.Key)
+	})
+	return nil
+}
+
+// verifyData 检查 id 对应的数据文件和 hint 文件, keys 为最新版本位于该数据文件的键
+func (v *verifier) verifyData(id uint32, keys []verifyKey) error {
+	hints, err := v.readHints(id)
+	if err != nil {
+		return err
+	}
+
+	expect := make(map[int64]verifyKey, len(keys))
+	for _, k := range keys {
+		expect[k.entry.RecordPos] = k
+	}
+
+	var bad []datafile.Corruption
+	if df, ok := v.data[id]; ok {
+		bad, err = v.scan(df, func(e *internal.Entry, pos int64, size uint32) {
+			if h, ok := hints[pos]; ok && h.size == size && bytes.Equal(h.key, e.Key) {
+				delete(hints, pos)
+			}
+
+			k, ok := expect[pos]
+			if !ok {
+				return
+			}
+			delete(expect, pos)
+			if err := checkRecord(k, e, size); err != nil {
+				v.unreadable(k.key, id, pos, false, err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pos := range sortedPositions(expect) {
+		v.unreadable(expect[pos].key, id, pos, false, missingErr(v.data[id], bad, pos))
+	}
+	for _, pos := range sortedPositions(hints) {
+		h := hints[pos]
+		v.report.OrphanHints = append(v.report.OrphanHints, OrphanHint{FileID: id, Key: h.key, RecordPos: pos, RecordSz: h.size})
+	}
+	return nil
+}
+
+// verifyBlob 检查 id 对应的 blob 文件, keys 为值位于该 blob 文件的键
+func (v *verifier) verifyBlob(id uint32, keys []verifyKey) error {
+	expect := make(map[int64]verifyKey, len(keys))
+	for _, k := range keys {
+		expect[k.entry.Blob.Offset] = k
+	}
+
+	var (
+		bad []datafile.Corruption
+		err error
+	)
+	if df, ok := v.blobs[id]; ok {
+		bad, err = v.scan(df, func(e *internal.Entry, pos int64, size uint32) {
+			off := pos + int64(size) - int64(len(e.Val))
+			k, ok := expect[off]
+			if !ok {
+				return
+			}
+			delete(expect, off)
+			if err := checkBlob(k, e); err != nil {
+				v.unreadable(k.key, id, off, true, err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, off := range sortedPositions(expect) {
+		v.unreadable(expect[off].key, id, off, true, missingErr(v.blobs[id], bad, off))
+	}
+	return nil
+}
+
+// readHints 读取 id 对应的 hint 文件, 返回记录位置到 hint 记录的映射
+func (v *verifier) readHints(id uint32) (map[int64]verifyHint, error) {
+	hints := make(map[int64]verifyHint)
+	hf, ok := v.hints[id]
+	if !ok {
+		return hints, nil
+	}
+
+	var invalid []datafile.Corruption
+	_, err := v.scan(hf, func(e *internal.Entry, pos int64, size uint32) {
+		if e.Type == internal.TypeDeleted || e.Type == internal.TypeCommit {
+			return
+		}
+		entry, err := decodeHint(e, id)
+		if err != nil {
+			invalid = append(invalid, datafile.Corruption{Offset: pos, Size: int64(size), Err: err})
+			return
+		}
+		hints[entry.RecordPos] = verifyHint{key: e.Key, size: entry.RecordSz}
+	})
+	for _, c := range invalid {
+		v.corrupt(hf, c)
+	}
+	return hints, err
+}
+
+// scan 校验 vf 中的所有记录, 报告损坏的区间
+func (v *verifier) scan(vf *verifyFile, fn func(e *internal.Entry, pos int64, size uint32)) ([]datafile.Corruption, error) {
+	v.report.Files++
+	bad, err := datafile.Verify(throttledFile{f: vf.f, th: v.th}, vf.size, func(e *internal.Entry, pos int64, size uint32) {
+		v.report.Records++
+		fn(e, pos, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range bad {
+		v.corrupt(vf, c)
+	}
+	return bad, nil
+}
+
+func (v *verifier) corrupt(vf *verifyFile, c datafile.Corruption) {
+	v.report.Corrupt = append(v.report.Corrupt, CorruptRange{File: vf.name, Offset: c.Offset, Size: c.Size, Err: c.Err})
+}
+
+func (v *verifier) unreadable(key []byte, id uint32, pos int64, blob bool, err error) {
+	v.report.Unreadable = append(v.report.Unreadable, UnreadableKey{Key: key, FileID: id, Pos: pos, Blob: blob, Err: err})
+}
+
+// checkRecord 检查数据记录与 keydir 中的元信息是否一致
+func checkRecord(k verifyKey, e *internal.Entry, size uint32) error {
+	if size != k.entry.RecordSz || !bytes.Equal(e.Key, k.key) {
+		return ErrRecordMismatch
+	}
+	switch {
+	case k.entry.Blob != nil:
+		if e.Type != internal.TypeBlobPointer {
+			return ErrRecordMismatch
+		}
+	case k.entry.Counter:
+		if len(e.Val) != counterSize {
+			return ErrNotCounter
+		}
+	case k.entry.Chunked:
+		if _, err := decodeChunked(e.Val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBlob 检查 blob 记录与 blob 指针是否一致
+func checkBlob(k verifyKey, e *internal.Entry) error {
+	ptr := k.entry.Blob
+	if uint32(len(e.Val)) != ptr.Size || !bytes.Equal(e.Key, k.key) {
+		return ErrRecordMismatch
+	}
+	if ptr.Chunked {
+		if _, err := decodeChunked(e.Val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingErr 返回 pos 处没有找到预期记录的原因
+func missingErr(vf *verifyFile, bad []datafile.Corruption, pos int64) error {
+	if vf == nil {
+		return ErrDataFileNotFound
+	}
+	for _, c := range bad {
+		if pos >= c.Offset && pos < c.Offset+c.Size {
+			return c.Err
+		}
+	}
+	return ErrRecordMismatch
+}
+
+func sortedIDs[K any](files, hints map[uint32]*verifyFile, keys map[uint32][]K) []uint32 {
+	var ids []uint32
+	for id := range files {
+		ids = append(ids, id)
+	}
+	for id := range hints {
+		ids = append(ids, id)
+	}
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+func sortedPositions[V any](m map[int64]V) []int64 {
+	pos := make([]int64, 0, len(m))
+	for p := range m {
+		pos = append(pos, p)
+	}
+	slices.Sort(pos)
+	return pos
+}
+
+// throttle 限制读取速率并统计读取的字节数
+type throttle struct {
+	ctx   context.Context
+	rate  int64 // 每秒字节数, 0 表示不限制
+	start time.Time
+	n     int64
+}
+
+// wait 记录读取了 n 字节, 读取速度超过限制时等待
+func (t *throttle) wait(n int) error {
+	t.n += int64(n)
+	if t.rate <= 0 {
+		return t.ctx.Err()
+	}
+
+	d := time.Duration(float64(t.n)/float64(t.rate)*float64(time.Second)) - time.Since(t.start)
+	if d <= 0 {
+		return t.ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledFile 按 throttle 限速读取的文件
+type throttledFile struct {
+	f  *os.File
+	th *throttle
+}
+
+func (tf throttledFile) ReadAt(b []byte, off int64) (int, error) {
+	if err := tf.th.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := tf.f.ReadAt(b, off)
+	if werr := tf.th.wait(n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
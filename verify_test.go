@@ -0,0 +1,144 @@
+package bitcask
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+	"github.com/chhz0/bitcask/internal/datafile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	b, err := Open(t.TempDir(), WithBlobThreshold(1024), WithChunkChecksum(true), WithCompactCounter(true))
+	require.NoError(t, err)
+	defer b.Close()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("val-%d", i))))
+	}
+	require.NoError(t, b.Put([]byte("blob"), bytes.Repeat([]byte("b"), 2048)))
+	require.NoError(t, b.Put([]byte("chunked"), bytes.Repeat([]byte("c"), chunkSize*2+1)))
+	_, err = b.Incr([]byte("counter"), 3)
+	require.NoError(t, err)
+	require.NoError(t, b.Delete([]byte("key-00")))
+	require.NoError(t, b.Merge())
+	require.NoError(t, b.Put([]byte("key-01"), []byte("after-merge")))
+
+	report, err := b.Verify(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+	assert.Positive(t, report.Records)
+	assert.Positive(t, report.Bytes)
+	// 合并后的数据文件和 hint 文件, 合并后的活跃文件以及 blob 文件
+	assert.GreaterOrEqual(t, report.Files, 4)
+}
+
+func TestVerify_Corruption(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	require.NoError(t, err)
+	defer b.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, b.Put([]byte(k), []byte("value-"+k)))
+	}
+	require.NoError(t, b.Sync())
+
+	// 篡改 b 的值
+	entry, ok := b.keydir.Get([]byte("b"))
+	require.True(t, ok)
+	f, err := os.OpenFile(datafile.Name(dir, entry.FileID, datafile.DataExt), os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff}, entry.ValuePos)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	report, err := b.Verify(context.Background())
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, 2, report.Records)
+	require.Len(t, report.Corrupt, 1)
+	assert.Equal(t, entry.RecordPos, report.Corrupt[0].Offset)
+	assert.Equal(t, int64(entry.RecordSz), report.Corrupt[0].Size)
+	assert.ErrorIs(t, report.Corrupt[0].Err, ErrCRCValidation)
+	require.Len(t, report.Unreadable, 1)
+	assert.Equal(t, []byte("b"), report.Unreadable[0].Key)
+	assert.ErrorIs(t, report.Unreadable[0].Err, ErrCRCValidation)
+	assert.Empty(t, report.OrphanHints)
+}
+
+func TestVerify_OrphanHint(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	require.NoError(t, err)
+	defer b.Close()
+
+	require.NoError(t, b.Put([]byte("a"), []byte("1")))
+	require.NoError(t, b.Merge())
+
+	ids, err := datafile.List(dir, datafile.HintExt)
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+	hf, err := openHintFile(datafile.Name(dir, ids[0], datafile.HintExt), ids[0])
+	require.NoError(t, err)
+	require.NoError(t, writeHint(hf, []byte("ghost"), &internal.KeydirEntry{RecordPos: 4096, RecordSz: 32}))
+	require.NoError(t, hf.Close())
+
+	report, err := b.Verify(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Corrupt)
+	assert.Empty(t, report.Unreadable)
+	require.Len(t, report.OrphanHints, 1)
+	assert.Equal(t, OrphanHint{FileID: ids[0], Key: []byte("ghost"), RecordPos: 4096, RecordSz: 32}, report.OrphanHints[0])
+}
+
+func TestScrub(t *testing.T) {
+	b, err := Open(t.TempDir())
+	require.NoError(t, err)
+	defer b.Close()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, b.Put([]byte(fmt.Sprintf("key-%02d", i)), bytes.Repeat([]byte("v"), 100)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reports := make(chan VerifyReport)
+	done := make(chan error)
+	start := time.Now()
+	go func() {
+		done <- b.Scrub(ctx, ScrubOptions{
+			Interval:  time.Millisecond,
+			RateLimit: 64 * 1024,
+			OnReport: func(r VerifyReport, err error) {
+				assert.NoError(t, err)
+				select {
+				case reports <- r:
+				case <-ctx.Done():
+				}
+			},
+		})
+	}()
+
+	var total int64
+	for range 2 {
+		r := <-reports
+		assert.True(t, r.OK())
+		assert.Equal(t, 100, r.Records)
+		total += r.Bytes
+	}
+	assert.GreaterOrEqual(t, time.Since(start), time.Duration(float64(total)/(64*1024)*float64(time.Second))*9/10,
+		"Scrub should respect the rate limit")
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// 关闭后停止
+	require.NoError(t, b.Close())
+	assert.ErrorIs(t, b.Scrub(context.Background(), ScrubOptions{}), ErrClosed)
+}
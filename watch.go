@@ -0,0 +1,158 @@
+package bitcask
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chhz0/bitcask/internal"
+)
+
+// watchBufferSize 每个订阅者缓冲的事件数, 缓冲区满时订阅者被视为落后并断开
+const watchBufferSize = 1024
+
+// Op 变更类型
+type Op uint8
+
+const (
+	OpPut Op = iota
+	OpDelete
+	// OpExpire Expire 修改了过期时间, 或已过期的键在读取或合并时被清除
+	OpExpire
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	case OpExpire:
+		return "expire"
+	default:
+		return "unknown"
+	}
+}
+
+// Event 一次已提交的变更
+//
+// Seq 为写入时分配给记录的序列号, 随写入单调递增, 合并和 blob 回收移动记录时保持不变.
+// 已过期的键被清除时 Seq 为过期记录的序列号, 不分配新的序列号.
+// 流式写入的值以及 OpExpire 事件不会放入值, Value 为 nil, 需要时通过 Get 读取.
+// Expiry 为记录的过期时间, 零值表示不过期; OpExpire 事件的 Expiry 不晚于当前时间时表示键已被清除.
+// Err 不为 nil 时表示订阅已因落后而断开, 之后通道被关闭
+type Event struct {
+	Seq    uint64
+	Op     Op
+	Key    []byte
+	Value  []byte
+	Expiry time.Time
+	Err    error
+}
+
+type watcher struct {
+	prefix []byte
+	ch     chan Event
+	done   chan struct{}
+}
+
+// watchHub 管理变更订阅, 发布由写路径在写锁内调用, 保证事件按序列号递增
+type watchHub struct {
+	mu   sync.Mutex
+	subs map[*watcher]struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{subs: make(map[*watcher]struct{})}
+}
+
+func (h *watchHub) add(prefix []byte) *watcher {
+	w := &watcher{
+		prefix: bytes.Clone(prefix),
+		// 预留一个位置用于投递落后事件
+		ch:   make(chan Event, watchBufferSize+1),
+		done: make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	h.subs[w] = struct{}{}
+	h.mu.Unlock()
+	return w
+}
+
+// remove 取消订阅并关闭通道, 可重复调用
+func (h *watchHub) remove(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(w)
+}
+
+func (h *watchHub) removeLocked(w *watcher) {
+	if _, ok := h.subs[w]; !ok {
+		return
+	}
+	delete(h.subs, w)
+	close(w.ch)
+	close(w.done)
+}
+
+// publish 向前缀匹配的订阅者投递事件, 不会阻塞
+func (h *watchHub) publish(op Op, key, value []byte, entry *internal.KeydirEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subs) == 0 {
+		return
+	}
+
+	ev := Event{
+		Seq:    entry.Seq,
+		Op:     op,
+		Key:    bytes.Clone(key),
+		Value:  bytes.Clone(value),
+		Expiry: expiryTime(entry.Expiry),
+	}
+	for w := range h.subs {
+		if !bytes.HasPrefix(key, w.prefix) {
+			continue
+		}
+		if len(w.ch) >= watchBufferSize {
+			w.ch <- Event{Seq: ev.Seq, Err: ErrWatchLagged}
+			h.removeLocked(w)
+			continue
+		}
+		w.ch <- ev
+	}
+}
+
+func (h *watchHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for w := range h.subs {
+		h.removeLocked(w)
+	}
+}
+
+// Watch 订阅键以 prefix 开头的变更, 返回的通道在 ctx 结束, 订阅落后或 Bitcask 关闭时被关闭
+//
+// 写入不会等待订阅者: 消费过慢导致缓冲区满时, 订阅者收到 Err 为 ErrWatchLagged 的事件后被断开
+func (b *Bitcask) Watch(ctx context.Context, prefix []byte) (<-chan Event, error) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	w := b.watch.add(prefix)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.done:
+		}
+		b.watch.remove(w)
+	}()
+	return w.ch, nil
+}
@@ -0,0 +1,129 @@
+package bitcask
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recvEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case ev, ok := <-ch:
+		require.True(t, ok, "Channel should not be closed")
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+	return Event{}
+}
+
+func TestWatch_Events(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := b.Watch(ctx, []byte("user:"))
+	require.NoError(t, err)
+
+	require.NoError(t, b.Put([]byte("user:1"), []byte("alice")))
+	require.NoError(t, b.Put([]byte("order:1"), []byte("ignored")))
+	require.NoError(t, b.Delete([]byte("user:1")))
+
+	wb := NewBatch()
+	require.NoError(t, wb.Put([]byte("user:2"), []byte("bob")))
+	require.NoError(t, b.WriteBatch(wb))
+
+	ev := recvEvent(t, ch)
+	assert.Equal(t, OpPut, ev.Op)
+	assert.Equal(t, []byte("user:1"), ev.Key)
+	assert.Equal(t, []byte("alice"), ev.Value)
+
+	del := recvEvent(t, ch)
+	assert.Equal(t, OpDelete, del.Op)
+	assert.Greater(t, del.Seq, ev.Seq, "Seq should increase with writes")
+
+	ev = recvEvent(t, ch)
+	assert.Equal(t, []byte("user:2"), ev.Key, "Batch writes should be published")
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok, "Channel should be closed after cancel")
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for channel close")
+	}
+}
+
+func TestWatch_Lagged(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+
+	ch, err := b.Watch(context.Background(), nil)
+	require.NoError(t, err)
+
+	for i := 0; i < watchBufferSize+10; i++ {
+		require.NoError(t, b.Put([]byte(fmt.Sprintf("k%d", i)), []byte("v")), "Writers should not block")
+	}
+
+	var n int
+	var last Event
+	for ev := range ch {
+		n++
+		last = ev
+	}
+	assert.Equal(t, watchBufferSize+1, n)
+	assert.ErrorIs(t, last.Err, ErrWatchLagged)
+}
+
+func TestWatch_Expire(t *testing.T) {
+	b := openTestBitcask(t, t.TempDir())
+
+	ch, err := b.Watch(context.Background(), nil)
+	require.NoError(t, err)
+
+	future := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	require.NoError(t, b.Put([]byte("a"), []byte("v")))
+	ok, err := b.Expire([]byte("a"), future)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	put := recvEvent(t, ch)
+	ev := recvEvent(t, ch)
+	assert.Equal(t, OpExpire, ev.Op)
+	assert.Equal(t, "expire", ev.Op.String())
+	assert.Equal(t, []byte("a"), ev.Key)
+	assert.True(t, future.Equal(ev.Expiry), "Expire should publish the new expiry")
+	assert.Greater(t, ev.Seq, put.Seq)
+
+	past := time.Now().Add(-time.Second)
+	require.NoError(t, b.PutWithExpiry([]byte("lazy"), []byte("v"), past))
+	require.NoError(t, b.PutWithExpiry([]byte("merged"), []byte("v"), past))
+	require.NoError(t, b.Put([]byte("last"), []byte("v")))
+	for range 3 {
+		recvEvent(t, ch)
+	}
+
+	_, err = b.Get([]byte("lazy"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	ev = recvEvent(t, ch)
+	assert.Equal(t, OpExpire, ev.Op)
+	assert.Equal(t, []byte("lazy"), ev.Key, "Lazily reaped keys should be published")
+	assert.False(t, ev.Expiry.After(time.Now()))
+
+	_, err = b.Get([]byte("lazy"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	require.NoError(t, b.Merge())
+	ev = recvEvent(t, ch)
+	assert.Equal(t, OpExpire, ev.Op)
+	assert.Equal(t, []byte("merged"), ev.Key, "Keys reaped by merge should be published once")
+
+	select {
+	case ev := <-ch:
+		t.Fatalf("Unexpected event %v %q", ev.Op, ev.Key)
+	default:
+	}
+}